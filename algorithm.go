@@ -0,0 +1,59 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import "strconv"
+
+// Algorithm is a cryptographic algorithm that
+// a KES server uses for a cryptographic key.
+type Algorithm uint
+
+// All algorithms known to the client.
+const (
+	// AlgorithmUnknown represents an algorithm
+	// that the client does not recognize - e.g.
+	// because the server is newer than the client.
+	AlgorithmUnknown Algorithm = iota
+
+	// AES256_GCM_SHA256 represents AES-256 in GCM
+	// mode with SHA-256 based key derivation.
+	AES256_GCM_SHA256
+
+	// XCHACHA20_POLY1305 represents XChaCha20 with
+	// Poly1305 as message authentication code.
+	XCHACHA20_POLY1305
+)
+
+// ParseAlgorithm parses the given string as Algorithm.
+//
+// It does not fail for unrecognized algorithm names.
+// Instead, it returns AlgorithmUnknown such that
+// clients keep working with newer servers. Callers
+// that need the raw name should keep the string.
+func ParseAlgorithm(s string) Algorithm {
+	switch s {
+	case "AES256-GCM_SHA256", "AES-256-GCM-HMAC-SHA-256":
+		return AES256_GCM_SHA256
+	case "XCHACHA20-POLY1305", "ChaCha20Poly1305":
+		return XCHACHA20_POLY1305
+	default:
+		return AlgorithmUnknown
+	}
+}
+
+// String returns the string representation
+// of the Algorithm.
+func (a Algorithm) String() string {
+	switch a {
+	case AlgorithmUnknown:
+		return "unknown"
+	case AES256_GCM_SHA256:
+		return "AES256-GCM_SHA256"
+	case XCHACHA20_POLY1305:
+		return "XCHACHA20-POLY1305"
+	default:
+		return "Algorithm(" + strconv.Itoa(int(a)) + ")"
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import "testing"
+
+var parseAlgorithmTests = []struct {
+	Name      string
+	Algorithm Algorithm
+	String    string
+}{
+	{Name: "AES256-GCM_SHA256", Algorithm: AES256_GCM_SHA256, String: "AES256-GCM_SHA256"},        // 0
+	{Name: "XCHACHA20-POLY1305", Algorithm: XCHACHA20_POLY1305, String: "XCHACHA20-POLY1305"},     // 1
+	{Name: "AES-256-GCM-HMAC-SHA-256", Algorithm: AES256_GCM_SHA256, String: "AES256-GCM_SHA256"}, // 2
+	{Name: "ChaCha20Poly1305", Algorithm: XCHACHA20_POLY1305, String: "XCHACHA20-POLY1305"},       // 3
+	{Name: "AES512-GCM_SHA512", Algorithm: AlgorithmUnknown, String: "unknown"},                   // 4
+	{Name: "", Algorithm: AlgorithmUnknown, String: "unknown"},                                    // 5
+}
+
+func TestParseAlgorithm(t *testing.T) {
+	for i, test := range parseAlgorithmTests {
+		algorithm := ParseAlgorithm(test.Name)
+		if algorithm != test.Algorithm {
+			t.Fatalf("Test %d: got %v - want %v", i, algorithm, test.Algorithm)
+		}
+		if s := algorithm.String(); s != test.String {
+			t.Fatalf("Test %d: invalid string: got %q - want %q", i, s, test.String)
+		}
+	}
+}
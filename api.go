@@ -0,0 +1,83 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import "strings"
+
+// API identifies an API operation of a KES server.
+// Its value is the operation's URL path without
+// any resource name - e.g. "/v1/key/create".
+type API string
+
+// All API operations of a KES server.
+const (
+	ServerVersion API = "/version"
+	ServerMetrics API = "/v1/metrics"
+	ServerStatus  API = "/v1/status"
+	ServerAPIs    API = "/v1/api"
+
+	KeyCreate   API = "/v1/key/create"
+	KeyImport   API = "/v1/key/import"
+	KeyDelete   API = "/v1/key/delete"
+	KeyGenerate API = "/v1/key/generate"
+	KeyEncrypt  API = "/v1/key/encrypt"
+	KeyDecrypt  API = "/v1/key/decrypt"
+	KeyReWrap   API = "/v1/key/rewrap"
+	KeyList     API = "/v1/key/list"
+	KeyDescribe API = "/v1/key/describe"
+
+	PolicyWrite  API = "/v1/policy/write"
+	PolicyRead   API = "/v1/policy/read"
+	PolicyList   API = "/v1/policy/list"
+	PolicyDelete API = "/v1/policy/delete"
+
+	IdentityAssign API = "/v1/identity/assign"
+	IdentityList   API = "/v1/identity/list"
+	IdentityForget API = "/v1/identity/forget"
+	IdentitySelf   API = "/v1/identity/self/describe"
+
+	AuditLogTrace API = "/v1/log/audit/trace"
+	ErrorLogTrace API = "/v1/log/error/trace"
+)
+
+func (a API) String() string { return string(a) }
+
+// resourceAPIs are all APIs that operate on a
+// resource - e.g. a key or policy. The resource
+// name is the remaining path after the API path.
+var resourceAPIs = []API{
+	KeyCreate,
+	KeyImport,
+	KeyDelete,
+	KeyGenerate,
+	KeyEncrypt,
+	KeyDecrypt,
+	KeyReWrap,
+	KeyList,
+	KeyDescribe,
+	PolicyWrite,
+	PolicyRead,
+	PolicyList,
+	PolicyDelete,
+	IdentityAssign,
+	IdentityList,
+	IdentityForget,
+}
+
+// parseAPI splits the URL path into its API and the
+// resource name, if any. It returns false if path
+// does not refer to any API.
+func parseAPI(path string) (API, string, bool) {
+	switch API(path) {
+	case ServerVersion, ServerMetrics, ServerStatus, ServerAPIs, IdentitySelf, AuditLogTrace, ErrorLogTrace:
+		return API(path), "", true
+	}
+	for _, api := range resourceAPIs {
+		if strings.HasPrefix(path, string(api)+"/") {
+			return api, strings.TrimPrefix(path, string(api)+"/"), true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,189 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EndpointStrategy selects the KES server endpoint that
+// a Client sends its next request to. It gets called with
+// all healthy endpoints and returns one of them.
+//
+// An EndpointStrategy may be called concurrently.
+type EndpointStrategy func(endpoints []string) string
+
+// RoundRobin returns an EndpointStrategy that selects
+// one endpoint after another.
+func RoundRobin() EndpointStrategy {
+	var n uint32
+	return func(endpoints []string) string {
+		i := atomic.AddUint32(&n, 1) - 1
+		return endpoints[i%uint32(len(endpoints))]
+	}
+}
+
+// RandomEndpoint returns an EndpointStrategy that
+// selects an endpoint at random.
+func RandomEndpoint() EndpointStrategy {
+	return func(endpoints []string) string {
+		return endpoints[rand.Intn(len(endpoints))]
+	}
+}
+
+// WithEndpoints makes the Client spread its requests across
+// all given KES server endpoints. It replaces the Client's
+// Endpoint. All endpoints must belong to KES servers that
+// share the same keys and policies - e.g. a KES cluster.
+//
+// If a request fails because the Client cannot connect to
+// an endpoint, the Client re-sends the request to the next
+// endpoint. An endpoint that fails repeatedly is considered
+// unhealthy and excluded for a while. Afterwards, it gets
+// selected again.
+//
+// By default, the endpoints are selected in a round-robin
+// fashion. The WithEndpointStrategy option changes this
+// behavior.
+func WithEndpoints(endpoints ...string) ClientOption {
+	return func(c *Client) {
+		if len(endpoints) > 0 {
+			c.Endpoint = endpoints[0]
+		}
+		if c.balancer == nil {
+			c.balancer = newLoadBalancer()
+		}
+		c.balancer.setEndpoints(endpoints)
+	}
+}
+
+// WithEndpointStrategy sets the EndpointStrategy that
+// selects the endpoint for the next request. It only
+// has an effect if the Client has multiple endpoints.
+// See: WithEndpoints.
+//
+// If strategy is nil, RoundRobin is used.
+func WithEndpointStrategy(strategy EndpointStrategy) ClientOption {
+	return func(c *Client) {
+		if c.balancer == nil {
+			c.balancer = newLoadBalancer()
+		}
+		if strategy != nil {
+			c.balancer.setStrategy(strategy)
+		}
+	}
+}
+
+// loadBalancer selects endpoints using an EndpointStrategy
+// and keeps track of their health.
+type loadBalancer struct {
+	lock      sync.Mutex
+	strategy  EndpointStrategy
+	endpoints []string
+	failures  map[string]int       // consecutive connection failures
+	excluded  map[string]time.Time // unhealthy endpoints and until when they are excluded
+}
+
+const (
+	// maxEndpointFailures is the number of consecutive connection
+	// failures after which an endpoint is considered unhealthy.
+	maxEndpointFailures = 3
+
+	// endpointCooldown is the duration for which an unhealthy
+	// endpoint is excluded.
+	endpointCooldown = 10 * time.Second
+)
+
+func newLoadBalancer() *loadBalancer {
+	return &loadBalancer{
+		strategy: RoundRobin(),
+		failures: map[string]int{},
+		excluded: map[string]time.Time{},
+	}
+}
+
+func (b *loadBalancer) setEndpoints(endpoints []string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.endpoints = append(b.endpoints[:0:0], endpoints...)
+	b.failures = map[string]int{}
+	b.excluded = map[string]time.Time{}
+}
+
+func (b *loadBalancer) setStrategy(strategy EndpointStrategy) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.strategy = strategy
+}
+
+// Len returns the number of endpoints.
+func (b *loadBalancer) Len() int {
+	if b == nil {
+		return 0
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return len(b.endpoints)
+}
+
+// Next returns the endpoint for the next request.
+// It only selects unhealthy endpoints if there
+// is no healthy one.
+func (b *loadBalancer) Next() string {
+	b.lock.Lock()
+	var (
+		now     = time.Now()
+		healthy = make([]string, 0, len(b.endpoints))
+	)
+	for _, endpoint := range b.endpoints {
+		if until, ok := b.excluded[endpoint]; ok {
+			if now.Before(until) {
+				continue
+			}
+			delete(b.excluded, endpoint) // Give the endpoint another chance
+		}
+		healthy = append(healthy, endpoint)
+	}
+	if len(healthy) == 0 {
+		healthy = append(healthy, b.endpoints...)
+	}
+	strategy := b.strategy
+	b.lock.Unlock()
+
+	return strategy(healthy)
+}
+
+// Report records whether a request to the endpoint
+// failed with a connection error. An endpoint gets
+// excluded once it fails too often in a row.
+func (b *loadBalancer) Report(endpoint string, err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if err == nil {
+		delete(b.failures, endpoint)
+		return
+	}
+	b.failures[endpoint]++
+	if b.failures[endpoint] >= maxEndpointFailures {
+		delete(b.failures, endpoint)
+		b.excluded[endpoint] = time.Now().Add(endpointCooldown)
+	}
+}
+
+// isDialError returns true if err indicates that
+// a connection could not be established. Then the
+// request has not been sent.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithEndpoints(t *testing.T) {
+	var requests [2]uint32
+	servers := make([]*httptest.Server, len(requests))
+	for i := range servers {
+		i := i
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddUint32(&requests[i], 1)
+		}))
+		defer servers[i].Close()
+	}
+
+	client := &Client{HTTPClient: *servers[0].Client()}
+	WithEndpoints(servers[0].URL, servers[1].URL)(client)
+	WithRetry(0, func(int) time.Duration { return time.Millisecond })(client)
+
+	const N = 10
+	for i := 0; i < N; i++ {
+		if _, err := client.CreateKeyIfNotExists(context.Background(), "my-key"); err != nil {
+			t.Fatalf("Request %d failed: %v", i, err)
+		}
+	}
+	for i := range requests {
+		if n := atomic.LoadUint32(&requests[i]); n != N/2 {
+			t.Fatalf("Endpoint %d: got %d requests - want %d", i, n, N/2)
+		}
+	}
+
+	// Once an endpoint is down, all requests - even the ones
+	// creating a key - should be sent to the other endpoint.
+	servers[1].Close()
+	for i := 0; i < N; i++ {
+		if _, err := client.CreateKeyIfNotExists(context.Background(), "my-key"); err != nil {
+			t.Fatalf("Request %d failed: %v", i, err)
+		}
+	}
+	if n := atomic.LoadUint32(&requests[0]); n != N/2+N {
+		t.Fatalf("Endpoint 0: got %d requests - want %d", n, N/2+N)
+	}
+	if until, ok := client.balancer.excluded[servers[1].URL]; !ok || until.Before(time.Now()) {
+		t.Fatal("Unavailable endpoint has not been excluded")
+	}
+}
+
+func TestWithEndpointStrategy(t *testing.T) {
+	var requests [2]uint32
+	servers := make([]*httptest.Server, len(requests))
+	for i := range servers {
+		i := i
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddUint32(&requests[i], 1)
+		}))
+		defer servers[i].Close()
+	}
+
+	client := &Client{HTTPClient: *servers[0].Client()}
+	WithEndpointStrategy(func(endpoints []string) string { return endpoints[len(endpoints)-1] })(client)
+	WithEndpoints(servers[0].URL, servers[1].URL)(client)
+
+	const N = 5
+	for i := 0; i < N; i++ {
+		if _, err := client.CreateKeyIfNotExists(context.Background(), "my-key"); err != nil {
+			t.Fatalf("Request %d failed: %v", i, err)
+		}
+	}
+	if n := atomic.LoadUint32(&requests[0]); n != 0 {
+		t.Fatalf("Endpoint 0: got %d requests - want %d", n, 0)
+	}
+	if n := atomic.LoadUint32(&requests[1]); n != N {
+		t.Fatalf("Endpoint 1: got %d requests - want %d", n, N)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// BroadcastPolicy defines how an AuditBroadcaster
+// handles subscribers that don't keep up with the
+// AuditEvents of the underlying AuditStream.
+type BroadcastPolicy int
+
+const (
+	// BroadcastBlock makes an AuditBroadcaster wait until
+	// every subscriber has received an AuditEvent. Hence,
+	// one slow subscriber slows down all subscribers.
+	BroadcastBlock BroadcastPolicy = iota
+
+	// BroadcastDrop makes an AuditBroadcaster drop an
+	// AuditEvent for a subscriber whose channel is full.
+	// Hence, a slow subscriber misses AuditEvents but
+	// does not affect other subscribers.
+	BroadcastDrop
+)
+
+// NewAuditBroadcaster returns a new AuditBroadcaster that
+// sends the AuditEvents of s to all its subscribers. Each
+// subscriber channel buffers up to capacity AuditEvents.
+// If capacity is less than 0, the channels are unbuffered.
+//
+// The AuditStream s must not be used directly anymore.
+func NewAuditBroadcaster(s *AuditStream, capacity int, policy BroadcastPolicy) *AuditBroadcaster {
+	if capacity < 0 {
+		capacity = 0
+	}
+	return &AuditBroadcaster{
+		stream:   s,
+		capacity: capacity,
+		policy:   policy,
+		done:     make(chan struct{}),
+	}
+}
+
+// AuditBroadcaster distributes the AuditEvents of one
+// AuditStream to multiple subscribers. For example, it
+// allows independent consumers to share one audit log
+// subscription.
+//
+// The AuditBroadcaster starts reading from the underlying
+// AuditStream once Subscribe is called for the first time.
+// A subscriber receives every AuditEvent from the point in
+// time it has subscribed - unless it does not keep up and
+// the BroadcastDrop policy is used.
+//
+// Once the underlying AuditStream stops or the broadcaster
+// gets closed, all subscriber channels get closed.
+type AuditBroadcaster struct {
+	dropped uint64 // number of dropped events - must be 64-bit aligned for atomic access
+
+	stream   *AuditStream
+	capacity int
+	policy   BroadcastPolicy
+
+	lock        sync.Mutex
+	subscribers []chan AuditEvent
+	started     bool
+	stopped     bool // true once all subscriber channels have been closed
+
+	done      chan struct{}
+	closeOnce sync.Once
+
+	err error // set by read before stopped is set
+}
+
+// Subscribe returns a new channel that receives all
+// subsequent AuditEvents. The channel gets closed once
+// the underlying AuditStream stops or the broadcaster
+// gets closed. Then, the Err method returns the error,
+// if any, that stopped the AuditStream.
+//
+// Subscribing to a stopped broadcaster returns a
+// closed channel.
+func (b *AuditBroadcaster) Subscribe() <-chan AuditEvent {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	ch := make(chan AuditEvent, b.capacity)
+	if b.stopped {
+		close(ch)
+		return ch
+	}
+	b.subscribers = append(b.subscribers, ch)
+	if !b.started {
+		b.started = true
+		go b.read()
+	}
+	return ch
+}
+
+// Dropped returns the number of AuditEvents that have
+// not been sent to a subscriber because its channel
+// has been full. It is always zero unless the
+// broadcaster uses the BroadcastDrop policy.
+func (b *AuditBroadcaster) Dropped() uint64 { return atomic.LoadUint64(&b.dropped) }
+
+// Err returns the error, if any, that stopped the underlying
+// AuditStream. It returns nil as long as subscriber channels
+// have not been closed.
+func (b *AuditBroadcaster) Err() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if !b.stopped {
+		return nil
+	}
+	return b.err
+}
+
+// Close closes the underlying AuditStream and all
+// subscriber channels. Subscribers may not receive
+// AuditEvents that have not been sent yet.
+func (b *AuditBroadcaster) Close() (err error) {
+	b.closeOnce.Do(func() {
+		close(b.done)
+		err = b.stream.Close()
+
+		// If no one has subscribed yet, there is
+		// no goroutine that would stop the broadcaster.
+		b.lock.Lock()
+		if !b.started {
+			b.stopped = true
+			b.err = ErrStreamClosed
+		}
+		b.lock.Unlock()
+	})
+	return err
+}
+
+// read sends all AuditEvents of the underlying
+// stream to the subscribers until the stream
+// stops or the broadcaster gets closed. Then,
+// it closes all subscriber channels.
+func (b *AuditBroadcaster) read() {
+	err := b.broadcast()
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.err, b.stopped = err, true
+	for _, ch := range b.subscribers {
+		close(ch)
+	}
+	b.subscribers = nil
+}
+
+// broadcast sends all AuditEvents of the underlying
+// stream to the subscribers. It returns once the stream
+// stops or the broadcaster gets closed.
+func (b *AuditBroadcaster) broadcast() error {
+	for b.stream.Next() {
+		event := b.stream.Event()
+
+		// Appending a subscriber does not modify the
+		// elements of the current slice. Hence, we can
+		// send without holding the lock.
+		b.lock.Lock()
+		subscribers := b.subscribers
+		b.lock.Unlock()
+
+		for _, ch := range subscribers {
+			switch b.policy {
+			case BroadcastDrop:
+				select {
+				case ch <- event:
+				case <-b.done:
+					return ErrStreamClosed
+				default:
+					atomic.AddUint64(&b.dropped, 1)
+				}
+			default:
+				select {
+				case ch <- event:
+				case <-b.done:
+					return ErrStreamClosed
+				}
+			}
+		}
+	}
+	return b.stream.Err()
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAuditBroadcaster(t *testing.T) {
+	var events strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&events, `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/key-%d"},"response":{"code":200}}`+"\n", i)
+	}
+
+	// With the blocking policy the broadcaster has to wait
+	// for both subscribers. Since it starts reading on the
+	// first Subscribe call, we pause the source until all
+	// subscribers are registered.
+	reader, writer := io.Pipe()
+	broadcaster := NewAuditBroadcaster(NewAuditStream(reader), 0, BroadcastBlock)
+	subscribers := []<-chan AuditEvent{broadcaster.Subscribe(), broadcaster.Subscribe()}
+	go func() {
+		io.WriteString(writer, events.String())
+		writer.Close()
+	}()
+
+	var wg sync.WaitGroup
+	counts := make([]int, len(subscribers))
+	for i, ch := range subscribers {
+		wg.Add(1)
+		go func(i int, ch <-chan AuditEvent) {
+			defer wg.Done()
+			for event := range ch {
+				if want := fmt.Sprintf("/v1/key/create/key-%d", counts[i]); event.Request.Path != want {
+					t.Errorf("Subscriber %d: got path %q - want %q", i, event.Request.Path, want)
+				}
+				counts[i]++
+			}
+		}(i, ch)
+	}
+	wg.Wait()
+
+	for i, n := range counts {
+		if n != 100 {
+			t.Fatalf("Subscriber %d: got %d events - want %d", i, n, 100)
+		}
+	}
+	if err := broadcaster.Err(); err != nil {
+		t.Fatalf("Broadcaster failed: %v", err)
+	}
+	if n := broadcaster.Dropped(); n != 0 {
+		t.Fatalf("Broadcaster dropped %d events", n)
+	}
+	if _, ok := <-broadcaster.Subscribe(); ok {
+		t.Fatal("Subscribing to a stopped broadcaster returned an open channel")
+	}
+}
+
+func TestAuditBroadcasterDrop(t *testing.T) {
+	var events strings.Builder
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&events, `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/key-%d"},"response":{"code":200}}`+"\n", i)
+	}
+
+	broadcaster := NewAuditBroadcaster(NewAuditStream(strings.NewReader(events.String())), 1, BroadcastDrop)
+	ch := broadcaster.Subscribe()
+
+	// The subscriber does not receive until the source has
+	// been drained. Hence, all but one event get dropped.
+	deadline := time.Now().Add(5 * time.Second)
+	for broadcaster.Dropped() < 9 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	var n int
+	for range ch {
+		n++
+	}
+	if n != 1 {
+		t.Fatalf("Got %d events - want %d", n, 1)
+	}
+	if dropped := broadcaster.Dropped(); dropped != 9 {
+		t.Fatalf("Got %d dropped events - want %d", dropped, 9)
+	}
+}
+
+func TestAuditBroadcasterClose(t *testing.T) {
+	reader, writer := io.Pipe()
+	defer writer.Close()
+
+	broadcaster := NewAuditBroadcaster(NewAuditStream(reader), 0, BroadcastBlock)
+	ch := broadcaster.Subscribe()
+	if err := broadcaster.Close(); err != nil {
+		t.Fatalf("Failed to close broadcaster: %v", err)
+	}
+	if _, ok := <-ch; ok {
+		t.Fatal("Subscriber channel has not been closed")
+	}
+	if err := broadcaster.Err(); err != ErrStreamClosed {
+		t.Fatalf("Invalid error: got %v - want %v", err, ErrStreamClosed)
+	}
+	if _, ok := <-broadcaster.Subscribe(); ok {
+		t.Fatal("Subscribing to a closed broadcaster returned an open channel")
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import (
+	"context"
+	"sync"
+)
+
+// NewBufferedAuditStream returns a new BufferedAuditStream
+// that reads up to capacity AuditEvents from s ahead of time.
+// If capacity is less than 1, it reads one AuditEvent ahead.
+//
+// The AuditStream s must not be used directly anymore.
+func NewBufferedAuditStream(s *AuditStream, capacity int) *BufferedAuditStream {
+	if capacity < 1 {
+		capacity = 1
+	}
+	b := &BufferedAuditStream{
+		stream: s,
+		events: make(chan AuditEvent, capacity),
+		done:   make(chan struct{}),
+	}
+	go b.read()
+	return b
+}
+
+// BufferedAuditStream is an AuditStream that reads
+// AuditEvents from an underlying AuditStream in the
+// background and buffers them until they get consumed
+// via its Next method.
+//
+// The buffer has a fixed capacity. Once it is full,
+// the BufferedAuditStream stops reading from the
+// underlying AuditStream until an AuditEvent gets
+// consumed. Hence, a slow consumer does not cause
+// unbounded memory usage.
+type BufferedAuditStream struct {
+	stream *AuditStream
+	events chan AuditEvent
+
+	done      chan struct{}
+	closeOnce sync.Once
+
+	readErr error // set by read before closing events
+
+	event AuditEvent
+	err   error
+}
+
+// read forwards all AuditEvents of the underlying
+// stream to the buffer until the stream stops or
+// the BufferedAuditStream gets closed.
+func (b *BufferedAuditStream) read() {
+	defer close(b.events)
+
+	for b.stream.Next() {
+		select {
+		case b.events <- b.stream.Event():
+		case <-b.done:
+			return
+		}
+	}
+	b.readErr = b.stream.Err()
+}
+
+// Err returns the first non-EOF error that was encountered
+// by the BufferedAuditStream or its underlying AuditStream.
+func (b *BufferedAuditStream) Err() error { return b.err }
+
+// Event returns the most recent AuditEvent
+// generated by a call to Next.
+func (b *BufferedAuditStream) Event() AuditEvent { return b.event }
+
+// Next advances the stream to the next AuditEvent, which
+// will then be available through the Event method. It
+// blocks until the next AuditEvent has been read from
+// the underlying AuditStream.
+//
+// It returns false when the stream stops, either by
+// reaching the end of the underlying AuditStream, closing
+// the stream or in case of an error. Then, the Err method
+// returns any error that occurred.
+func (b *BufferedAuditStream) Next() bool { return b.NextContext(context.Background()) }
+
+// NextContext behaves like Next but stops once
+// the ctx.Done() channel completes. Then, the
+// Err method returns ctx.Err().
+func (b *BufferedAuditStream) NextContext(ctx context.Context) bool {
+	if b.err != nil {
+		return false
+	}
+
+	select {
+	case <-b.done:
+		b.err = ErrStreamClosed
+		return false
+	default:
+	}
+
+	select {
+	case event, ok := <-b.events:
+		if !ok {
+			b.err = b.readErr
+			return false
+		}
+		b.event = event
+		return true
+	case <-b.done:
+		b.err = ErrStreamClosed
+		return false
+	case <-ctx.Done():
+		b.err = ctx.Err()
+		return false
+	}
+}
+
+// Close closes the underlying AuditStream and discards
+// any buffered AuditEvents. After closing the stream,
+// Next will always return false.
+func (b *BufferedAuditStream) Close() (err error) {
+	b.closeOnce.Do(func() {
+		close(b.done)
+		err = b.stream.Close()
+	})
+	return err
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBufferedAuditStream(t *testing.T) {
+	const N = 10
+	var events strings.Builder
+	for i := 0; i < N; i++ {
+		fmt.Fprintf(&events, `{"request":{"path":"/v1/key/create/%d"}}`+"\n", i)
+	}
+
+	var read uint32 // number of events read from the underlying stream
+	stream := NewAuditStream(ioutil.NopCloser(strings.NewReader(events.String()))).FilterFunc(func(AuditEvent) bool {
+		atomic.AddUint32(&read, 1)
+		return true
+	})
+
+	const Capacity = 3
+	buffer := NewBufferedAuditStream(stream, Capacity)
+
+	// The buffer holds up to Capacity events and the background reader
+	// blocks while sending one more event. So, it must not read more
+	// than Capacity + 1 events until any event gets consumed.
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadUint32(&read) < Capacity+1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Buffer did not read ahead: got %d events - want %d", atomic.LoadUint32(&read), Capacity+1)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := atomic.LoadUint32(&read); n != Capacity+1 {
+		t.Fatalf("Buffer read too far ahead: got %d events - want %d", n, Capacity+1)
+	}
+
+	for i := 0; i < N; i++ {
+		if !buffer.Next() {
+			t.Fatalf("Failed to read event %d: %v", i, buffer.Err())
+		}
+		if path := buffer.Event().Request.Path; path != fmt.Sprintf("/v1/key/create/%d", i) {
+			t.Fatalf("Invalid event %d: got path '%s'", i, path)
+		}
+	}
+	if buffer.Next() {
+		t.Fatal("Next returned true after reaching the end of the stream")
+	}
+	if err := buffer.Err(); err != nil {
+		t.Fatalf("Failed to iterate over stream: %v", err)
+	}
+
+	buffer = NewBufferedAuditStream(NewAuditStream(ioutil.NopCloser(strings.NewReader(events.String()))), Capacity)
+	if err := buffer.Close(); err != nil {
+		t.Fatalf("Failed to close stream: %v", err)
+	}
+	if buffer.Next() {
+		t.Fatal("Next returned true after stream has been closed")
+	}
+	if err := buffer.Err(); err != ErrStreamClosed {
+		t.Fatalf("Invalid error: got %v - want %v", err, ErrStreamClosed)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding"
 	"encoding/base64"
 	"encoding/json"
@@ -17,7 +18,11 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	dto "github.com/prometheus/client_model/go"
@@ -51,6 +56,13 @@ import (
 // A custom transport protocol can be used via a
 // custom implemention of the http.RoundTripper
 // interface.
+//
+// A Client is safe for concurrent use by multiple
+// goroutines. Its fields and options must be set
+// before it is used and must not be modified while
+// it is used concurrently. A Client, and all
+// EnclaveClients derived from it, share the same
+// HTTP connections and endpoint health state.
 type Client struct {
 	// Endpoint is the KES server HTTPS endpoint.
 	// For example: https://127.0.0.1:7373
@@ -63,6 +75,263 @@ type Client struct {
 	//
 	// It must not be modified concurrently.
 	HTTPClient http.Client
+
+	maxAttempts int           // see WithRetry
+	backoff     BackoffFunc   // see WithRetry
+	balancer    *loadBalancer // see WithEndpoints
+	enclave     string        // see Enclave
+	timeout     time.Duration // see WithRequestTimeout
+	hook        RequestHook   // see WithRequestHook
+	userAgent   string        // see WithUserAgent
+	transport   *atomic.Value // see SetRootCAs. Holds an *http.Transport
+}
+
+// ClientOption is a functional option that customizes
+// a Client returned by NewClient or NewClientWithConfig.
+type ClientOption func(*Client)
+
+// WithRetry sets how often the Client sends an idempotent
+// request, e.g. to list or decrypt keys, at most before it
+// gives up, and how long it waits before re-sending it.
+//
+// The Client retries requests that fail due to a temporary
+// network error or because the server is unavailable - for
+// example while it restarts - or overloaded. It never retries
+// requests that create a key.
+//
+// If the server responds with a Retry-After header, the Client
+// waits as long as requested instead. However, it gives up
+// immediately if the request context expires before.
+//
+// If maxAttempts <= 0, a request is sent at most 3 times.
+// If backoff is nil, the Client waits a random delay between
+// 200ms and 1s. The ExponentialBackoff function returns a
+// BackoffFunc with an exponentially increasing delay.
+func WithRetry(maxAttempts int, backoff BackoffFunc) ClientOption {
+	return func(c *Client) {
+		c.maxAttempts = maxAttempts
+		c.backoff = backoff
+	}
+}
+
+// WithHTTPClient makes the Client use the given http.Client
+// to send requests - for example, to route requests through
+// a proxy or to use custom connection pooling.
+//
+// The Client still applies its TLS configuration, e.g. the
+// client certificate passed to NewClient, on top. Therefore,
+// if the http.Client transport is an *http.Transport, or nil,
+// the Client uses a copy of that transport whose TLS client
+// config is replaced with the Client's TLS config. The given
+// http.Client and its transport are not modified.
+//
+// Any other http.RoundTripper is used as it is. Then, it is
+// responsible for establishing TLS connections and presenting
+// the client certificate.
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(c *Client) {
+		var config *tls.Config
+		if transport, ok := c.HTTPClient.Transport.(*http.Transport); ok {
+			config = transport.TLSClientConfig
+		}
+
+		c.HTTPClient = *client
+		if config == nil {
+			return
+		}
+
+		transport := client.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		if t, ok := transport.(*http.Transport); ok {
+			t = t.Clone()
+			t.TLSClientConfig = config
+			c.HTTPClient.Transport = t
+		}
+	}
+}
+
+// WithRequestTimeout limits how long the Client waits for
+// a single request to complete - independent of any context
+// passed by the caller. The timeout applies to each attempt,
+// including reading the response body. Hence, a request may
+// still be retried once an attempt timed out.
+//
+// The timeout does not apply to audit and error log streams.
+// If d <= 0, requests are only limited by their context.
+func WithRequestTimeout(d time.Duration) ClientOption {
+	return func(c *Client) { c.timeout = d }
+}
+
+// WithMaxIdleConnsPerHost sets how many idle connections
+// the Client keeps open per KES server endpoint for reuse.
+// Raising it helps clients that send many concurrent
+// requests over HTTP/1.1 to avoid opening new connections.
+//
+// A Client created by NewClient or NewClientWithConfig
+// negotiates HTTP/2 with the server. Then, concurrent
+// requests are multiplexed over a single connection and
+// a new connection is only opened once the server's
+// limit of concurrent streams has been reached.
+//
+// The option only has an effect if the Client's transport
+// is an *http.Transport. Then, the Client uses a modified
+// copy of the transport. If n <= 0, the http.Transport
+// default is used.
+func WithMaxIdleConnsPerHost(n int) ClientOption {
+	return func(c *Client) {
+		modifyTransport(c, func(t *http.Transport) { t.MaxIdleConnsPerHost = n })
+	}
+}
+
+// WithMaxConnsPerHost limits the number of connections
+// the Client opens per KES server endpoint - including
+// connections that are in use. Once the limit has been
+// reached, requests wait for a connection to become
+// available. With HTTP/2, each connection carries many
+// concurrent requests. See: WithMaxIdleConnsPerHost.
+//
+// The option only has an effect if the Client's transport
+// is an *http.Transport. Then, the Client uses a modified
+// copy of the transport. If n <= 0, there is no limit.
+func WithMaxConnsPerHost(n int) ClientOption {
+	return func(c *Client) {
+		modifyTransport(c, func(t *http.Transport) { t.MaxConnsPerHost = n })
+	}
+}
+
+// WithUserAgent makes the Client send the given User-Agent
+// header with every request - for example, to identify the
+// client application within the server's audit log.
+//
+// By default, or if userAgent is empty, the Client sends
+// "kes-go/<version>" where <version> is the version of the
+// kes package, if known.
+//
+// The User-Agent must be a valid HTTP header value. In
+// particular, it must not contain any control characters,
+// like a newline. Otherwise, all requests fail.
+func WithUserAgent(userAgent string) ClientOption {
+	return func(c *Client) { c.userAgent = userAgent }
+}
+
+// defaultUserAgent is the User-Agent sent by a Client
+// if no User-Agent has been set via WithUserAgent.
+var defaultUserAgent = "kes-go/" + moduleVersion()
+
+// moduleVersion returns the version of this module
+// as recorded in the build info of the running binary.
+// It returns "devel" if the version is not known - e.g.
+// for tests or binaries built within the module.
+func moduleVersion() string {
+	const Module = "github.com/minio/kes"
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+	module := &info.Main
+	for _, dep := range info.Deps {
+		if dep.Path == Module {
+			module = dep
+			break
+		}
+	}
+	if module.Replace != nil {
+		module = module.Replace
+	}
+	if module.Path != Module || module.Version == "" || module.Version == "(devel)" {
+		return "devel"
+	}
+	return module.Version
+}
+
+// SetRootCAs replaces the set of root certificate authorities
+// the Client uses to verify the KES server certificate - e.g.
+// when the server CA rotates. It can be called while the Client
+// is used concurrently.
+//
+// SetRootCAs does not modify the Client's transport. Instead, all
+// subsequent requests use a copy of the transport with the new
+// root CAs and therefore establish new connections. Requests that
+// are in flight complete on their existing connections. Idle
+// connections of a transport replaced by a previous SetRootCAs
+// call get closed. If pool is nil, the host's root CA set is used.
+//
+// SetRootCAs only has an effect if the Client has been created by
+// NewClient or NewClientWithConfig and its transport is an
+// *http.Transport. It applies to all EnclaveClients derived from
+// the Client as well.
+func (c *Client) SetRootCAs(pool *x509.CertPool) {
+	if c.transport == nil {
+		return
+	}
+	transport := c.HTTPClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	t, ok := transport.(*http.Transport)
+	if !ok {
+		return
+	}
+
+	t = t.Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	t.TLSClientConfig.RootCAs = pool
+
+	old, _ := c.transport.Load().(*http.Transport)
+	c.transport.Store(t)
+	if old != nil {
+		old.CloseIdleConnections()
+	}
+}
+
+// modifyTransport replaces the Client's transport with a
+// copy modified by f, if the transport is an *http.Transport.
+// It does not modify the original transport since it may be
+// shared with other clients. A nil transport is treated as
+// http.DefaultTransport.
+func modifyTransport(c *Client, f func(*http.Transport)) {
+	transport := c.HTTPClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if t, ok := transport.(*http.Transport); ok {
+		t = t.Clone()
+		f(t)
+		c.HTTPClient.Transport = t
+	}
+}
+
+// RequestInfo describes a request sent by a Client.
+type RequestInfo struct {
+	Method     string        // The HTTP method, e.g. GET
+	Path       string        // The URL path, e.g. /v1/key/create/my-key
+	StatusCode int           // The response status code. 0 if no response has been received
+	Duration   time.Duration // How long the request took, including all retries
+	Err        error         // The error, if any, returned by the HTTP client
+}
+
+// RequestHook is a function that gets called by
+// a Client once a request has completed.
+type RequestHook func(ctx context.Context, info RequestInfo)
+
+// WithRequestHook makes the Client call hook after each
+// request - for example, to record request latencies or
+// emit traces. The hook is called once per request, after
+// the last retry, with the request context.
+//
+// For audit and error log streams, the hook is called
+// once the server has responded, not once the stream
+// is closed.
+//
+// The hook is called synchronously and must not block.
+// A panic within the hook is recovered and ignored.
+func WithRequestHook(hook RequestHook) ClientOption {
+	return func(c *Client) { c.hook = hook }
 }
 
 // NewClient returns a new KES client with the given
@@ -72,11 +341,12 @@ type Client struct {
 // The TLS certificate must be valid for client authentication.
 //
 // NewClient uses an http.Transport with reasonable defaults.
-func NewClient(endpoint string, cert tls.Certificate) *Client {
+// The Client can be customized via ClientOptions.
+func NewClient(endpoint string, cert tls.Certificate, options ...ClientOption) *Client {
 	return NewClientWithConfig(endpoint, &tls.Config{
 		MinVersion:   tls.VersionTLS13,
 		Certificates: []tls.Certificate{cert},
-	})
+	}, options...)
 }
 
 // NewClientWithConfig returns a new KES client with the
@@ -87,9 +357,9 @@ func NewClient(endpoint string, cert tls.Certificate) *Client {
 // certificate that is valid for client authentication.
 //
 // NewClientWithConfig uses an http.Transport with reasonable
-// defaults.
-func NewClientWithConfig(endpoint string, config *tls.Config) *Client {
-	return &Client{
+// defaults. The Client can be customized via ClientOptions.
+func NewClientWithConfig(endpoint string, config *tls.Config, options ...ClientOption) *Client {
+	client := &Client{
 		Endpoint: endpoint,
 		HTTPClient: http.Client{
 			Transport: &http.Transport{
@@ -107,7 +377,12 @@ func NewClientWithConfig(endpoint string, config *tls.Config) *Client {
 				TLSClientConfig:       config,
 			},
 		},
+		transport: new(atomic.Value),
+	}
+	for _, option := range options {
+		option(client)
 	}
+	return client
 }
 
 // DEK is a data encryption key. It has a plaintext
@@ -141,6 +416,31 @@ var (
 	_ encoding.TextUnmarshaler   = (*DEK)(nil)
 )
 
+// Wipe overwrites the DEK's plaintext with zeros and
+// sets it to nil. It does not modify the ciphertext.
+//
+// See: Wipe
+func (d *DEK) Wipe() {
+	Wipe(d.Plaintext)
+	d.Plaintext = nil
+}
+
+// Wipe overwrites b with zeros. It should be used to
+// remove sensitive data, like plaintext key material,
+// from memory once it is not needed anymore.
+//
+// Wipe is a best-effort mechanism. It only zeros the
+// memory referenced by b. It cannot zero any copies of
+// b - e.g. made by the application, when decoding a
+// server response or by the Go runtime when moving or
+// growing memory. In particular, Go provides no way to
+// guarantee that no other copy of b exists in memory.
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
 // MarshalText encodes the DEK's ciphertext into
 // a base64-encoded text and returns the result.
 //
@@ -210,9 +510,14 @@ func (d *DEK) UnmarshalBinary(data []byte) error {
 // Particularly, if a key is created or deleted at the KES a
 // KeyIterator may or may not be affected by this change.
 type KeyIterator struct {
+	connect  func() (*http.Response, error) // nil once connected
 	response *http.Response
 	decoder  *json.Decoder
 
+	page     []KeyDescription // keys decoded ahead of time
+	pageSize int
+	eof      bool
+
 	last   KeyDescription
 	err    error
 	closed bool
@@ -234,17 +539,50 @@ func (i *KeyIterator) Next() bool {
 	if i.closed || i.err != nil {
 		return false
 	}
-	if err := i.decoder.Decode(&i.last); err != nil {
-		if err == io.EOF {
-			i.err = i.Close()
-		} else {
+	if i.connect != nil {
+		resp, err := i.connect()
+		if err != nil {
 			i.err = err
+			return false
+		}
+		i.connect = nil
+		i.response, i.decoder = resp, json.NewDecoder(resp.Body)
+	}
+
+	if len(i.page) == 0 {
+		if i.eof {
+			i.err = i.Close()
+			return false
+		}
+		pageSize := i.pageSize
+		if pageSize <= 0 {
+			pageSize = 1
+		}
+		for len(i.page) < pageSize {
+			var key KeyDescription
+			if err := i.decoder.Decode(&key); err != nil {
+				if err != io.EOF {
+					i.err = err
+					return false
+				}
+				i.eof = true
+				break
+			}
+			i.page = append(i.page, key)
+		}
+		if len(i.page) == 0 {
+			i.err = i.Close()
+			return false
 		}
-		return false
 	}
+	i.last, i.page = i.page[0], i.page[1:]
 	return true
 }
 
+// Name returns the name of the current key. It is
+// equivalent to Value().Name.
+func (i *KeyIterator) Name() string { return i.last.Name }
+
 // Value returns the current KeyDescription. It returns
 // the same KeyDescription until Next is called again.
 //
@@ -261,6 +599,9 @@ func (i *KeyIterator) Err() error { return i.err }
 // and returns any encountered error, if any.
 func (i *KeyIterator) Close() error {
 	i.closed = true
+	if i.response == nil { // Not connected yet
+		return nil
+	}
 	if err := i.response.Body.Close(); err != nil {
 		return err
 	}
@@ -273,7 +614,7 @@ func (i *KeyIterator) Close() error {
 // Version tries to fetch the version information from the
 // KES server.
 func (c *Client) Version() (string, error) {
-	client := retry(c.HTTPClient)
+	client := c.retryClient()
 	resp, err := client.Get(endpoint(c.Endpoint, "/version"))
 	if err != nil {
 		return "", err
@@ -293,193 +634,212 @@ func (c *Client) Version() (string, error) {
 	return response.Version, nil
 }
 
-// CreateKey tries to create a new cryptographic key with
-// the specified name.
-//
-// The key will be generated by the server. The client
-// application does not have the cryptographic key at
-// any point in time.
-func (c *Client) CreateKey(name string) error {
-	client := retry(c.HTTPClient)
-	resp, err := client.Post(endpoint(c.Endpoint, "/v1/key/create", url.PathEscape(name)), "application/json", nil)
-	if err != nil {
-		return err
-	}
-	if resp.StatusCode != http.StatusOK {
-		return parseErrorResponse(resp)
-	}
-	return nil
-}
-
-// ImportKey tries to import the given key as cryptographic
-// key with the specified name.
+// ServerTime returns the current time of the KES server
+// and its estimated clock skew relative to the local clock.
+// A positive skew means that the server clock is ahead of
+// the local clock.
 //
-// In contrast to CreateKey, the client specifies, and
-// therefore, knows the value of the cryptographic key.
-func (c *Client) ImportKey(name string, key []byte) error {
-	type Request struct {
-		Bytes []byte `json:"bytes"`
-	}
-	body, err := json.Marshal(Request{
-		Bytes: key,
-	})
+// ServerTime derives the server time from the Date header
+// of a single, non-retried request. It assumes that the
+// server has created its response after half the round-trip
+// time. Since the Date header has a resolution of one
+// second, the server time and skew are only accurate to
+// about half a second.
+func (c *Client) ServerTime(ctx context.Context) (time.Time, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint(c.Endpoint, "/version"), nil)
 	if err != nil {
-		return err
+		return time.Time{}, 0, err
 	}
+	client := c.retryClient()
+	client.MaxAttempts = 1
 
-	client := retry(c.HTTPClient)
-	url := endpoint(c.Endpoint, "/v1/key/import", url.PathEscape(name))
-	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	start := time.Now()
+	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return time.Time{}, 0, err
 	}
+	end := time.Now()
 	if resp.StatusCode != http.StatusOK {
-		return parseErrorResponse(resp)
+		return time.Time{}, 0, parseErrorResponse(resp)
 	}
-	return nil
-}
+	resp.Body.Close()
 
-// DeleteKey deletes the given key. Once a key has been deleted
-// all data, that has been encrypted with it, cannot be decrypted
-// anymore.
-func (c *Client) DeleteKey(name string) error {
-	url := endpoint(c.Endpoint, "/v1/key/delete", url.PathEscape(name))
-	req, err := http.NewRequest(http.MethodDelete, url, retryBody(nil))
-	if err != nil {
-		return err
-	}
-	client := retry(c.HTTPClient)
-	resp, err := client.Do(req)
+	date, err := http.ParseTime(resp.Header.Get("Date"))
 	if err != nil {
-		return err
-	}
-	if resp.StatusCode != http.StatusOK {
-		return parseErrorResponse(resp)
+		return time.Time{}, 0, errors.New("kes: server response contains no valid Date header")
 	}
-	return nil
+
+	// The Date header is truncated to seconds. On average,
+	// the server time is half a second later.
+	serverTime := date.Add(500 * time.Millisecond)
+	localTime := start.Add(end.Sub(start) / 2)
+	return serverTime, serverTime.Sub(localTime), nil
 }
 
-// GenerateKey generates a new data encryption key (DEK).
-// The context is cryptographically bound to the DEK.
-//
-// A DEK has a plaintext and a ciphertext representation.
-// The plaintext should be used to perform a cryptographic
-// operation - for example: encrypt some data.
-//
-// The ciphertext is the result of encrypting the plaintext
-// with the given key. It should be stored at a durable location
-// but does not need to stay secret. The ciphertext can only
-// be decrypted with the given key at the server.
-//
-// Whenever an application needs the DEK's plaintext representation
-// it should send the ciphertext to the server via the Decrypt method.
-//
-// The context is cryptographically bound to the ciphertext and
-// the same context value must be provided whenever the
-// ciphertext should be decrypted. An application either must
-// remember the context or must be able to re-generate it.
+// State is a KES server status snapshot.
+type State struct {
+	Version string        // The KES server version
+	UpTime  time.Duration // The time the KES server has been running
+	Healthy bool          // Indicates whether the KES server is healthy and serves requests
+}
+
+// Status returns the current state of the KES server.
 //
-// If an application does not wish to specify a context
-// value it can set it to nil.
-func (c *Client) GenerateKey(name string, context []byte) (DEK, error) {
-	type Request struct {
-		Context []byte `json:"context,omitempty"` // A context is optional
-	}
-	body, err := json.Marshal(Request{
-		Context: context,
-	})
+// It returns a ConnError if the server cannot be
+// reached. Then the server may be down or there may
+// be a network issue. In contrast, if the server
+// rejects the request, Status returns an Error -
+// e.g. ErrNotAllowed.
+func (c *Client) Status(ctx context.Context) (*State, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint(c.Endpoint, "/v1/status"), nil)
 	if err != nil {
-		return DEK{}, err
+		return nil, err
 	}
-
-	client := retry(c.HTTPClient)
-	url := endpoint(c.Endpoint, "/v1/key/generate", url.PathEscape(name))
-	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	resp, err := c.retryClient().Do(req)
 	if err != nil {
-		return DEK{}, err
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, ConnError{Endpoint: c.Endpoint, Err: err}
 	}
 	if resp.StatusCode != http.StatusOK {
-		return DEK{}, parseErrorResponse(resp)
+		return nil, parseUnexpectedResponse(resp)
 	}
 	defer resp.Body.Close()
 
 	type Response struct {
-		Plaintext  []byte `json:"plaintext"`
-		Ciphertext []byte `json:"ciphertext"`
+		Version string        `json:"version"`
+		UpTime  time.Duration `json:"uptime"`
 	}
 	const limit = 1 << 20
 	var response Response
 	if err = json.NewDecoder(io.LimitReader(resp.Body, limit)).Decode(&response); err != nil {
-		return DEK{}, err
+		return nil, err
 	}
-	return DEK(response), nil
+	return &State{
+		Version: response.Version,
+		UpTime:  response.UpTime,
+		Healthy: true,
+	}, nil
 }
 
-// Encrypt encrypts and authenticates the given plaintext
-// with the specified key and returns the corresponding
-// ciphertext on success.
+// Ping checks whether the KES server is reachable and
+// healthy. It returns nil if the server responds with
+// 200 OK.
 //
-// An optional context value gets authenticated but is not
-// encrypted. Therefore, the same context value must be provided
-// for decryption. Clients should remember or be able to
-// re-generate the context value.
-func (c *Client) Encrypt(name string, plaintext, context []byte) ([]byte, error) {
-	type Request struct {
-		Plaintext []byte `json:"plaintext"`
-		Context   []byte `json:"context,omitempty"` // A context is optional
-	}
-	body, err := json.Marshal(Request{
-		Plaintext: plaintext,
-		Context:   context,
-	})
+// Ping sends a single HEAD request without retrying it.
+// Therefore, it is cheap enough to be called periodically
+// and detects an unreachable server quickly. Like Status,
+// it returns a ConnError if the server cannot be reached.
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, endpoint(c.Endpoint, "/v1/status"), nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	client := c.retryClient()
+	client.MaxAttempts = 1
 
-	client := retry(c.HTTPClient)
-	url := endpoint(c.Endpoint, "/v1/key/encrypt", url.PathEscape(name))
-	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return ConnError{Endpoint: c.Endpoint, Err: err}
 	}
+	resp.Body.Close()
+
 	if resp.StatusCode != http.StatusOK {
-		return nil, parseErrorResponse(resp)
+		// The response to a HEAD request has no body.
+		// Hence, we cannot parse the error message.
+		return NewError(resp.StatusCode, http.StatusText(resp.StatusCode))
 	}
-	defer resp.Body.Close()
+	return nil
+}
 
-	type Response struct {
-		Ciphertext []byte `json:"ciphertext"`
+// WaitReady blocks until the KES server is reachable and
+// healthy or the ctx.Done() channel completes. It pings the
+// server every interval. If interval <= 0, it pings the
+// server every 500ms.
+//
+// If ctx.Done() completes before the server becomes ready,
+// WaitReady returns the error of the last ping - e.g. a
+// ConnError. If the server has not been pinged at all,
+// it returns ctx.Err().
+func (c *Client) WaitReady(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = 500 * time.Millisecond
 	}
-	const limit = 1 << 20
-	var response Response
-	if err = json.NewDecoder(io.LimitReader(resp.Body, limit)).Decode(&response); err != nil {
-		return nil, err
+
+	var (
+		timer   *time.Timer
+		lastErr error
+	)
+	for {
+		err := c.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			// The last ping has been interrupted. Its error
+			// is just ctx.Err() and not useful to the caller.
+			if lastErr == nil {
+				lastErr = ctx.Err()
+			}
+			return lastErr
+		}
+		lastErr = err
+
+		if timer == nil {
+			timer = time.NewTimer(interval)
+			defer timer.Stop()
+		} else {
+			timer.Reset(interval)
+		}
+		select {
+		case <-ctx.Done():
+			return lastErr
+		case <-timer.C:
+		}
 	}
-	return response.Ciphertext, nil
 }
 
-// Decrypt tries to decrypt the given ciphertext with the
-// specified key and returns plaintext on success.
-//
-// The context value must match the context used when
-// the ciphertext was produced. If no context was used
-// the context value should be set to nil.
-func (c *Client) Decrypt(name string, ciphertext, context []byte) ([]byte, error) {
-	type Request struct {
-		Ciphertext []byte `json:"ciphertext"`
-		Context    []byte `json:"context,omitempty"` // A context is optional
+// APIDescriptor describes an API endpoint of a KES server.
+type APIDescriptor struct {
+	Method  string        // The HTTP method, e.g. POST
+	Path    string        // The API path, e.g. /v1/key/create
+	MaxBody int64         // The max. request body size in bytes
+	Timeout time.Duration // The server-side request timeout. 0 if there is none
+}
+
+// APIList is a list of APIs supported by a KES server.
+type APIList []APIDescriptor
+
+// Supports returns true if the list contains an API
+// with the given path - e.g. "/v1/key/create" or
+// KeyCreate.String().
+func (l APIList) Supports(name string) bool {
+	name = strings.TrimSuffix(name, "/")
+	for _, api := range l {
+		if api.Path == name {
+			return true
+		}
 	}
-	body, err := json.Marshal(Request{
-		Ciphertext: ciphertext,
-		Context:    context,
-	})
+	return false
+}
+
+// APIs returns the list of APIs supported by the KES
+// server. Clients can use it to detect whether a server
+// supports an API before calling it.
+//
+// Servers that do not support listing their APIs respond
+// with 404 Not Found. Then, APIs returns an Error with
+// http.StatusNotFound as status code.
+func (c *Client) APIs(ctx context.Context) (APIList, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint(c.Endpoint, "/v1/api"), nil)
 	if err != nil {
 		return nil, err
 	}
-
-	client := retry(c.HTTPClient)
-	url := endpoint(c.Endpoint, "/v1/key/decrypt", url.PathEscape(name))
-	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	resp, err := c.retryClient().Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -489,19 +849,886 @@ func (c *Client) Decrypt(name string, ciphertext, context []byte) ([]byte, error
 	defer resp.Body.Close()
 
 	type Response struct {
-		Plaintext []byte `json:"plaintext"`
+		Method  string `json:"method"`
+		Path    string `json:"path"`
+		MaxBody int64  `json:"max_body"`
+		Timeout int64  `json:"timeout"` // in seconds
 	}
 	const limit = 1 << 20
-	var response Response
-	if err = json.NewDecoder(io.LimitReader(resp.Body, limit)).Decode(&response); err != nil {
+	var responses []Response
+	if err = json.NewDecoder(io.LimitReader(resp.Body, limit)).Decode(&responses); err != nil {
 		return nil, err
 	}
-	return response.Plaintext, nil
+	apis := make(APIList, 0, len(responses))
+	for _, response := range responses {
+		apis = append(apis, APIDescriptor{
+			Method:  response.Method,
+			Path:    response.Path,
+			MaxBody: response.MaxBody,
+			Timeout: time.Duration(response.Timeout) * time.Second,
+		})
+	}
+	return apis, nil
 }
 
-// ListKeys returns a new KeyIterator that iterates over all keys
-// matching the given glob pattern.
-//
+// CreateKey tries to create a new cryptographic key with
+// the specified name.
+//
+// The key will be generated by the server. The client
+// application does not have the cryptographic key at
+// any point in time.
+func (c *Client) CreateKey(name string) error {
+	client := c.retryClient()
+	resp, err := client.Post(endpoint(c.Endpoint, "/v1/key/create", url.PathEscape(name)), "application/json", nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return parseErrorResponse(resp)
+	}
+	return nil
+}
+
+// CreateKeyIfNotExists tries to create a new master key with
+// the specified name. In contrast to CreateKey, it does not
+// return ErrKeyExists if a master key with the same name
+// already exists.
+//
+// It returns true if it has created the master key and false
+// if the master key already exists.
+func (c *Client) CreateKeyIfNotExists(ctx context.Context, name string) (bool, error) {
+	if err := c.createKey(ctx, name); err != nil {
+		if errors.As(err, &KeyExistsError{}) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// CreateKeyWithAlgorithm tries to create a new cryptographic
+// key with the specified name that uses the given algorithm.
+//
+// It returns ErrKeyExists if a key with the same name already
+// exists. Servers that do not support choosing an algorithm
+// create the key with their default algorithm. Use DescribeKey
+// to check which algorithm the key actually uses.
+func (c *Client) CreateKeyWithAlgorithm(ctx context.Context, name string, algorithm Algorithm) error {
+	if algorithm == AlgorithmUnknown {
+		return errors.New("kes: unknown key algorithm")
+	}
+	type Request struct {
+		Algorithm string `json:"algorithm"`
+	}
+	body, err := json.Marshal(Request{
+		Algorithm: algorithm.String(),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint(c.Endpoint, "/v1/key/create", url.PathEscape(name)), retryBody(bytes.NewReader(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := c.retryClient()
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return parseErrorResponse(resp)
+	}
+	return resp.Body.Close()
+}
+
+// ResultStatus describes whether a single item of a
+// bulk operation, like CreateKeys or DecryptAll, has
+// been processed.
+type ResultStatus int
+
+// All states of a bulk operation item.
+const (
+	ResultNotAttempted ResultStatus = iota // The item has not been processed, e.g. because the operation has been canceled
+	ResultCompleted                        // The item has been processed successfully
+	ResultFailed                           // The item has been processed but failed
+)
+
+// String returns the string representation
+// of the ResultStatus.
+func (s ResultStatus) String() string {
+	switch s {
+	case ResultNotAttempted:
+		return "not attempted"
+	case ResultCompleted:
+		return "completed"
+	case ResultFailed:
+		return "failed"
+	default:
+		return "ResultStatus(" + strconv.Itoa(int(s)) + ")"
+	}
+}
+
+// resultStatus returns the ResultStatus of a bulk
+// operation item that has been processed.
+func resultStatus(err error) ResultStatus {
+	if err != nil {
+		return ResultFailed
+	}
+	return ResultCompleted
+}
+
+// KeyResult is the result of a bulk key operation,
+// like CreateKeys, for a single key.
+type KeyResult struct {
+	Name   string       // The name of the key
+	Status ResultStatus // Whether the key has been processed
+	Err    error        // The error, if any, that occurred for this key
+}
+
+// CreateKeys tries to create a new master key for each of
+// the given names. It creates multiple keys concurrently.
+//
+// It returns one KeyResult per name, in the same order as
+// names. A key that cannot be created, e.g. because it
+// already exists, does not affect the other keys. Instead,
+// the corresponding KeyResult contains the error.
+//
+// Once the ctx.Done() channel completes, CreateKeys stops
+// creating keys and returns all KeyResults and ctx.Err().
+// The KeyResults of keys that have been created before are
+// not discarded. The KeyResults of all keys that have not
+// been created contain ctx.Err() and their Status tells
+// whether CreateKeys has not attempted to create the key
+// at all. Hence, a canceled CreateKeys can be resumed by
+// retrying all keys with ResultNotAttempted.
+func (c *Client) CreateKeys(ctx context.Context, names []string) ([]KeyResult, error) {
+	results := make([]KeyResult, len(names))
+	for i, name := range names {
+		results[i].Name = name
+	}
+
+	n := parallel(ctx, len(names), func(i int) {
+		results[i].Err = c.createKey(ctx, names[i])
+		results[i].Status = resultStatus(results[i].Err)
+	})
+	for i := n; i < len(names); i++ {
+		results[i].Err = ctx.Err()
+	}
+	return results, ctx.Err()
+}
+
+// parallel calls f for each index from 0 to n-1 using
+// a bounded number of concurrent workers. It returns
+// once all calls of f have returned.
+//
+// Once the ctx.Done() channel completes, parallel stops
+// calling f for any further index. It returns the number
+// of indices for which f has been called - always in
+// ascending order.
+func parallel(ctx context.Context, n int, f func(i int)) int {
+	const MaxWorkers = 16
+
+	var (
+		indices = make(chan int)
+		wg      sync.WaitGroup
+	)
+	workers := MaxWorkers
+	if n < workers {
+		workers = n
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				f(i)
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(indices)
+
+	for i := 0; i < n; i++ {
+		select {
+		case indices <- i:
+		case <-ctx.Done():
+			return i
+		}
+	}
+	return n
+}
+
+// createKey creates a new master key with the
+// given name.
+func (c *Client) createKey(ctx context.Context, name string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint(c.Endpoint, "/v1/key/create", url.PathEscape(name)), retryBody(nil))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := c.retryClient()
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return parseErrorResponse(resp)
+	}
+	return resp.Body.Close()
+}
+
+// ImportKeySize is the size of a cryptographic key, in
+// bytes, that can be imported. A KES server uses 256 bit
+// keys for AES-256-GCM resp. ChaCha20-Poly1305.
+const ImportKeySize = 32
+
+// ImportOption is a functional option that
+// customizes how a key gets imported.
+type ImportOption func(*importConfig)
+
+// WithWipe makes ImportKey overwrite the given key
+// with zeros before it returns - regardless of whether
+// the import succeeded. See Wipe.
+func WithWipe() ImportOption {
+	return func(config *importConfig) { config.Wipe = true }
+}
+
+// importConfig holds the configuration
+// set by ImportOptions.
+type importConfig struct {
+	Wipe bool
+}
+
+// ImportKey tries to import the given key as cryptographic
+// key with the specified name.
+//
+// In contrast to CreateKey, the client specifies, and
+// therefore, knows the value of the cryptographic key.
+//
+// The key must be ImportKeySize bytes long. Otherwise,
+// ImportKey returns a KeyLengthError without sending
+// any request to the server. It returns ErrKeyExists
+// if a key with the same name already exists.
+func (c *Client) ImportKey(ctx context.Context, name string, key []byte, options ...ImportOption) error {
+	var config importConfig
+	for _, option := range options {
+		option(&config)
+	}
+	if config.Wipe {
+		defer Wipe(key)
+	}
+	if len(key) != ImportKeySize {
+		return KeyLengthError{Length: len(key), Want: ImportKeySize}
+	}
+
+	type Request struct {
+		Bytes []byte `json:"bytes"`
+	}
+	body, err := json.Marshal(Request{
+		Bytes: key,
+	})
+	if err != nil {
+		return err
+	}
+	if config.Wipe {
+		defer Wipe(body) // The body contains the base64-encoded key
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint(c.Endpoint, "/v1/key/import", url.PathEscape(name)), retryBody(bytes.NewReader(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := c.retryClient()
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return parseErrorResponse(resp)
+	}
+	return resp.Body.Close()
+}
+
+// DeleteKey deletes the given key. Once a key has been deleted
+// all data, that has been encrypted with it, cannot be decrypted
+// anymore.
+func (c *Client) DeleteKey(name string) error {
+	url := endpoint(c.Endpoint, "/v1/key/delete", url.PathEscape(name))
+	req, err := http.NewRequest(http.MethodDelete, url, retryBody(nil))
+	if err != nil {
+		return err
+	}
+	client := c.retryClient()
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return parseErrorResponse(resp)
+	}
+	return nil
+}
+
+// GenerateKey generates a new data encryption key (DEK).
+// The context is cryptographically bound to the DEK.
+//
+// A DEK has a plaintext and a ciphertext representation.
+// The plaintext should be used to perform a cryptographic
+// operation - for example: encrypt some data.
+//
+// The ciphertext is the result of encrypting the plaintext
+// with the given key. It should be stored at a durable location
+// but does not need to stay secret. The ciphertext can only
+// be decrypted with the given key at the server.
+//
+// Whenever an application needs the DEK's plaintext representation
+// it should send the ciphertext to the server via the Decrypt method.
+//
+// The context is cryptographically bound to the ciphertext and
+// the same context value must be provided whenever the
+// ciphertext should be decrypted. An application either must
+// remember the context or must be able to re-generate it.
+//
+// If an application does not wish to specify a context
+// value it can set it to nil.
+//
+// The DEK's plaintext is sensitive key material. Once
+// the plaintext is not needed anymore, it should be
+// zeroed via the DEK's Wipe method:
+//   dek, err := client.GenerateKey(ctx, "my-key", nil)
+//   if err != nil {
+//   }
+//   defer dek.Wipe()
+func (c *Client) GenerateKey(ctx context.Context, name string, context []byte) (*DEK, error) {
+	type Request struct {
+		Context []byte `json:"context,omitempty"` // A context is optional
+	}
+	body, err := json.Marshal(Request{
+		Context: context,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint(c.Endpoint, "/v1/key/generate", url.PathEscape(name)), retryBody(bytes.NewReader(body)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.retryClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseErrorResponse(resp)
+	}
+	defer resp.Body.Close()
+
+	type Response struct {
+		Plaintext  []byte `json:"plaintext"`
+		Ciphertext []byte `json:"ciphertext"`
+	}
+	const limit = 1 << 20
+	var response Response
+	if err = json.NewDecoder(io.LimitReader(resp.Body, limit)).Decode(&response); err != nil {
+		return nil, err
+	}
+	return &DEK{
+		Plaintext:  response.Plaintext,
+		Ciphertext: response.Ciphertext,
+	}, nil
+}
+
+// Encrypt encrypts and authenticates the given plaintext
+// with the specified key and returns the corresponding
+// ciphertext on success.
+//
+// An optional context value gets authenticated but is not
+// encrypted. Therefore, the same context value must be provided
+// for decryption. Clients should remember or be able to
+// re-generate the context value.
+func (c *Client) Encrypt(name string, plaintext, context []byte) ([]byte, error) {
+	type Request struct {
+		Plaintext []byte `json:"plaintext"`
+		Context   []byte `json:"context,omitempty"` // A context is optional
+	}
+	body, err := json.Marshal(Request{
+		Plaintext: plaintext,
+		Context:   context,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client := c.retryClient()
+	url := endpoint(c.Endpoint, "/v1/key/encrypt", url.PathEscape(name))
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseErrorResponse(resp)
+	}
+	defer resp.Body.Close()
+
+	type Response struct {
+		Ciphertext []byte `json:"ciphertext"`
+	}
+	const limit = 1 << 20
+	var response Response
+	if err = json.NewDecoder(io.LimitReader(resp.Body, limit)).Decode(&response); err != nil {
+		return nil, err
+	}
+	return response.Ciphertext, nil
+}
+
+// Decrypt tries to decrypt the given ciphertext with the
+// specified key and returns plaintext on success.
+//
+// The context value must match the context used when
+// the ciphertext was produced. If no context was used
+// the context value should be set to nil.
+//
+// It returns ErrDecrypt if the ciphertext is not authentic
+// - e.g. because the context value does not match.
+func (c *Client) Decrypt(name string, ciphertext, context []byte) ([]byte, error) {
+	type Request struct {
+		Ciphertext []byte `json:"ciphertext"`
+		Context    []byte `json:"context,omitempty"` // A context is optional
+	}
+	body, err := json.Marshal(Request{
+		Ciphertext: ciphertext,
+		Context:    context,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client := c.retryClient()
+	url := endpoint(c.Endpoint, "/v1/key/decrypt", url.PathEscape(name))
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseErrorResponse(resp)
+	}
+	defer resp.Body.Close()
+
+	type Response struct {
+		Plaintext []byte `json:"plaintext"`
+	}
+	const limit = 1 << 20
+	var response Response
+	if err = json.NewDecoder(io.LimitReader(resp.Body, limit)).Decode(&response); err != nil {
+		return nil, err
+	}
+	return response.Plaintext, nil
+}
+
+// DecryptRequest is a ciphertext, and its optional
+// context, that should be decrypted by DecryptAll.
+type DecryptRequest struct {
+	Ciphertext []byte
+	Context    []byte
+}
+
+// DecryptResult is the result of decrypting a single
+// DecryptRequest. It either contains the plaintext
+// or the error that occurred during decryption.
+type DecryptResult struct {
+	Plaintext  []byte
+	KeyVersion int          // The key version used to decrypt. It is 0 if the server does not version keys
+	Status     ResultStatus // Whether the item has been processed
+	Err        error
+}
+
+// DecryptAll decrypts all ciphertexts of the given items with
+// the named key. It sends multiple decryption requests to the
+// KES server concurrently.
+//
+// It returns one DecryptResult per item, in the same order as
+// items. An item that cannot be decrypted does not affect the
+// other items. Instead, the corresponding DecryptResult contains
+// the error.
+//
+// Once the ctx.Done() channel completes, DecryptAll stops
+// decrypting items and returns all DecryptResults and
+// ctx.Err(). Like CreateKeys, it keeps the results of all
+// items decrypted before. The DecryptResults of all items
+// that have not been decrypted contain ctx.Err() and their
+// Status tells whether they have been attempted at all.
+func (c *Client) DecryptAll(ctx context.Context, name string, items []DecryptRequest) ([]DecryptResult, error) {
+	results := make([]DecryptResult, len(items))
+	n := parallel(ctx, len(items), func(i int) {
+		results[i].Plaintext, results[i].Err = c.decrypt(ctx, name, items[i].Ciphertext, items[i].Context)
+		results[i].Status = resultStatus(results[i].Err)
+	})
+	for i := n; i < len(items); i++ {
+		results[i].Err = ctx.Err()
+	}
+	return results, ctx.Err()
+}
+
+// DecryptAny tries to decrypt the ciphertext with each of
+// the named keys, in order, and returns the plaintext as
+// well as the name of the first key that could decrypt it.
+// It is useful during a key rotation when a ciphertext may
+// be encrypted with either the old or the new key.
+//
+// DecryptAny only tries the next key if the ciphertext is
+// not authentic w.r.t. the current key - i.e. a DecryptError -
+// or if the current key does not exist - i.e. a KeyNotFoundError.
+// Any other error, for example a network error, is returned
+// immediately.
+//
+// If none of the keys can decrypt the ciphertext, DecryptAny
+// returns ErrDecrypt.
+func (c *Client) DecryptAny(ctx context.Context, keys []string, ciphertext, context []byte) ([]byte, string, error) {
+	for _, key := range keys {
+		plaintext, err := c.decrypt(ctx, key, ciphertext, context)
+		if err == nil {
+			return plaintext, key, nil
+		}
+		if !errors.As(err, &DecryptError{}) && !errors.As(err, &KeyNotFoundError{}) {
+			return nil, "", err
+		}
+	}
+	return nil, "", ErrDecrypt
+}
+
+// decrypt decrypts the ciphertext with the named key
+// using the given context.
+func (c *Client) decrypt(ctx context.Context, name string, ciphertext, context []byte) ([]byte, error) {
+	plaintext, _, err := c.decryptVersion(ctx, name, ciphertext, context)
+	return plaintext, err
+}
+
+// DecryptV behaves like Decrypt but also returns the
+// version of the key that has been used to decrypt the
+// ciphertext. For example, a ciphertext produced before
+// the key has been rotated got decrypted with an older
+// key version.
+//
+// A server that does not version keys reports version 0.
+func (c *Client) DecryptV(ctx context.Context, name string, ciphertext, context []byte) (*DecryptResult, error) {
+	plaintext, version, err := c.decryptVersion(ctx, name, ciphertext, context)
+	if err != nil {
+		return nil, err
+	}
+	return &DecryptResult{
+		Plaintext:  plaintext,
+		KeyVersion: version,
+		Status:     ResultCompleted,
+	}, nil
+}
+
+// decryptVersion decrypts the ciphertext with the named
+// key and returns the plaintext and the key version
+// reported by the server.
+func (c *Client) decryptVersion(ctx context.Context, name string, ciphertext, context []byte) ([]byte, int, error) {
+	type Request struct {
+		Ciphertext []byte `json:"ciphertext"`
+		Context    []byte `json:"context,omitempty"` // A context is optional
+	}
+	body, err := json.Marshal(Request{
+		Ciphertext: ciphertext,
+		Context:    context,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint(c.Endpoint, "/v1/key/decrypt", url.PathEscape(name)), retryBody(bytes.NewReader(body)))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := c.retryClient()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, parseErrorResponse(resp)
+	}
+	defer resp.Body.Close()
+
+	type Response struct {
+		Plaintext  []byte `json:"plaintext"`
+		KeyVersion int    `json:"key_version"` // Only sent by servers that version keys
+	}
+	const limit = 1 << 20
+	var response Response
+	if err = json.NewDecoder(io.LimitReader(resp.Body, limit)).Decode(&response); err != nil {
+		return nil, 0, err
+	}
+	return response.Plaintext, response.KeyVersion, nil
+}
+
+// ReWrap decrypts the ciphertext with the named key and
+// encrypts the resulting plaintext again with the latest
+// version of the key. It returns the new ciphertext that is
+// bound to the same context value.
+//
+// The KES server re-encrypts the ciphertext without sending
+// the plaintext to the client. Therefore, the client has to
+// be allowed to access the /v1/key/rewrap API.
+//
+// If the KES server does not support re-encrypting
+// ciphertexts, ReWrap falls back to decrypting and encrypting
+// the ciphertext in two separate requests. Then the plaintext
+// is sent to the client. The two requests are not atomic. In
+// particular, if the key gets deleted or rotated in between,
+// ReWrap fails or the new ciphertext is produced with an even
+// newer key version.
+//
+// Re-wrapping requires a server that versions keys - see
+// DecryptV. If the server rejects the request because the
+// key is not versioned or does not report a key version,
+// ReWrap returns a KeyVersioningError.
+func (c *Client) ReWrap(ctx context.Context, key string, ciphertext, context []byte) ([]byte, error) {
+	const API = "/v1/key/rewrap"
+	type Request struct {
+		Ciphertext []byte `json:"ciphertext"`
+		Context    []byte `json:"context,omitempty"` // A context is optional
+	}
+	body, err := json.Marshal(Request{
+		Ciphertext: ciphertext,
+		Context:    context,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint(c.Endpoint, API, url.PathEscape(key)), retryBody(bytes.NewReader(body)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.retryClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if isNotSupported(resp) {
+		resp.Body.Close()
+
+		plaintext, version, err := c.decryptVersion(ctx, key, ciphertext, context)
+		if err != nil {
+			return nil, err
+		}
+		defer Wipe(plaintext)
+
+		if version == 0 {
+			return nil, KeyVersioningError{Key: key}
+		}
+		return c.encrypt(ctx, key, plaintext, context)
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = parseErrorResponse(resp)
+		if e, ok := err.(Error); ok && e.matches(errKeyNotVersioned) {
+			return nil, KeyVersioningError{Key: key}
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	type Response struct {
+		Ciphertext []byte `json:"ciphertext"`
+		KeyVersion int    `json:"key_version"` // Only sent by servers that version keys
+	}
+	const limit = 1 << 20
+	var response Response
+	if err = json.NewDecoder(io.LimitReader(resp.Body, limit)).Decode(&response); err != nil {
+		return nil, err
+	}
+	if response.KeyVersion == 0 {
+		return nil, KeyVersioningError{Key: key}
+	}
+	return response.Ciphertext, nil
+}
+
+// encrypt encrypts the plaintext with the named
+// key using the given context.
+func (c *Client) encrypt(ctx context.Context, name string, plaintext, context []byte) ([]byte, error) {
+	type Request struct {
+		Plaintext []byte `json:"plaintext"`
+		Context   []byte `json:"context,omitempty"` // A context is optional
+	}
+	body, err := json.Marshal(Request{
+		Plaintext: plaintext,
+		Context:   context,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint(c.Endpoint, "/v1/key/encrypt", url.PathEscape(name)), retryBody(bytes.NewReader(body)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.retryClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseErrorResponse(resp)
+	}
+	defer resp.Body.Close()
+
+	type Response struct {
+		Ciphertext []byte `json:"ciphertext"`
+	}
+	const limit = 1 << 20
+	var response Response
+	if err = json.NewDecoder(io.LimitReader(resp.Body, limit)).Decode(&response); err != nil {
+		return nil, err
+	}
+	return response.Ciphertext, nil
+}
+
+// KeyInfo contains metadata about a cryptographic
+// key at a KES server.
+type KeyInfo struct {
+	Name          string    // The name of the key
+	Algorithm     Algorithm // The cryptographic algorithm of the key
+	AlgorithmName string    // The algorithm name as sent by the server - e.g. if Algorithm is AlgorithmUnknown
+	CreatedAt     time.Time // The point in time when the key has been created
+	CreatedBy     Identity  // The identity that created the key
+}
+
+// DescribeKey returns the KeyInfo of the cryptographic
+// key with the given name. Servers may not send all
+// KeyInfo fields - e.g. the creation time.
+//
+// It returns ErrKeyNotFound if no such key exists and
+// a NotSupportedError if the server cannot describe
+// keys.
+func (c *Client) DescribeKey(ctx context.Context, name string) (*KeyInfo, error) {
+	const API = "/v1/key/describe"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint(c.Endpoint, API, url.PathEscape(name)), retryBody(nil))
+	if err != nil {
+		return nil, err
+	}
+	client := c.retryClient()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		if isNotSupported(resp) {
+			resp.Body.Close()
+			return nil, NotSupportedError{API: API}
+		}
+		return nil, parseErrorResponse(resp)
+	}
+	defer resp.Body.Close()
+
+	type Response struct {
+		Name      string    `json:"name"`
+		Algorithm string    `json:"algorithm"`
+		CreatedAt time.Time `json:"created_at"`
+		CreatedBy Identity  `json:"created_by"`
+	}
+	const MaxSize = 1 << 20
+	var response Response
+	if err = json.NewDecoder(io.LimitReader(resp.Body, MaxSize)).Decode(&response); err != nil {
+		return nil, err
+	}
+	return &KeyInfo{
+		Name:          response.Name,
+		Algorithm:     ParseAlgorithm(response.Algorithm),
+		AlgorithmName: response.Algorithm,
+		CreatedAt:     response.CreatedAt,
+		CreatedBy:     response.CreatedBy,
+	}, nil
+}
+
+// KeyUsage contains usage statistics of a
+// cryptographic key tracked by the KES server.
+type KeyUsage struct {
+	Name          string    // The name of the key
+	EncryptCount  uint64    // Number of encrypt operations
+	DecryptCount  uint64    // Number of decrypt operations
+	GenerateCount uint64    // Number of generated data encryption keys
+	LastUsed      time.Time // The point in time when the key has been used the last time. Zero if never
+}
+
+// KeyUsage returns the usage statistics of the
+// cryptographic key with the given name.
+//
+// It returns ErrKeyNotFound if no such key exists and
+// a NotSupportedError if the server does not track
+// key usage.
+func (c *Client) KeyUsage(ctx context.Context, name string) (*KeyUsage, error) {
+	const API = "/v1/key/usage"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint(c.Endpoint, API, url.PathEscape(name)), retryBody(nil))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.retryClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		if isNotSupported(resp) {
+			resp.Body.Close()
+			return nil, NotSupportedError{API: API}
+		}
+		return nil, parseErrorResponse(resp)
+	}
+	defer resp.Body.Close()
+
+	type Response struct {
+		Name          string    `json:"name"`
+		EncryptCount  uint64    `json:"encrypt_count"`
+		DecryptCount  uint64    `json:"decrypt_count"`
+		GenerateCount uint64    `json:"generate_count"`
+		LastUsed      time.Time `json:"last_used"`
+	}
+	const MaxSize = 1 << 20
+	var response Response
+	if err = json.NewDecoder(io.LimitReader(resp.Body, MaxSize)).Decode(&response); err != nil {
+		return nil, err
+	}
+	return &KeyUsage{
+		Name:          response.Name,
+		EncryptCount:  response.EncryptCount,
+		DecryptCount:  response.DecryptCount,
+		GenerateCount: response.GenerateCount,
+		LastUsed:      response.LastUsed,
+	}, nil
+}
+
+// KeyExists reports whether a cryptographic key with
+// the given name exists. It describes the key - see
+// DescribeKey - and returns false and no error if the
+// server responds with a KeyNotFoundError. Any other
+// error, e.g. ErrNotAllowed, is returned as it is.
+func (c *Client) KeyExists(ctx context.Context, name string) (bool, error) {
+	_, err := c.DescribeKey(ctx, name)
+	if errors.As(err, &KeyNotFoundError{}) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ListKeys returns a new KeyIterator that iterates over all keys
+// matching the given glob pattern.
+//
 // The KeyIterator will stop once the given context.Done() completes,
 // an error occurs while iterating or once there are no more
 // KeyDescription objects - whatever happens first.
@@ -512,20 +1739,69 @@ func (c *Client) ListKeys(ctx context.Context, pattern string) (*KeyIterator, er
 		pattern = "*" // => default to: list all keys
 	}
 
-	client := retry(c.HTTPClient)
-	resp, err := client.Get(endpoint(c.Endpoint, "/v1/key/list", url.PathEscape(pattern)))
+	resp, err := c.listKeys(ctx, pattern)
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, parseErrorResponse(resp)
-	}
 	return &KeyIterator{
 		response: resp,
 		decoder:  json.NewDecoder(resp.Body),
 	}, nil
 }
 
+// ListOption is a functional option that customizes
+// how a list of keys is fetched from the KES server.
+type ListOption func(*KeyIterator)
+
+// WithPageSize sets the number of keys that are fetched
+// from the KES server at once. The KeyIterator decodes up
+// to n keys ahead of time and keeps at most n keys in memory.
+//
+// If n <= 0, the keys are fetched one by one.
+func WithPageSize(n int) ListOption {
+	return func(i *KeyIterator) { i.pageSize = n }
+}
+
+// ListKeysIter returns a new KeyIterator that iterates over
+// all keys whose name starts with the given prefix. If the
+// prefix is empty, it iterates over all keys.
+//
+// In contrast to ListKeys, ListKeysIter does not connect to
+// the KES server immediately but on the first call of the
+// KeyIterator Next method. Then, any error, e.g. ErrNotAllowed,
+// is returned by the KeyIterator Err method.
+//
+// The KES server sends the keys as stream over a single
+// connection. Hence, a KeyIterator never holds the entire
+// list of keys in memory - regardless of the page size.
+func (c *Client) ListKeysIter(ctx context.Context, prefix string, options ...ListOption) *KeyIterator {
+	iterator := &KeyIterator{
+		connect: func() (*http.Response, error) { return c.listKeys(ctx, prefix+"*") },
+	}
+	for _, option := range options {
+		option(iterator)
+	}
+	return iterator
+}
+
+// listKeys requests the list of all keys
+// matching the given glob pattern.
+func (c *Client) listKeys(ctx context.Context, pattern string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint(c.Endpoint, "/v1/key/list", url.PathEscape(pattern)), retryBody(nil))
+	if err != nil {
+		return nil, err
+	}
+	client := c.retryClient()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseErrorResponse(resp)
+	}
+	return resp, nil
+}
+
 // SetPolicy adds the given policy to the set of policies.
 // There can be just one policy with one particular name at
 // one point in time.
@@ -537,14 +1813,18 @@ func (c *Client) ListKeys(ctx context.Context, pattern string) (*KeyIterator, er
 // SetPolicy will not remove those identities before overwriting
 // the policy. Instead, it will just updated the policy entry such
 // that the given policy automatically applies to those identities.
-func (c *Client) SetPolicy(name string, policy *Policy) error {
+func (c *Client) SetPolicy(ctx context.Context, name string, policy *Policy) error {
 	content, err := json.Marshal(policy)
 	if err != nil {
 		return err
 	}
-	client := retry(c.HTTPClient)
 	url := endpoint(c.Endpoint, "/v1/policy/write", url.PathEscape(name))
-	resp, err := client.Post(url, "application/json", bytes.NewReader(content))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, retryBody(bytes.NewReader(content)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.retryClient().Do(req)
 	if err != nil {
 		return err
 	}
@@ -556,9 +1836,13 @@ func (c *Client) SetPolicy(name string, policy *Policy) error {
 
 // GetPolicy returns the policy with the given name. If no such
 // policy exists then GetPolicy returns ErrPolicyNotFound.
-func (c *Client) GetPolicy(name string) (*Policy, error) {
-	client := retry(c.HTTPClient)
-	resp, err := client.Get(endpoint(c.Endpoint, "/v1/policy/read", url.PathEscape(name)))
+func (c *Client) GetPolicy(ctx context.Context, name string) (*Policy, error) {
+	url := endpoint(c.Endpoint, "/v1/policy/read", url.PathEscape(name))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.retryClient().Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -577,33 +1861,121 @@ func (c *Client) GetPolicy(name string) (*Policy, error) {
 	return &policy, nil
 }
 
-// ListPolicies returns a list of policies with names that
-// match the given glob pattern. For example
-//   policies, err := client.ListPolicies("*") // '*' matches any
-// returns the names of all existing policies.
+// ListPolicies returns a new PolicyIterator that iterates
+// over all policies whose name matches the given glob
+// pattern. For example
+//   policies, err := client.ListPolicies(ctx, "*") // '*' matches any
+// iterates over all policies.
 //
-// If no / an empty pattern is provided then ListPolicies uses
-// the pattern '*' as default.
-func (c *Client) ListPolicies(pattern string) ([]string, error) {
+// If no / an empty pattern is provided then ListPolicies
+// uses the pattern '*' as default.
+//
+// The pattern matches the entire policy name. To list all
+// policies whose name starts with a prefix, append a '*' to
+// the prefix - e.g. "my-app-*".
+func (c *Client) ListPolicies(ctx context.Context, pattern string) (*PolicyIterator, error) {
 	if pattern == "" { // The empty pattern never matches anything
-		pattern = "*" // => default to: list "all" policies
+		pattern = "*" // => default to: list all policies
+	}
+	url := endpoint(c.Endpoint, "/v1/policy/list", url.PathEscape(pattern))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
 	}
-	client := retry(c.HTTPClient)
-	resp, err := client.Get(endpoint(c.Endpoint, "/v1/policy/list", url.PathEscape(pattern)))
+	resp, err := c.retryClient().Do(req)
 	if err != nil {
 		return nil, err
 	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, parseErrorResponse(resp)
 	}
-	defer resp.Body.Close()
+	return &PolicyIterator{
+		response: resp,
+		decoder:  json.NewDecoder(resp.Body),
+	}, nil
+}
 
-	const limit = 64 * 1024 * 1024 // There might be many policies
-	var policies []string
-	if err = json.NewDecoder(io.LimitReader(resp.Body, limit)).Decode(&policies); err != nil {
-		return nil, err
+// PolicyIterator iterates over a list of policy names.
+//   iterator, err := client.ListPolicies(ctx, "")
+//   if err != nil {
+//   }
+//   for iterator.Next() {
+//       _ = iterator.Name() // Use the policy name
+//   }
+//   if err := iterator.Err(); err != nil {
+//   }
+//
+// Once done with iterating over the list of policies,
+// an iterator should be closed using the Close method.
+//
+// A PolicyIterator decodes the policy names one by one
+// while the KES server sends them. Hence, it never holds
+// the entire list of policies in memory.
+type PolicyIterator struct {
+	response *http.Response
+	decoder  *json.Decoder
+	started  bool // true once the beginning of the list has been read
+
+	name   string
+	err    error
+	closed bool
+}
+
+// Next returns true if there is another policy name.
+// This name can be retrieved via the Name method.
+//
+// It returns false once there is no more policy name
+// or if the PolicyIterator encountered an error. The
+// error, if any, can be retrieved via the Err method.
+func (i *PolicyIterator) Next() bool {
+	if i.closed || i.err != nil {
+		return false
+	}
+	if !i.started {
+		if err := readDelim(i.decoder, '['); err != nil {
+			i.err = err
+			return false
+		}
+		i.started = true
+	}
+	if !i.decoder.More() {
+		if err := readDelim(i.decoder, ']'); err != nil {
+			i.err = err
+			return false
+		}
+		i.err = i.Close()
+		return false
+	}
+
+	var name string
+	if err := i.decoder.Decode(&name); err != nil {
+		i.err = err
+		return false
+	}
+	i.name = name
+	return true
+}
+
+// Name returns the name of the current policy.
+func (i *PolicyIterator) Name() string { return i.name }
+
+// Value returns the name of the current policy.
+// It is equivalent to Name.
+func (i *PolicyIterator) Value() string { return i.name }
+
+// Err returns the first error encountered by the
+// PolicyIterator, if any - e.g. when the connection
+// to the KES server breaks while iterating.
+func (i *PolicyIterator) Err() error { return i.err }
+
+// Close closes the underlying connection to the KES
+// server. Afterwards, Next always returns false.
+func (i *PolicyIterator) Close() error {
+	if i.closed {
+		return nil
 	}
-	return policies, nil
+	i.closed = true
+	return i.response.Body.Close()
 }
 
 // DeletePolicy removes the policy with the given name. It will not
@@ -617,14 +1989,13 @@ func (c *Client) ListPolicies(pattern string) ([]string, error) {
 // access permission for all identities assigned to the policy.
 // The later will remove the policy as well as all identities
 // assigned to it.
-func (c *Client) DeletePolicy(name string) error {
+func (c *Client) DeletePolicy(ctx context.Context, name string) error {
 	url := endpoint(c.Endpoint, "/v1/policy/delete", url.PathEscape(name))
-	req, err := http.NewRequest(http.MethodDelete, url, retryBody(nil))
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, retryBody(nil))
 	if err != nil {
 		return err
 	}
-	client := retry(c.HTTPClient)
-	resp, err := client.Do(req)
+	resp, err := c.retryClient().Do(req)
 	if err != nil {
 		return err
 	}
@@ -634,10 +2005,60 @@ func (c *Client) DeletePolicy(name string) error {
 	return nil
 }
 
-func (c *Client) AssignIdentity(policy string, id Identity) error {
-	client := retry(c.HTTPClient)
+// Identity returns the identity of the client as seen by
+// the KES server. The IdentityInfo contains the name of
+// the policy assigned to the identity and whether it is
+// the root identity.
+//
+// If no policy is assigned to the identity, the Policy
+// is empty and the identity is not allowed to perform
+// any operation - except if it is the root identity.
+func (c *Client) Identity(ctx context.Context) (*IdentityInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint(c.Endpoint, "/v1/identity/self/describe"), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.retryClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseUnexpectedResponse(resp)
+	}
+	defer resp.Body.Close()
+
+	type Response struct {
+		Identity Identity `json:"identity"`
+		Policy   string   `json:"policy"`
+		IsAdmin  bool     `json:"admin"`
+	}
+	const limit = 1 << 20
+	var response Response
+	if err = json.NewDecoder(io.LimitReader(resp.Body, limit)).Decode(&response); err != nil {
+		return nil, err
+	}
+	return &IdentityInfo{
+		Identity: response.Identity,
+		Policy:   response.Policy,
+		IsAdmin:  response.IsAdmin,
+	}, nil
+}
+
+// AssignIdentity assigns the policy to the identity.
+// Afterwards, the policy applies to any request sent
+// by the identity.
+//
+// An identity can have at most one policy. Assigning
+// a policy to an identity replaces any policy that has
+// been assigned to it before. The root identity cannot
+// be assigned to any policy.
+func (c *Client) AssignIdentity(ctx context.Context, policy string, id Identity) error {
 	url := endpoint(c.Endpoint, "/v1/identity/assign", url.PathEscape(policy), url.PathEscape(id.String()))
-	resp, err := client.Post(url, "application/json", nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, retryBody(nil))
+	if err != nil {
+		return err
+	}
+	resp, err := c.retryClient().Do(req)
 	if err != nil {
 		return err
 	}
@@ -647,32 +2068,169 @@ func (c *Client) AssignIdentity(policy string, id Identity) error {
 	return nil
 }
 
-func (c *Client) ListIdentities(pattern string) (map[Identity]string, error) {
-	client := retry(c.HTTPClient)
-	resp, err := client.Get(endpoint(c.Endpoint, "/v1/identity/list", url.PathEscape(pattern)))
+// ListIdentities returns a new IdentityIterator that iterates
+// over all identities, with a policy assigned to them, that
+// match the given glob pattern. If the pattern is empty, it
+// defaults to '*' and iterates over all identities.
+//
+// The pattern matches the entire identity. To list all
+// identities that start with a prefix, append a '*' to the
+// prefix - e.g. "3ecf*". The IdentityIterator returns the
+// identities in the order sent by the server.
+func (c *Client) ListIdentities(ctx context.Context, pattern string) (*IdentityIterator, error) {
+	if pattern == "" { // The empty pattern never matches anything
+		pattern = "*" // => default to: list all identities
+	}
+	url := endpoint(c.Endpoint, "/v1/identity/list", url.PathEscape(pattern))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.retryClient().Do(req)
 	if err != nil {
 		return nil, err
 	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, parseErrorResponse(resp)
 	}
+	return &IdentityIterator{
+		response: resp,
+		decoder:  json.NewDecoder(resp.Body),
+	}, nil
+}
 
-	const limit = 64 * 1024 * 1024 // There might be many identities
-	response := map[Identity]string{}
-	if err = json.NewDecoder(io.LimitReader(resp.Body, limit)).Decode(&response); err != nil {
-		return nil, err
+// IdentityDescription describes an identity
+// and the policy assigned to it.
+type IdentityDescription struct {
+	Identity Identity
+	Policy   string
+}
+
+// IdentityIterator iterates over a list of identities.
+//   iterator, err := client.ListIdentities(ctx, "")
+//   if err != nil {
+//   }
+//   for iterator.Next() {
+//       _ = iterator.Value() // Use the IdentityDescription
+//   }
+//   if err := iterator.Err(); err != nil {
+//   }
+//
+// Once done with iterating over the list of identities,
+// an iterator should be closed using the Close method.
+//
+// An IdentityIterator decodes the identities one by one
+// while the KES server sends them. Hence, it never holds
+// the entire list of identities in memory.
+type IdentityIterator struct {
+	response *http.Response
+	decoder  *json.Decoder
+	started  bool // true once the beginning of the list has been read
+
+	current IdentityDescription
+	err     error
+	closed  bool
+}
+
+// Next returns true if there is another IdentityDescription.
+// This IdentityDescription can be retrieved via the Value
+// method.
+//
+// It returns false once there is no more IdentityDescription
+// or if the IdentityIterator encountered an error. The error,
+// if any, can be retrieved via the Err method.
+func (i *IdentityIterator) Next() bool {
+	if i.closed || i.err != nil {
+		return false
+	}
+	if !i.started {
+		if err := readDelim(i.decoder, '{'); err != nil {
+			i.err = err
+			return false
+		}
+		i.started = true
+	}
+	if !i.decoder.More() {
+		if err := readDelim(i.decoder, '}'); err != nil {
+			i.err = err
+			return false
+		}
+		i.err = i.Close()
+		return false
+	}
+
+	token, err := i.decoder.Token()
+	if err != nil {
+		i.err = err
+		return false
+	}
+	id, ok := token.(string)
+	if !ok {
+		i.err = errors.New("kes: invalid identity list: identity is not a string")
+		return false
+	}
+	var policy string
+	if err = i.decoder.Decode(&policy); err != nil {
+		i.err = err
+		return false
 	}
-	return response, nil
+	i.current = IdentityDescription{
+		Identity: Identity(id),
+		Policy:   policy,
+	}
+	return true
 }
 
-func (c *Client) ForgetIdentity(id Identity) error {
+// Value returns the current IdentityDescription. It returns
+// the same IdentityDescription until Next is called again.
+func (i *IdentityIterator) Value() IdentityDescription { return i.current }
+
+// Identity returns the current identity. It is
+// equivalent to Value().Identity.
+func (i *IdentityIterator) Identity() Identity { return i.current.Identity }
+
+// Policy returns the policy of the current identity.
+// It is equivalent to Value().Policy.
+func (i *IdentityIterator) Policy() string { return i.current.Policy }
+
+// Err returns the first error encountered by the
+// IdentityIterator, if any - e.g. when the connection
+// to the KES server breaks while iterating.
+func (i *IdentityIterator) Err() error { return i.err }
+
+// Close closes the underlying connection to the KES
+// server. Afterwards, Next always returns false.
+func (i *IdentityIterator) Close() error {
+	if i.closed {
+		return nil
+	}
+	i.closed = true
+	return i.response.Body.Close()
+}
+
+// readDelim reads the next JSON token from the decoder
+// and returns an error if it is not the given delimiter.
+func readDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := token.(json.Delim); !ok || d != delim {
+		return errors.New("kes: invalid list: expected '" + delim.String() + "'")
+	}
+	return nil
+}
+
+// DeleteIdentity removes the identity. Once removed, no
+// policy is assigned to the identity and it cannot perform
+// any operation anymore. The root identity cannot be removed.
+func (c *Client) DeleteIdentity(ctx context.Context, id Identity) error {
 	url := endpoint(c.Endpoint, "/v1/identity/forget", url.PathEscape(id.String()))
-	req, err := http.NewRequest(http.MethodDelete, url, retryBody(nil))
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, retryBody(nil))
 	if err != nil {
 		return err
 	}
-	client := retry(c.HTTPClient)
-	resp, err := client.Do(req)
+	resp, err := c.retryClient().Do(req)
 	if err != nil {
 		return err
 	}
@@ -682,64 +2240,212 @@ func (c *Client) ForgetIdentity(id Identity) error {
 	return nil
 }
 
+// ForgetIdentity removes the identity.
+//
+// Deprecated: use DeleteIdentity.
+func (c *Client) ForgetIdentity(id Identity) error {
+	return c.DeleteIdentity(context.Background(), id)
+}
+
+// AuditLogOption is a functional option that
+// customizes an audit log subscription.
+type AuditLogOption func(*auditLogConfig)
+
+// WithResumeToken makes the subscription resume after
+// the audit event identified by token - usually the
+// value of AuditStream.Token of a previous subscription.
+// Then, the server sends all audit events after this
+// event before any new events.
+//
+// If the server does not support resuming subscriptions
+// or no longer knows the event, the subscription falls
+// back to a fresh subscription that does not contain any
+// events that happened in the past. An empty token has
+// no effect.
+func WithResumeToken(token string) AuditLogOption {
+	return func(config *auditLogConfig) { config.Token = token }
+}
+
+// auditLogConfig holds the subscription
+// configuration set by AuditLogOptions.
+type auditLogConfig struct {
+	Token string
+}
+
 // AuditLog returns a stream of audit events produced by the
 // KES server. The stream does not contain any events that
-// happened in the past.
+// happened in the past, unless the subscription resumes
+// a previous one. See WithResumeToken.
 //
-// It returns ErrNotAllowed if the client does not
-// have sufficient permissions to subscribe to the
-// audit log.
-func (c *Client) AuditLog() (*AuditStream, error) {
-	client := retry(c.HTTPClient)
-	resp, err := client.Get(endpoint(c.Endpoint, "/v1/log/audit/trace"))
+// The stream stops once the ctx.Done() channel completes.
+// Closing the stream closes the connection to the server.
+//
+// It returns an Error with the status code 403 Forbidden
+// and the error message sent by the server, usually
+// ErrNotAllowed, if the client does not have sufficient
+// permissions to subscribe to the audit log. The error
+// matches a NotAllowedError via errors.As.
+func (c *Client) AuditLog(ctx context.Context, options ...AuditLogOption) (*AuditStream, error) {
+	var config auditLogConfig
+	for _, option := range options {
+		option(&config)
+	}
+
+	body, err := c.auditLog(ctx, config.Token)
+	if err != nil {
+		return nil, err
+	}
+	stream := NewAuditStream(body)
+	stream.token = config.Token
+	return stream, nil
+}
+
+// AuditLogRaw returns the raw audit log stream produced by
+// the KES server, i.e. the response body containing one
+// JSON-encoded audit event per line. In contrast to AuditLog,
+// it does not parse the audit events. For example, a proxy
+// can forward the stream to its clients via io.Copy.
+//
+// The stream stops once the ctx.Done() channel completes.
+// Closing the returned io.ReadCloser closes the connection
+// to the server.
+//
+// It returns an Error with the status code 403 Forbidden
+// and the error message sent by the server, usually
+// ErrNotAllowed, if the client does not have sufficient
+// permissions to subscribe to the audit log. The error
+// matches a NotAllowedError via errors.As.
+func (c *Client) AuditLogRaw(ctx context.Context) (io.ReadCloser, error) {
+	return c.auditLog(ctx, "")
+}
+
+// auditLog subscribes to the server's audit log. If token
+// is not empty, it asks the server to resume after the
+// audit event identified by token and falls back to a
+// fresh subscription if the server rejects the token.
+func (c *Client) auditLog(ctx context.Context, token string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint(c.Endpoint, "/v1/log/audit/trace"), retryBody(nil))
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Last-Event-ID", token)
+	}
+	client := c.retryClient()
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	if token != "" && (resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusGone) {
+		// The server does not support resuming or
+		// does not know the token (anymore).
+		resp.Body.Close()
+		return c.auditLog(ctx, "")
+	}
+	if resp.StatusCode == http.StatusForbidden {
+		return nil, parseNotAllowedResponse(resp)
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, parseErrorResponse(resp)
+		return nil, parseUnexpectedResponse(resp)
 	}
-	return NewAuditStream(resp.Body), nil
+	return resp.Body, nil
 }
 
 // ErrorLog returns a stream of error events produced by the
 // KES server. The stream does not contain any events that
 // happened in the past.
 //
-// It returns ErrNotAllowed if the client does not
-// have sufficient permissions to subscribe to the
-// error log.
-func (c *Client) ErrorLog() (*ErrorStream, error) {
-	client := retry(c.HTTPClient)
-	resp, err := client.Get(endpoint(c.Endpoint, "/v1/log/error/trace"))
+// The stream stops once the ctx.Done() channel completes.
+// Closing the stream closes the connection to the server.
+//
+// It returns an Error with the status code 403 Forbidden
+// and the error message sent by the server, usually
+// ErrNotAllowed, if the client does not have sufficient
+// permissions to subscribe to the error log. The error
+// matches a NotAllowedError via errors.As. If the server
+// responds with any other status code than 200 OK, the
+// returned error is an Error with the response status code.
+func (c *Client) ErrorLog(ctx context.Context) (*ErrorStream, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint(c.Endpoint, "/v1/log/error/trace"), retryBody(nil))
+	if err != nil {
+		return nil, err
+	}
+	client := c.retryClient()
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	if resp.StatusCode == http.StatusForbidden {
+		return nil, parseNotAllowedResponse(resp)
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, parseErrorResponse(resp)
+		return nil, parseUnexpectedResponse(resp)
 	}
 	return NewErrorStream(resp.Body), nil
 }
 
+// ErrorLogRetry returns a stream of error events produced
+// by the KES server. In contrast to ErrorLog, the stream
+// re-connects to the KES server whenever the connection
+// breaks - e.g. because the server restarts. Error events
+// produced while the stream re-connects are lost. The
+// ErrorStream LastGap method reports when this happened.
+//
+// The stream re-connects with an exponential backoff that
+// can be customized via RetryOptions. It does not re-connect
+// once the ctx.Done() channel completes, the stream gets closed
+// or the server rejects the subscription - e.g. with
+// ErrNotAllowed. Then, the iteration stops and the ErrorStream
+// Err method returns the cause.
+//
+// ErrorLogRetry does not connect to the KES server immediately
+// but on the first call of the ErrorStream Next method.
+func (c *Client) ErrorLogRetry(ctx context.Context, options ...RetryOption) *ErrorStream {
+	connect := func(ctx context.Context) (io.ReadCloser, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint(c.Endpoint, "/v1/log/error/trace"), retryBody(nil))
+		if err != nil {
+			return nil, err
+		}
+		client := c.retryClient()
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, parseErrorResponse(resp)
+		}
+		return resp.Body, nil
+	}
+	return NewErrorStream(newReconnectReader(ctx, connect, options))
+}
+
 // Metrics returns a KES server metric snapshot.
+// Any metric that is not exposed by the server
+// is zero.
 //
 // It returns ErrNotAllowed if the client does not
 // have sufficient permissions to fetch server metrics.
-func (c *Client) Metrics() (Metric, error) {
-	client := retry(c.HTTPClient)
-	resp, err := client.Get(endpoint(c.Endpoint, "/v1/metrics"))
+func (c *Client) Metrics(ctx context.Context) (*Metric, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint(c.Endpoint, "/v1/metrics"), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.retryClient().Do(req)
 	if err != nil {
-		return Metric{}, err
+		return nil, err
 	}
 	if resp.StatusCode != http.StatusOK {
-		return Metric{}, parseErrorResponse(resp)
+		return nil, parseErrorResponse(resp)
 	}
 	defer resp.Body.Close()
 
 	const (
-		MetricRequestOK    = "kes_http_request_success"
-		MetricRequestErr   = "kes_http_request_error"
-		MetricRequestFail  = "kes_http_request_failure"
-		MetricResponseTime = "kes_http_response_time"
+		MetricRequestOK     = "kes_http_request_success"
+		MetricRequestErr    = "kes_http_request_error"
+		MetricRequestFail   = "kes_http_request_failure"
+		MetricResponseTime  = "kes_http_response_time"
+		MetricRequestActive = "kes_http_request_active"
+		MetricAuditEvents   = "kes_log_audit_events"
 	)
 
 	var (
@@ -753,11 +2459,11 @@ func (c *Client) Metrics() (Metric, error) {
 			break
 		}
 		if err != nil {
-			return Metric{}, err
+			return nil, err
 		}
 
 		if len(metricFamily.Metric) != 1 {
-			return Metric{}, errors.New("kes: server response contains more than one metric")
+			return nil, errors.New("kes: server response contains more than one metric")
 		}
 		var (
 			name      = metricFamily.GetName()
@@ -771,6 +2477,10 @@ func (c *Client) Metrics() (Metric, error) {
 			metric.RequestErr = uint64(rawMetric.GetCounter().GetValue())
 		case kind == dto.MetricType_COUNTER && name == MetricRequestFail:
 			metric.RequestFail = uint64(rawMetric.GetCounter().GetValue())
+		case kind == dto.MetricType_GAUGE && name == MetricRequestActive:
+			metric.RequestActive = uint64(rawMetric.GetGauge().GetValue())
+		case kind == dto.MetricType_COUNTER && name == MetricAuditEvents:
+			metric.AuditEvents = uint64(rawMetric.GetCounter().GetValue())
 		case kind == dto.MetricType_HISTOGRAM && name == MetricResponseTime:
 			metric.LatencyHistogram = map[time.Duration]uint64{}
 			for _, bucket := range rawMetric.GetHistogram().GetBucket() {
@@ -780,7 +2490,31 @@ func (c *Client) Metrics() (Metric, error) {
 			delete(metric.LatencyHistogram, 0) // Delete the artificial zero entry
 		}
 	}
-	return metric, nil
+	return &metric, nil
+}
+
+// retryClient returns a retry client that sends
+// requests using the client's HTTPClient and retry
+// configuration.
+func (c *Client) retryClient() *retry {
+	r := &retry{
+		Client:      c.HTTPClient,
+		MaxAttempts: c.maxAttempts,
+		Backoff:     c.backoff,
+		Enclave:     c.enclave,
+		Timeout:     c.timeout,
+		Hook:        c.hook,
+		UserAgent:   c.userAgent,
+	}
+	if c.transport != nil {
+		if t, ok := c.transport.Load().(*http.Transport); ok {
+			r.Client.Transport = t
+		}
+	}
+	if c.balancer.Len() > 1 {
+		r.Balancer = c.balancer
+	}
+	return r
 }
 
 // endpoint returns an endpoint URL starting with the
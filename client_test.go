@@ -4,7 +4,26 @@
 
 package kes
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
 
 var endpointTests = []struct {
 	Endpoint string
@@ -44,3 +63,1745 @@ func TestEndpoint(t *testing.T) {
 		}
 	}
 }
+
+func TestAuditLog(t *testing.T) {
+	const Events = `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key","identity":"dd46485b"},"response":{"code":200,"time":12106}}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/log/audit/trace" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, Events)
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	stream, err := client.AuditLog(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to subscribe to audit log: %v", err)
+	}
+	defer stream.Close()
+
+	if !stream.Next() {
+		t.Fatalf("Failed to read audit event: %v", stream.Err())
+	}
+	if path := stream.Event().Request.Path; path != "/v1/key/create/my-key" {
+		t.Fatalf("Invalid audit event: got path '%s' - want '%s'", path, "/v1/key/create/my-key")
+	}
+
+	client.Endpoint = server.URL + "/unknown"
+	if _, err = client.AuditLog(context.Background()); err == nil {
+		t.Fatal("Subscribing to an unknown endpoint succeeded")
+	}
+}
+
+var auditLogResumeTests = []struct {
+	Token  string
+	Events []string // IDs of the received events
+	Resume string   // The Last-Event-ID sent by the client
+	Final  string   // The stream token after all events
+}{
+	{Token: "", Events: []string{"3"}, Resume: "", Final: "3"},            // 0
+	{Token: "1", Events: []string{"2", "3"}, Resume: "1", Final: "3"},     // 1
+	{Token: "expired", Events: []string{"3"}, Resume: "", Final: "3"},     // 2
+	{Token: "unsupported", Events: []string{"3"}, Resume: "", Final: "3"}, // 3
+	{Token: "3", Events: []string{}, Resume: "3", Final: "3"},             // 4
+}
+
+func TestAuditLogResume(t *testing.T) {
+	const Format = `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key","identity":"dd46485b"},"response":{"code":200,"time":12106},"id":"%s"}` + "\n"
+
+	var lastEventID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastEventID = r.Header.Get("Last-Event-ID")
+		switch lastEventID {
+		case "":
+			fmt.Fprintf(w, Format, "3")
+		case "1":
+			fmt.Fprintf(w, Format, "2")
+			fmt.Fprintf(w, Format, "3")
+		case "3":
+		case "expired":
+			w.WriteHeader(http.StatusGone)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	for i, test := range auditLogResumeTests {
+		stream, err := client.AuditLog(context.Background(), WithResumeToken(test.Token))
+		if err != nil {
+			t.Fatalf("Test %d: failed to subscribe to audit log: %v", i, err)
+		}
+		if lastEventID != test.Resume {
+			t.Fatalf("Test %d: invalid Last-Event-ID: got '%s' - want '%s'", i, lastEventID, test.Resume)
+		}
+		if token := stream.Token(); token != test.Token {
+			t.Fatalf("Test %d: invalid initial token: got '%s' - want '%s'", i, token, test.Token)
+		}
+
+		var ids []string
+		for stream.Next() {
+			ids = append(ids, stream.Event().ID)
+		}
+		if err = stream.Err(); err != nil {
+			t.Fatalf("Test %d: failed to read audit events: %v", i, err)
+		}
+		if len(ids) != len(test.Events) {
+			t.Fatalf("Test %d: invalid events: got %v - want %v", i, ids, test.Events)
+		}
+		for j := range ids {
+			if ids[j] != test.Events[j] {
+				t.Fatalf("Test %d: invalid events: got %v - want %v", i, ids, test.Events)
+			}
+		}
+		if token := stream.Token(); token != test.Final {
+			t.Fatalf("Test %d: invalid token: got '%s' - want '%s'", i, token, test.Final)
+		}
+		stream.Close()
+	}
+}
+
+var logNotAllowedTests = []struct {
+	ContentType string
+	Body        string
+	Err         Error
+}{
+	{ContentType: "application/json", Body: `{"message":"audit log access denied"}`, Err: NewError(http.StatusForbidden, "audit log access denied")}, // 0
+	{ContentType: "application/json", Body: `{"message":"prohibited by policy"}`, Err: ErrNotAllowed},                                                // 1
+	{ContentType: "application/json", Body: `{"message":`, Err: ErrNotAllowed},                                                                       // 2
+	{ContentType: "text/plain", Body: "", Err: ErrNotAllowed},                                                                                        // 3
+}
+
+func TestLogNotAllowed(t *testing.T) {
+	for i, test := range logNotAllowedTests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", test.ContentType)
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, test.Body)
+		}))
+
+		client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+		_, auditErr := client.AuditLog(context.Background())
+		_, errorErr := client.ErrorLog(context.Background())
+		server.Close()
+
+		if auditErr != test.Err {
+			t.Fatalf("Test %d: invalid audit log error: got %v - want %v", i, auditErr, test.Err)
+		}
+		if errorErr != test.Err {
+			t.Fatalf("Test %d: invalid error log error: got %v - want %v", i, errorErr, test.Err)
+		}
+		var notAllowed NotAllowedError
+		if !errors.As(auditErr, &notAllowed) || notAllowed.Message != test.Err.Error() {
+			t.Fatalf("Test %d: error does not match NotAllowedError: got %v", i, auditErr)
+		}
+	}
+}
+
+func TestAuditLogRaw(t *testing.T) {
+	const Events = `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key","identity":"dd46485b"},"response":{"code":200,"time":12106}}
+{"time":"2020-03-24T12:37:34Z","request":{"path":"/v1/key/create/my-key","identity":"dd46485b"},"response":{"code":400,"time":1042}}
+`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/log/audit/trace" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, Events)
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	body, err := client.AuditLogRaw(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to subscribe to audit log: %v", err)
+	}
+	defer body.Close()
+
+	var buffer bytes.Buffer
+	if _, err = io.Copy(&buffer, body); err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	if buffer.String() != Events {
+		t.Fatalf("Invalid audit log: got %q - want %q", buffer.String(), Events)
+	}
+
+	client.Endpoint = server.URL + "/unknown"
+	if _, err = client.AuditLogRaw(context.Background()); err == nil {
+		t.Fatal("Subscribing to an unknown endpoint succeeded")
+	}
+}
+
+func TestErrorLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/log/error/trace":
+			io.WriteString(w, `{"message":"2020/03/24 14:46:10 aws: secret was not encrypted with '4f9147d9-a676-47cd-ad3f-3485abf9123d'"}`)
+		case "/forbidden/v1/log/error/trace":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	stream, err := client.ErrorLog(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to subscribe to error log: %v", err)
+	}
+	if !stream.Next() {
+		t.Fatalf("Failed to read error event: %v", stream.Err())
+	}
+	if err = stream.Close(); err != nil {
+		t.Fatalf("Failed to close stream: %v", err)
+	}
+
+	statusTests := []struct {
+		Endpoint string
+		Status   int
+	}{
+		{Endpoint: server.URL + "/forbidden", Status: http.StatusForbidden},
+		{Endpoint: server.URL + "/unknown", Status: http.StatusNoContent},
+	}
+	for i, test := range statusTests {
+		client.Endpoint = test.Endpoint
+		_, err = client.ErrorLog(context.Background())
+		var kesErr Error
+		if !errors.As(err, &kesErr) {
+			t.Fatalf("Test %d: invalid error: got %v - want %T", i, err, kesErr)
+		}
+		if kesErr.Status() != test.Status {
+			t.Fatalf("Test %d: invalid error status: got %d - want %d", i, kesErr.Status(), test.Status)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client.Endpoint = server.URL
+	if _, err = client.ErrorLog(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Invalid error: got %v - want %v", err, context.Canceled)
+	}
+}
+
+func TestCreateKeyIfNotExists(t *testing.T) {
+	keys := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/v1/key/create/")
+		if keys[name] {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"message":"key does already exist"}`)
+			return
+		}
+		if name == "reworded-key" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"message":"key already exists","code":"key_exists"}`)
+			return
+		}
+		keys[name] = true
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	created, err := client.CreateKeyIfNotExists(context.Background(), "my-key")
+	if err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+	if !created {
+		t.Fatal("Key has not been created")
+	}
+
+	created, err = client.CreateKeyIfNotExists(context.Background(), "my-key")
+	if err != nil {
+		t.Fatalf("Failed to create existing key: %v", err)
+	}
+	if created {
+		t.Fatal("Existing key has been created again")
+	}
+
+	// The error message does not matter as long as
+	// the server sends the key_exists error code.
+	created, err = client.CreateKeyIfNotExists(context.Background(), "reworded-key")
+	if err != nil {
+		t.Fatalf("Failed to create existing key: %v", err)
+	}
+	if created {
+		t.Fatal("Existing key has been created again")
+	}
+}
+
+func TestCreateKeys(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if name := strings.TrimPrefix(r.URL.Path, "/v1/key/create/"); strings.HasPrefix(name, "existing-") {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"message":"key does already exist"}`)
+		}
+	}))
+	defer server.Close()
+
+	var names []string
+	for i := 0; i < 50; i++ {
+		if i%3 == 0 {
+			names = append(names, fmt.Sprintf("existing-%d", i))
+		} else {
+			names = append(names, fmt.Sprintf("key-%d", i))
+		}
+	}
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	results, err := client.CreateKeys(context.Background(), names)
+	if err != nil {
+		t.Fatalf("Failed to create keys: %v", err)
+	}
+	if len(results) != len(names) {
+		t.Fatalf("Invalid number of results: got %d - want %d", len(results), len(names))
+	}
+	for i, result := range results {
+		if result.Name != names[i] {
+			t.Fatalf("Result %d: got name '%s' - want '%s'", i, result.Name, names[i])
+		}
+		if strings.HasPrefix(result.Name, "existing-") && (result.Err != ErrKeyExists || result.Status != ResultFailed) {
+			t.Fatalf("Result %d: got error %v and status '%v' - want %v and '%v'", i, result.Err, result.Status, ErrKeyExists, ResultFailed)
+		}
+		if !strings.HasPrefix(result.Name, "existing-") && (result.Err != nil || result.Status != ResultCompleted) {
+			t.Fatalf("Result %d: failed to create key: %v - status '%v'", i, result.Err, result.Status)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err = client.CreateKeys(ctx, names)
+	if err != context.Canceled {
+		t.Fatalf("Invalid error: got %v - want %v", err, context.Canceled)
+	}
+	for i, result := range results {
+		if !errors.Is(result.Err, context.Canceled) {
+			t.Fatalf("Result %d: got error %v - want %v", i, result.Err, context.Canceled)
+		}
+		if result.Status != ResultNotAttempted {
+			t.Fatalf("Result %d: got status '%v' - want '%v'", i, result.Status, ResultNotAttempted)
+		}
+	}
+}
+
+func TestDecryptAllCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Items are dispatched in ascending order. Hence, once the
+	// server receives item 40, at least 24 items have been
+	// decrypted since there are at most 16 concurrent requests.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Ciphertext []byte `json:"ciphertext"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err == nil && string(request.Ciphertext) == "item-40" {
+			cancel()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"plaintext":"AAECAw=="}`)
+	}))
+	defer server.Close()
+
+	items := make([]DecryptRequest, 100)
+	for i := range items {
+		items[i].Ciphertext = []byte(fmt.Sprintf("item-%d", i))
+	}
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	results, err := client.DecryptAll(ctx, "my-key", items)
+	if err != context.Canceled {
+		t.Fatalf("Invalid error: got %v - want %v", err, context.Canceled)
+	}
+	if len(results) != len(items) {
+		t.Fatalf("Invalid number of results: got %d - want %d", len(results), len(items))
+	}
+
+	var completed, notAttempted int
+	for i, result := range results {
+		switch result.Status {
+		case ResultCompleted:
+			completed++
+			if result.Err != nil || !bytes.Equal(result.Plaintext, []byte{0, 1, 2, 3}) {
+				t.Fatalf("Result %d: invalid completed result: %+v", i, result)
+			}
+		case ResultFailed:
+			if result.Err == nil {
+				t.Fatalf("Result %d: failed result contains no error", i)
+			}
+		case ResultNotAttempted:
+			notAttempted++
+			if result.Err != context.Canceled {
+				t.Fatalf("Result %d: got error %v - want %v", i, result.Err, context.Canceled)
+			}
+		default:
+			t.Fatalf("Result %d: invalid status '%v'", i, result.Status)
+		}
+	}
+	if completed < 24 || notAttempted == 0 {
+		t.Fatalf("Partial results have been discarded: %d completed - %d not attempted", completed, notAttempted)
+	}
+}
+
+func TestListKeysIter(t *testing.T) {
+	const Keys = 10
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/key/list/my-*" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `{"message":"prohibited by policy"}`)
+			return
+		}
+		w.Header().Set("Trailer", "Status, Error")
+		encoder := json.NewEncoder(w)
+		for i := 0; i < Keys; i++ {
+			encoder.Encode(KeyDescription{Name: fmt.Sprintf("my-key-%d", i)})
+		}
+		w.Header().Set("Status", strconv.Itoa(http.StatusOK))
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	for _, pageSize := range []int{0, 1, 3, Keys, 2 * Keys} {
+		iterator := client.ListKeysIter(context.Background(), "my-", WithPageSize(pageSize))
+		var n int
+		for ; iterator.Next(); n++ {
+			if name := iterator.Name(); name != fmt.Sprintf("my-key-%d", n) {
+				t.Fatalf("Page size %d: got key '%s' - want '%s'", pageSize, name, fmt.Sprintf("my-key-%d", n))
+			}
+		}
+		if err := iterator.Err(); err != nil {
+			t.Fatalf("Page size %d: failed to list keys: %v", pageSize, err)
+		}
+		if n != Keys {
+			t.Fatalf("Page size %d: got %d keys - want %d", pageSize, n, Keys)
+		}
+	}
+
+	iterator := client.ListKeysIter(context.Background(), "other-")
+	if iterator.Next() {
+		t.Fatal("Listed keys without permission")
+	}
+	if err := iterator.Err(); err != ErrNotAllowed {
+		t.Fatalf("Invalid error: got %v - want %v", err, ErrNotAllowed)
+	}
+}
+
+func TestDescribeKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/v1/key/describe/my-key" {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"message":"key does not exist"}`)
+			return
+		}
+		io.WriteString(w, `{"name":"my-key","algorithm":"AES256-GCM_SHA256","created_at":"2021-03-24T12:37:33Z","created_by":"dd46485b"}`)
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	info, err := client.DescribeKey(context.Background(), "my-key")
+	if err != nil {
+		t.Fatalf("Failed to describe key: %v", err)
+	}
+	if info.Name != "my-key" || info.Algorithm != AES256_GCM_SHA256 || info.AlgorithmName != "AES256-GCM_SHA256" || info.CreatedBy != "dd46485b" {
+		t.Fatalf("Invalid key info: %+v", info)
+	}
+	if createdAt := time.Date(2021, 3, 24, 12, 37, 33, 0, time.UTC); !info.CreatedAt.Equal(createdAt) {
+		t.Fatalf("Invalid creation time: got %v - want %v", info.CreatedAt, createdAt)
+	}
+
+	if _, err = client.DescribeKey(context.Background(), "other-key"); err != ErrKeyNotFound {
+		t.Fatalf("Invalid error: got %v - want %v", err, ErrKeyNotFound)
+	}
+}
+
+var importKeyLengthTests = []struct {
+	Key  []byte
+	Wipe bool
+	Err  bool
+}{
+	{Key: bytes.Repeat([]byte{1}, 32)},                        // 0
+	{Key: bytes.Repeat([]byte{1}, 32), Wipe: true},            // 1
+	{Key: bytes.Repeat([]byte{1}, 16), Err: true},             // 2
+	{Key: bytes.Repeat([]byte{1}, 64), Wipe: true, Err: true}, // 3
+	{Key: nil, Err: true},                                     // 4
+}
+
+func TestImportKeyLength(t *testing.T) {
+	var imported []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/key/import/my-key" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var request struct {
+			Bytes []byte `json:"bytes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		imported = request.Bytes
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	for i, test := range importKeyLengthTests {
+		imported = nil
+		key := append([]byte(nil), test.Key...)
+
+		var options []ImportOption
+		if test.Wipe {
+			options = append(options, WithWipe())
+		}
+		err := client.ImportKey(context.Background(), "my-key", key, options...)
+		if test.Err {
+			if _, ok := err.(KeyLengthError); !ok {
+				t.Fatalf("Test %d: got error %v - want %T", i, err, KeyLengthError{})
+			}
+			if imported != nil {
+				t.Fatalf("Test %d: key with invalid length has been sent to the server", i)
+			}
+		}
+		if !test.Err {
+			if err != nil {
+				t.Fatalf("Test %d: failed to import key: %v", i, err)
+			}
+			if !bytes.Equal(imported, test.Key) {
+				t.Fatalf("Test %d: got key %x - want %x", i, imported, test.Key)
+			}
+		}
+		if test.Wipe && !bytes.Equal(key, make([]byte, len(key))) {
+			t.Fatalf("Test %d: key has not been wiped", i)
+		}
+		if !test.Wipe && !bytes.Equal(key, test.Key) {
+			t.Fatalf("Test %d: key has been modified", i)
+		}
+	}
+}
+
+var requestHookTests = []struct {
+	Name       string
+	Path       string
+	StatusCode int
+}{
+	{Name: "my-key", Path: "/v1/key/describe/my-key", StatusCode: http.StatusOK},         // 0
+	{Name: "unknown", Path: "/v1/key/describe/unknown", StatusCode: http.StatusNotFound}, // 1
+}
+
+func TestRequestHook(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/v1/key/describe/my-key" {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"message":"key does not exist"}`)
+			return
+		}
+		io.WriteString(w, `{"name":"my-key","algorithm":"AES256-GCM_SHA256","created_at":"2021-03-24T12:37:33Z","created_by":"dd46485b"}`)
+	}))
+	defer server.Close()
+
+	type contextKey struct{}
+	var infos []RequestInfo
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	WithRequestHook(func(ctx context.Context, info RequestInfo) {
+		if ctx.Value(contextKey{}) == nil {
+			t.Errorf("Hook has been called with the wrong context")
+		}
+		infos = append(infos, info)
+	})(client)
+
+	ctx := context.WithValue(context.Background(), contextKey{}, true)
+	for i, test := range requestHookTests {
+		client.KeyExists(ctx, test.Name)
+		if len(infos) != i+1 {
+			t.Fatalf("Test %d: hook has been called %d times - want %d", i, len(infos), i+1)
+		}
+		info := infos[i]
+		if info.Method != http.MethodGet {
+			t.Fatalf("Test %d: invalid method: got %q - want %q", i, info.Method, http.MethodGet)
+		}
+		if info.Path != test.Path {
+			t.Fatalf("Test %d: invalid path: got %q - want %q", i, info.Path, test.Path)
+		}
+		if info.StatusCode != test.StatusCode {
+			t.Fatalf("Test %d: invalid status code: got %d - want %d", i, info.StatusCode, test.StatusCode)
+		}
+		if info.Duration <= 0 || info.Err != nil {
+			t.Fatalf("Test %d: invalid request info: %+v", i, info)
+		}
+	}
+
+	// A panicking hook must not affect the request.
+	WithRequestHook(func(context.Context, RequestInfo) { panic("hook panic") })(client)
+	if exists, err := client.KeyExists(ctx, "my-key"); err != nil || !exists {
+		t.Fatalf("Request failed due to panicking hook: exists=%v - err=%v", exists, err)
+	}
+
+	// A hook must also be called when no response has been received.
+	infos = infos[:0]
+	client.Endpoint = "http://127.0.0.1:0"
+	WithRequestHook(func(_ context.Context, info RequestInfo) { infos = append(infos, info) })(client)
+	WithRetry(1, nil)(client)
+	if _, err := client.KeyExists(ctx, "my-key"); err == nil {
+		t.Fatalf("Request should have failed")
+	}
+	if len(infos) != 1 || infos[0].StatusCode != 0 || infos[0].Err == nil {
+		t.Fatalf("Invalid request info: %+v", infos)
+	}
+}
+
+var decryptAnyTests = []struct {
+	Keys []string
+	Key  string
+	Err  error
+}{
+	{Keys: []string{"new-key"}, Key: "new-key"},                           // 0
+	{Keys: []string{"old-key", "new-key"}, Key: "new-key"},                // 1
+	{Keys: []string{"deleted-key", "old-key", "new-key"}, Key: "new-key"}, // 2
+	{Keys: []string{"old-key", "deleted-key"}, Err: ErrDecrypt},           // 3
+	{Keys: []string{"forbidden-key", "new-key"}, Err: ErrNotAllowed},      // 4
+	{Keys: nil, Err: ErrDecrypt},                                          // 5
+	{Keys: []string{"reworded-key", "new-key"}, Key: "new-key"},           // 6
+	{Keys: []string{"missing-key", "new-key"}, Key: "new-key"},            // 7
+}
+
+func TestDecryptAny(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/key/decrypt/new-key":
+			io.WriteString(w, `{"plaintext":"AAECAw=="}`)
+		case "/v1/key/decrypt/old-key":
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"message":"ciphertext is not authentic"}`)
+		case "/v1/key/decrypt/reworded-key":
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"message":"invalid ciphertext","code":"not_authentic"}`)
+		case "/v1/key/decrypt/missing-key":
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"message":"no such key","code":"key_not_found"}`)
+		case "/v1/key/decrypt/forbidden-key":
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `{"message":"prohibited by policy"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"message":"key does not exist"}`)
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	for i, test := range decryptAnyTests {
+		plaintext, key, err := client.DecryptAny(context.Background(), test.Keys, []byte("ciphertext"), nil)
+		if err != test.Err {
+			t.Fatalf("Test %d: invalid error: got %v - want %v", i, err, test.Err)
+		}
+		if key != test.Key {
+			t.Fatalf("Test %d: invalid key: got %q - want %q", i, key, test.Key)
+		}
+		if err == nil && !bytes.Equal(plaintext, []byte{0, 1, 2, 3}) {
+			t.Fatalf("Test %d: invalid plaintext: got %x - want %x", i, plaintext, []byte{0, 1, 2, 3})
+		}
+	}
+}
+
+var decryptVTests = []struct {
+	Key     string
+	Version int
+	Err     error
+}{
+	{Key: "rotated-key", Version: 2},          // 0
+	{Key: "unversioned-key", Version: 0},      // 1
+	{Key: "deleted-key", Err: ErrKeyNotFound}, // 2
+}
+
+func TestDecryptV(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/key/decrypt/rotated-key":
+			io.WriteString(w, `{"plaintext":"AAECAw==","key_version":2}`)
+		case "/v1/key/decrypt/unversioned-key":
+			io.WriteString(w, `{"plaintext":"AAECAw=="}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"message":"key does not exist"}`)
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	for i, test := range decryptVTests {
+		result, err := client.DecryptV(context.Background(), test.Key, []byte("ciphertext"), nil)
+		if err != test.Err {
+			t.Fatalf("Test %d: invalid error: got %v - want %v", i, err, test.Err)
+		}
+		if err != nil {
+			continue
+		}
+		if result.KeyVersion != test.Version {
+			t.Fatalf("Test %d: invalid key version: got %d - want %d", i, result.KeyVersion, test.Version)
+		}
+		if result.Status != ResultCompleted {
+			t.Fatalf("Test %d: invalid status: got %v - want %v", i, result.Status, ResultCompleted)
+		}
+		if !bytes.Equal(result.Plaintext, []byte{0, 1, 2, 3}) {
+			t.Fatalf("Test %d: invalid plaintext: got %x - want %x", i, result.Plaintext, []byte{0, 1, 2, 3})
+		}
+	}
+}
+
+var apisTests = []struct {
+	Name      string
+	Supported bool
+}{
+	{Name: "/v1/key/create", Supported: true},    // 0
+	{Name: "/v1/key/create/", Supported: true},   // 1
+	{Name: KeyDecrypt.String(), Supported: true}, // 2
+	{Name: "/v1/key/describe", Supported: false}, // 3
+	{Name: "/v1/key", Supported: false},          // 4
+	{Name: "", Supported: false},                 // 5
+}
+
+func TestAPIs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/api" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `[{"method":"POST","path":"/v1/key/create","max_body":0,"timeout":15},{"method":"POST","path":"/v1/key/decrypt","max_body":1048576,"timeout":15}]`)
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	apis, err := client.APIs(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to list APIs: %v", err)
+	}
+	if len(apis) != 2 {
+		t.Fatalf("Invalid number of APIs: got %d - want %d", len(apis), 2)
+	}
+	if api := apis[1]; api.Method != http.MethodPost || api.MaxBody != 1<<20 || api.Timeout != 15*time.Second {
+		t.Fatalf("Invalid API descriptor: %+v", api)
+	}
+	for i, test := range apisTests {
+		if supported := apis.Supports(test.Name); supported != test.Supported {
+			t.Fatalf("Test %d: got %v - want %v", i, supported, test.Supported)
+		}
+	}
+
+	// An older server does not support listing its APIs.
+	client.Endpoint = server.URL + "/old"
+	if _, err = client.APIs(context.Background()); err == nil {
+		t.Fatalf("Listing APIs should have failed")
+	}
+	if kesErr, ok := err.(Error); !ok || kesErr.Status() != http.StatusNotFound {
+		t.Fatalf("Invalid error: got %v - want status %d", err, http.StatusNotFound)
+	}
+}
+
+func TestClientConcurrency(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/v1/status":
+			io.WriteString(w, `{"version":"v0.0.0-dev","uptime":1000000000}`)
+		case strings.HasPrefix(r.URL.Path, "/v1/key/create/"):
+		case strings.HasPrefix(r.URL.Path, "/v1/key/encrypt/"):
+			io.WriteString(w, `{"ciphertext":"AAECAw=="}`)
+		case strings.HasPrefix(r.URL.Path, "/v1/key/decrypt/"):
+			io.WriteString(w, `{"plaintext":"AAECAw=="}`)
+		case strings.HasPrefix(r.URL.Path, "/v1/key/describe/"):
+			io.WriteString(w, `{"name":"my-key"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"message":"not found"}`)
+		}
+	})
+	serverA, serverB := httptest.NewServer(handler), httptest.NewServer(handler)
+	defer serverA.Close()
+	defer serverB.Close()
+
+	var requests uint64
+	client := &Client{HTTPClient: *serverA.Client()}
+	WithEndpoints(serverA.URL, serverB.URL)(client)
+	WithRetry(0, func(int) time.Duration { return time.Millisecond })(client)
+	WithRequestHook(func(context.Context, RequestInfo) { atomic.AddUint64(&requests, 1) })(client)
+
+	const N = 50
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, 6*N)
+		ctx  = context.Background()
+	)
+	for i := 0; i < N; i++ {
+		wg.Add(6)
+		go func() {
+			defer wg.Done()
+			_, err := client.Status(ctx)
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := client.CreateKeyIfNotExists(ctx, "my-key")
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := client.encrypt(ctx, "my-key", []byte("plaintext"), nil)
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := client.DecryptAll(ctx, "my-key", []DecryptRequest{{Ciphertext: []byte("a")}, {Ciphertext: []byte("b")}})
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := client.KeyExists(ctx, "my-key")
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			errs <- client.Enclave("my-enclave").CreateKey(ctx, "my-key")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Concurrent request failed: %v", err)
+		}
+	}
+	if n := atomic.LoadUint64(&requests); n != 7*N {
+		t.Fatalf("Invalid number of requests: got %d - want %d", n, 7*N)
+	}
+}
+
+func TestWaitReady(t *testing.T) {
+	var requests uint32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddUint32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	if err := client.WaitReady(context.Background(), time.Millisecond); err != nil {
+		t.Fatalf("Failed to wait for server: %v", err)
+	}
+	if n := atomic.LoadUint32(&requests); n != 3 {
+		t.Fatalf("Invalid number of requests: got %d - want %d", n, 3)
+	}
+
+	// A server that never becomes ready
+	server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var connErr ConnError
+	if err := client.WaitReady(ctx, 10*time.Millisecond); !errors.As(err, &connErr) {
+		t.Fatalf("Invalid error: got %v - want %T", err, connErr)
+	}
+
+	// A context that expires before the first ping
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := client.WaitReady(ctx, 0); err != context.Canceled {
+		t.Fatalf("Invalid error: got %v - want %v", err, context.Canceled)
+	}
+}
+
+var serverTimeTests = []struct {
+	Skew time.Duration
+}{
+	{Skew: 0},                 // 0
+	{Skew: 1 * time.Hour},     // 1
+	{Skew: -30 * time.Minute}, // 2
+}
+
+func TestServerTime(t *testing.T) {
+	for i, test := range serverTimeTests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Date", time.Now().Add(test.Skew).UTC().Format(http.TimeFormat))
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"version":"v0.0.0-dev"}`)
+		}))
+
+		client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+		serverTime, skew, err := client.ServerTime(context.Background())
+		server.Close()
+		if err != nil {
+			t.Fatalf("Test %d: failed to fetch server time: %v", i, err)
+		}
+		if d := skew - test.Skew; d < -time.Second || d > time.Second {
+			t.Fatalf("Test %d: invalid skew: got %v - want %v", i, skew, test.Skew)
+		}
+		if d := time.Until(serverTime) - test.Skew; d < -2*time.Second || d > 2*time.Second {
+			t.Fatalf("Test %d: invalid server time: got %v - want ~%v", i, serverTime, time.Now().Add(test.Skew))
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header()["Date"] = nil // Suppress the Date header
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	if _, _, err := client.ServerTime(context.Background()); err == nil {
+		t.Fatal("Fetching the server time should have failed")
+	}
+}
+
+func TestKeyUsage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/key/usage/my-key":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"name":"my-key","encrypt_count":5,"decrypt_count":42,"generate_count":1,"last_used":"2021-03-24T12:37:33Z"}`)
+		case "/v1/key/usage/unknown":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"message":"key does not exist"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	usage, err := client.KeyUsage(context.Background(), "my-key")
+	if err != nil {
+		t.Fatalf("Failed to fetch key usage: %v", err)
+	}
+	lastUsed := time.Date(2021, 3, 24, 12, 37, 33, 0, time.UTC)
+	if usage.Name != "my-key" || usage.EncryptCount != 5 || usage.DecryptCount != 42 || usage.GenerateCount != 1 || !usage.LastUsed.Equal(lastUsed) {
+		t.Fatalf("Invalid key usage: %+v", usage)
+	}
+
+	if _, err = client.KeyUsage(context.Background(), "unknown"); err != ErrKeyNotFound {
+		t.Fatalf("Invalid error: got %v - want %v", err, ErrKeyNotFound)
+	}
+
+	client.Endpoint = server.URL + "/old"
+	var notSupported NotSupportedError
+	if _, err = client.KeyUsage(context.Background(), "my-key"); !errors.As(err, &notSupported) {
+		t.Fatalf("Invalid error: got %v - want %T", err, notSupported)
+	}
+}
+
+func TestWithMaxConnsPerHost(t *testing.T) {
+	transport := &http.Transport{MaxIdleConnsPerHost: 2}
+	client := &Client{HTTPClient: http.Client{Transport: transport}}
+	WithMaxIdleConnsPerHost(64)(client)
+	WithMaxConnsPerHost(8)(client)
+
+	modified, ok := client.HTTPClient.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("Invalid transport: got %T - want %T", client.HTTPClient.Transport, transport)
+	}
+	if modified.MaxIdleConnsPerHost != 64 || modified.MaxConnsPerHost != 8 {
+		t.Fatalf("Invalid transport config: got MaxIdleConnsPerHost=%d MaxConnsPerHost=%d - want 64 and 8", modified.MaxIdleConnsPerHost, modified.MaxConnsPerHost)
+	}
+	if transport.MaxIdleConnsPerHost != 2 || transport.MaxConnsPerHost != 0 {
+		t.Fatal("The original transport has been modified")
+	}
+
+	client = &Client{}
+	WithMaxConnsPerHost(1)(client)
+	if modified, ok = client.HTTPClient.Transport.(*http.Transport); !ok || modified.MaxConnsPerHost != 1 {
+		t.Fatal("The default transport has not been replaced")
+	}
+	if http.DefaultTransport.(*http.Transport).MaxConnsPerHost != 0 {
+		t.Fatal("The default transport has been modified")
+	}
+}
+
+func BenchmarkConcurrentDecrypt(b *testing.B) {
+	benchmarks := []struct {
+		Name    string
+		HTTP2   bool
+		Options []ClientOption
+	}{
+		{Name: "HTTP1/MaxConnsPerHost=1", HTTP2: false, Options: []ClientOption{WithMaxConnsPerHost(1)}},
+		{Name: "HTTP1/MaxIdleConnsPerHost=2", HTTP2: false, Options: []ClientOption{WithMaxIdleConnsPerHost(2)}},
+		{Name: "HTTP1/MaxIdleConnsPerHost=64", HTTP2: false, Options: []ClientOption{WithMaxIdleConnsPerHost(64)}},
+		{Name: "HTTP2/Default", HTTP2: true},
+		{Name: "HTTP2/MaxConnsPerHost=1", HTTP2: true, Options: []ClientOption{WithMaxConnsPerHost(1)}},
+	}
+	for _, benchmark := range benchmarks {
+		benchmark := benchmark
+		b.Run(benchmark.Name, func(b *testing.B) {
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.Copy(ioutil.Discard, r.Body)
+				time.Sleep(time.Millisecond) // Simulate the server processing time
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, `{"plaintext":"AAECAw=="}`)
+			}))
+			server.EnableHTTP2 = benchmark.HTTP2
+			server.StartTLS()
+			defer server.Close()
+
+			transport := server.Client().Transport.(*http.Transport).Clone()
+			transport.ForceAttemptHTTP2 = benchmark.HTTP2
+			client := &Client{Endpoint: server.URL, HTTPClient: http.Client{Transport: transport}}
+			for _, option := range benchmark.Options {
+				option(client)
+			}
+
+			b.SetParallelism(16)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := client.decrypt(context.Background(), "my-key", []byte("ciphertext"), nil); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestCreateKeyWithAlgorithm(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Algorithm string `json:"algorithm"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path != "/v1/key/create/my-key" || request.Algorithm != "XCHACHA20-POLY1305" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	if err := client.CreateKeyWithAlgorithm(context.Background(), "my-key", XCHACHA20_POLY1305); err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+	if err := client.CreateKeyWithAlgorithm(context.Background(), "my-key", AlgorithmUnknown); err == nil {
+		t.Fatal("Creating a key with an unknown algorithm should have failed")
+	}
+}
+
+var withUserAgentTests = []struct {
+	UserAgent  string
+	Want       string
+	ShouldFail bool
+}{
+	{UserAgent: "", Want: defaultUserAgent},                         // 0
+	{UserAgent: "my-service/1.0", Want: "my-service/1.0"},           // 1
+	{UserAgent: "my-service\t(linux)", Want: "my-service\t(linux)"}, // 2
+	{UserAgent: "my-service\r\nX-Injected: 1", ShouldFail: true},    // 3
+	{UserAgent: "my-service\x00", ShouldFail: true},                 // 4
+}
+
+func TestWithUserAgent(t *testing.T) {
+	if !strings.HasPrefix(defaultUserAgent, "kes-go/") {
+		t.Fatalf("Invalid default User-Agent: got '%s' - want prefix 'kes-go/'", defaultUserAgent)
+	}
+
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+		io.WriteString(w, `{"version":"v0.0.0-dev"}`)
+	}))
+	defer server.Close()
+
+	for i, test := range withUserAgentTests {
+		userAgent = ""
+		client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+		WithUserAgent(test.UserAgent)(client)
+
+		_, err := client.Version()
+		if err == nil && test.ShouldFail {
+			t.Fatalf("Test %d: request should have failed", i)
+		}
+		if err != nil && !test.ShouldFail {
+			t.Fatalf("Test %d: request failed: %v", i, err)
+		}
+		if !test.ShouldFail && userAgent != test.Want {
+			t.Fatalf("Test %d: invalid User-Agent: got '%s' - want '%s'", i, userAgent, test.Want)
+		}
+	}
+}
+
+func TestSetRootCAs(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"version":"v0.0.0-dev"}`)
+	}))
+	defer server.Close()
+
+	trusted := x509.NewCertPool()
+	trusted.AddCert(server.Certificate())
+	untrusted := x509.NewCertPool()
+
+	client := NewClientWithConfig(server.URL, &tls.Config{RootCAs: untrusted}, WithRetry(1, nil))
+	enclave := client.Enclave("my-enclave")
+	if _, err := client.Version(); err == nil {
+		t.Fatal("Request should have failed: server certificate is not trusted")
+	}
+
+	client.SetRootCAs(trusted)
+	if _, err := client.Version(); err != nil {
+		t.Fatalf("Request failed after root CA rotation: %v", err)
+	}
+	if _, err := enclave.client.Version(); err != nil {
+		t.Fatalf("Enclave request failed after root CA rotation: %v", err)
+	}
+
+	client.SetRootCAs(untrusted)
+	if _, err := client.Version(); err == nil {
+		t.Fatal("Request should have failed: server certificate is not trusted anymore")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				client.SetRootCAs(trusted)
+			} else {
+				client.Version()
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/v1/status" {
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `{"message":"prohibited by policy"}`)
+			return
+		}
+		io.WriteString(w, `{"version":"v0.14.0","uptime":3600000000000}`)
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	state, err := client.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to fetch server status: %v", err)
+	}
+	if state.Version != "v0.14.0" || state.UpTime != time.Hour || !state.Healthy {
+		t.Fatalf("Invalid server state: %+v", *state)
+	}
+
+	client.Endpoint = server.URL + "/prefix"
+	if _, err = client.Status(context.Background()); err != ErrNotAllowed {
+		t.Fatalf("Invalid error: got %v - want %v", err, ErrNotAllowed)
+	}
+
+	server.Close()
+	client.Endpoint = server.URL
+	_, err = client.Status(context.Background())
+	if connErr, ok := err.(ConnError); !ok || connErr.Endpoint != server.URL {
+		t.Fatalf("Invalid error: got %v - want a connection error", err)
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/v1/identity/self/describe" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, `{"identity":"dd46485b","policy":"my-policy"}`)
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	info, err := client.Identity(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to describe identity: %v", err)
+	}
+	if info.Identity != "dd46485b" || info.Policy != "my-policy" || info.IsAdmin {
+		t.Fatalf("Invalid identity info: %+v", *info)
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	policies := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Base(r.URL.Path)
+		switch path.Dir(r.URL.Path) {
+		case "/v1/policy/write":
+			policies[name], _ = ioutil.ReadAll(r.Body)
+		case "/v1/policy/read":
+			policy, ok := policies[name]
+			if !ok {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusNotFound)
+				io.WriteString(w, `{"message":"policy does not exist"}`)
+				return
+			}
+			w.Write(policy)
+		case "/v1/policy/list":
+			names := []string{}
+			for policy := range policies {
+				if ok, _ := path.Match(name, policy); ok {
+					names = append(names, policy)
+				}
+			}
+			json.NewEncoder(w).Encode(names)
+		case "/v1/policy/delete":
+			delete(policies, name)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+
+	policy, _ := NewPolicy("/v1/key/create/my-app*")
+	if err := policy.Deny("/v1/key/create/my-app-prod*"); err != nil {
+		t.Fatalf("Failed to deny paths: %v", err)
+	}
+	if err := client.SetPolicy(ctx, "my-app", policy); err != nil {
+		t.Fatalf("Failed to set policy: %v", err)
+	}
+	if err := client.SetPolicy(ctx, "other-app", policy); err != nil {
+		t.Fatalf("Failed to set policy: %v", err)
+	}
+
+	p, err := client.GetPolicy(ctx, "my-app")
+	if err != nil {
+		t.Fatalf("Failed to get policy: %v", err)
+	}
+	if allowed, denied := p.Allowed(), p.Denied(); len(allowed) != 1 || allowed[0] != "/v1/key/create/my-app*" || len(denied) != 1 || denied[0] != "/v1/key/create/my-app-prod*" {
+		t.Fatalf("Invalid policy: got %v", p)
+	}
+
+	iterator, err := client.ListPolicies(ctx, "my-*")
+	if err != nil {
+		t.Fatalf("Failed to list policies: %v", err)
+	}
+	var names []string
+	for iterator.Next() {
+		names = append(names, iterator.Name())
+	}
+	if err = iterator.Err(); err != nil {
+		t.Fatalf("Failed to list policies: %v", err)
+	}
+	if len(names) != 1 || names[0] != "my-app" {
+		t.Fatalf("Invalid policy list: got %v - want %v", names, []string{"my-app"})
+	}
+
+	// The pattern must match the entire policy name.
+	if iterator, err = client.ListPolicies(ctx, "my-"); err != nil {
+		t.Fatalf("Failed to list policies: %v", err)
+	}
+	if iterator.Next() {
+		t.Fatalf("Pattern 'my-' matched policy '%s'", iterator.Name())
+	}
+	if err = iterator.Err(); err != nil {
+		t.Fatalf("Failed to list policies: %v", err)
+	}
+
+	if err = client.DeletePolicy(ctx, "my-app"); err != nil {
+		t.Fatalf("Failed to delete policy: %v", err)
+	}
+	if _, err = client.GetPolicy(ctx, "my-app"); err != ErrPolicyNotFound {
+		t.Fatalf("Invalid error: got %v - want %v", err, ErrPolicyNotFound)
+	}
+}
+
+func TestIdentities(t *testing.T) {
+	identities := map[Identity]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/identity/assign/"):
+			identities[Identity(path.Base(r.URL.Path))] = path.Base(path.Dir(r.URL.Path))
+		case strings.HasPrefix(r.URL.Path, "/v1/identity/list/"):
+			response := map[Identity]string{}
+			for id, policy := range identities {
+				if ok, _ := path.Match(path.Base(r.URL.Path), id.String()); ok {
+					response[id] = policy
+				}
+			}
+			json.NewEncoder(w).Encode(response)
+		case strings.HasPrefix(r.URL.Path, "/v1/identity/forget/"):
+			delete(identities, Identity(path.Base(r.URL.Path)))
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	for _, id := range []Identity{"af43c", "af12b", "dd46485b"} {
+		if err := client.AssignIdentity(ctx, "my-policy", id); err != nil {
+			t.Fatalf("Failed to assign identity %q: %v", id, err)
+		}
+	}
+	if err := client.DeleteIdentity(ctx, "af12b"); err != nil {
+		t.Fatalf("Failed to delete identity: %v", err)
+	}
+
+	iterator, err := client.ListIdentities(ctx, "af*")
+	if err != nil {
+		t.Fatalf("Failed to list identities: %v", err)
+	}
+	var list []IdentityDescription
+	for iterator.Next() {
+		list = append(list, iterator.Value())
+	}
+	if err = iterator.Err(); err != nil {
+		t.Fatalf("Failed to list identities: %v", err)
+	}
+	if len(list) != 1 || list[0].Identity != "af43c" || list[0].Policy != "my-policy" {
+		t.Fatalf("Invalid identity list: got %v", list)
+	}
+
+	if err = client.ForgetIdentity("af43c"); err != nil {
+		t.Fatalf("Failed to forget identity: %v", err)
+	}
+	if _, ok := identities["af43c"]; ok {
+		t.Fatal("Identity has not been removed")
+	}
+}
+
+var policyIteratorTests = []struct {
+	Response   string
+	Policies   []string
+	ShouldFail bool
+}{
+	{Response: `[]`}, // 0
+	{Response: `["my-policy"]`, Policies: []string{"my-policy"}},                       // 1
+	{Response: `["my-policy","other"]`, Policies: []string{"my-policy", "other"}},      // 2
+	{Response: `["my-policy","oth`, Policies: []string{"my-policy"}, ShouldFail: true}, // 3
+	{Response: `{"my-policy":1}`, ShouldFail: true},                                    // 4
+	{Response: `[1]`, ShouldFail: true},                                                // 5
+}
+
+func TestPolicyIterator(t *testing.T) {
+	for i, test := range policyIteratorTests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, test.Response)
+		}))
+
+		client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+		iterator, err := client.ListPolicies(context.Background(), "")
+		if err != nil {
+			t.Fatalf("Test %d: failed to list policies: %v", i, err)
+		}
+		var names []string
+		for iterator.Next() {
+			names = append(names, iterator.Name())
+		}
+		err = iterator.Err()
+		server.Close()
+
+		if test.ShouldFail && err == nil {
+			t.Fatalf("Test %d: iterator should have failed", i)
+		}
+		if !test.ShouldFail && err != nil {
+			t.Fatalf("Test %d: iterator failed: %v", i, err)
+		}
+		if fmt.Sprint(names) != fmt.Sprint(test.Policies) {
+			t.Fatalf("Test %d: got %v - want %v", i, names, test.Policies)
+		}
+	}
+}
+
+var identityIteratorTests = []struct {
+	Response   string
+	Identities []IdentityDescription
+	ShouldFail bool
+}{
+	{Response: `{}`}, // 0
+	{Response: `{"af43c":"my-policy"}`, Identities: []IdentityDescription{{"af43c", "my-policy"}}}, // 1
+	{ // 2
+		Response:   `{"af43c":"my-policy","dd46485b":"other-policy"}`,
+		Identities: []IdentityDescription{{"af43c", "my-policy"}, {"dd46485b", "other-policy"}},
+	},
+	{Response: `{"af43c":"my-policy","dd46`, Identities: []IdentityDescription{{"af43c", "my-policy"}}, ShouldFail: true}, // 3
+	{Response: `["af43c"]`, ShouldFail: true},   // 4
+	{Response: `{"af43c":1}`, ShouldFail: true}, // 5
+}
+
+func TestIdentityIterator(t *testing.T) {
+	for i, test := range identityIteratorTests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, test.Response)
+		}))
+
+		client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+		iterator, err := client.ListIdentities(context.Background(), "")
+		if err != nil {
+			t.Fatalf("Test %d: failed to list identities: %v", i, err)
+		}
+		var list []IdentityDescription
+		for iterator.Next() {
+			list = append(list, iterator.Value())
+		}
+		err = iterator.Err()
+		server.Close()
+
+		if test.ShouldFail && err == nil {
+			t.Fatalf("Test %d: iterator should have failed", i)
+		}
+		if !test.ShouldFail && err != nil {
+			t.Fatalf("Test %d: iterator failed: %v", i, err)
+		}
+		if fmt.Sprint(list) != fmt.Sprint(test.Identities) {
+			t.Fatalf("Test %d: got %v - want %v", i, list, test.Identities)
+		}
+	}
+}
+
+func TestReWrap(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, path.Dir(r.URL.Path))
+		if name := path.Base(r.URL.Path); name != "my-key" && name != "unversioned-key" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"message":"key does not exist"}`)
+			return
+		}
+		switch path.Dir(r.URL.Path) {
+		case "/v1/key/rewrap":
+			http.NotFound(w, r) // Simulate a server without re-wrap support
+		case "/v1/key/decrypt":
+			if path.Base(r.URL.Path) == "unversioned-key" {
+				io.WriteString(w, `{"plaintext":"cGxhaW50ZXh0"}`)
+				return
+			}
+			io.WriteString(w, `{"plaintext":"cGxhaW50ZXh0","key_version":1}`)
+		case "/v1/key/encrypt":
+			io.WriteString(w, `{"ciphertext":"bmV3LWNpcGhlcnRleHQ="}`)
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	ciphertext, err := client.ReWrap(context.Background(), "my-key", []byte("ciphertext"), nil)
+	if err != nil {
+		t.Fatalf("Failed to re-wrap ciphertext: %v", err)
+	}
+	if string(ciphertext) != "new-ciphertext" {
+		t.Fatalf("Invalid ciphertext: got %q - want %q", ciphertext, "new-ciphertext")
+	}
+	if want := []string{"/v1/key/rewrap", "/v1/key/decrypt", "/v1/key/encrypt"}; fmt.Sprint(requests) != fmt.Sprint(want) {
+		t.Fatalf("Invalid requests: got %v - want %v", requests, want)
+	}
+
+	requests = nil
+	if _, err = client.ReWrap(context.Background(), "other-key", []byte("ciphertext"), nil); err != ErrKeyNotFound {
+		t.Fatalf("Invalid error: got %v - want %v", err, ErrKeyNotFound)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("Invalid requests: got %v - want only one re-wrap request", requests)
+	}
+
+	requests = nil
+	_, err = client.ReWrap(context.Background(), "unversioned-key", []byte("ciphertext"), nil)
+	if err != (KeyVersioningError{Key: "unversioned-key"}) {
+		t.Fatalf("Invalid error: got %v - want %v", err, KeyVersioningError{Key: "unversioned-key"})
+	}
+	if want := []string{"/v1/key/rewrap", "/v1/key/decrypt"}; fmt.Sprint(requests) != fmt.Sprint(want) {
+		t.Fatalf("Invalid requests: got %v - want %v", requests, want)
+	}
+}
+
+var reWrapVersionTests = []struct {
+	Response string
+	Err      error
+}{
+	{Response: `{"ciphertext":"bmV3LWNpcGhlcnRleHQ=","key_version":2}`},                         // 0
+	{Response: `{"ciphertext":"bmV3LWNpcGhlcnRleHQ="}`, Err: KeyVersioningError{Key: "my-key"}}, // 1
+}
+
+func TestReWrapVersion(t *testing.T) {
+	for i, test := range reWrapVersionTests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, test.Response)
+		}))
+
+		client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+		_, err := client.ReWrap(context.Background(), "my-key", []byte("ciphertext"), nil)
+		server.Close()
+		if err != test.Err {
+			t.Fatalf("Test %d: invalid error: got %v - want %v", i, err, test.Err)
+		}
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/key/generate/my-key" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"message":"key does not exist"}`)
+			return
+		}
+		io.WriteString(w, `{"plaintext":"cGxhaW50ZXh0","ciphertext":"Y2lwaGVydGV4dA=="}`)
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	dek, err := client.GenerateKey(context.Background(), "my-key", nil)
+	if err != nil {
+		t.Fatalf("Failed to generate DEK: %v", err)
+	}
+	if string(dek.Plaintext) != "plaintext" || string(dek.Ciphertext) != "ciphertext" {
+		t.Fatalf("Invalid DEK: got %q / %q - want %q / %q", dek.Plaintext, dek.Ciphertext, "plaintext", "ciphertext")
+	}
+
+	plaintext := dek.Plaintext
+	dek.Wipe()
+	if dek.Plaintext != nil {
+		t.Fatalf("DEK plaintext has not been removed: %q", dek.Plaintext)
+	}
+	if !bytes.Equal(plaintext, make([]byte, len(plaintext))) {
+		t.Fatalf("DEK plaintext has not been zeroed: %q", plaintext)
+	}
+	if string(dek.Ciphertext) != "ciphertext" {
+		t.Fatalf("DEK ciphertext has been modified: %q", dek.Ciphertext)
+	}
+
+	if _, err = client.GenerateKey(context.Background(), "other-key", nil); err != ErrKeyNotFound {
+		t.Fatalf("Invalid error: got %v - want %v", err, ErrKeyNotFound)
+	}
+}
+
+func TestWipe(t *testing.T) {
+	b := []byte("sensitive key material")
+	Wipe(b)
+	if !bytes.Equal(b, make([]byte, len(b))) {
+		t.Fatalf("Slice has not been zeroed: %q", b)
+	}
+	Wipe(nil) // Must not panic
+}
+
+func TestEnclave(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if enclave := r.URL.Query().Get("enclave"); enclave != "" && enclave != "tenant-1" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"message":"enclave does not exist"}`)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string][]byte{"plaintext": []byte(r.URL.Query().Get("enclave"))})
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	enclave := client.Enclave("tenant-1")
+	if name := enclave.Name(); name != "tenant-1" {
+		t.Fatalf("Invalid enclave name: got %q - want %q", name, "tenant-1")
+	}
+
+	plaintext, err := enclave.Decrypt(context.Background(), "my-key", nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to decrypt within enclave: %v", err)
+	}
+	if string(plaintext) != "tenant-1" {
+		t.Fatal("Request has not been sent to the enclave")
+	}
+	if plaintext, err = client.decrypt(context.Background(), "my-key", nil, nil); err != nil || len(plaintext) != 0 {
+		t.Fatalf("Parent client request has been sent to an enclave: %v", err)
+	}
+
+	if err = client.Enclave("tenant-2").CreateKey(context.Background(), "my-key"); err != ErrEnclaveNotFound {
+		t.Fatalf("Invalid error: got %v - want %v", err, ErrEnclaveNotFound)
+	}
+}
+
+func TestPing(t *testing.T) {
+	var unhealthy bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead || r.URL.Path != "/v1/status" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if unhealthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	if err := client.Ping(context.Background()); err != nil {
+		t.Fatalf("Failed to ping server: %v", err)
+	}
+
+	unhealthy = true
+	if err := client.Ping(context.Background()); err == nil {
+		t.Fatal("Ping succeeded but server is unhealthy")
+	}
+
+	server.Close()
+	if err := client.Ping(context.Background()); !errors.As(err, new(ConnError)) {
+		t.Fatalf("Invalid error: got %v - want a connection error", err)
+	}
+}
+
+var metricsTests = []struct {
+	Response string
+	Metric   Metric
+}{
+	{ // 0
+		Response: `# TYPE kes_http_request_success counter
+kes_http_request_success 10
+# TYPE kes_http_request_error counter
+kes_http_request_error 2
+# TYPE kes_http_request_failure counter
+kes_http_request_failure 1
+# TYPE kes_http_request_active gauge
+kes_http_request_active 3
+# TYPE kes_log_audit_events counter
+kes_log_audit_events 13
+`,
+		Metric: Metric{RequestOK: 10, RequestErr: 2, RequestFail: 1, RequestActive: 3, AuditEvents: 13},
+	},
+	{ // 1
+		Response: `# TYPE kes_http_request_success counter
+kes_http_request_success 10
+`,
+		Metric: Metric{RequestOK: 10},
+	},
+	{ // 2
+		Response: ``,
+		Metric:   Metric{},
+	},
+}
+
+func TestMetrics(t *testing.T) {
+	for i, test := range metricsTests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			io.WriteString(w, test.Response)
+		}))
+
+		client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+		metric, err := client.Metrics(context.Background())
+		server.Close()
+		if err != nil {
+			t.Fatalf("Test %d: failed to fetch metrics: %v", i, err)
+		}
+		if metric.RequestOK != test.Metric.RequestOK || metric.RequestErr != test.Metric.RequestErr || metric.RequestFail != test.Metric.RequestFail {
+			t.Fatalf("Test %d: invalid request metrics: got %+v - want %+v", i, *metric, test.Metric)
+		}
+		if metric.RequestActive != test.Metric.RequestActive {
+			t.Fatalf("Test %d: got %d active requests - want %d", i, metric.RequestActive, test.Metric.RequestActive)
+		}
+		if metric.AuditEvents != test.Metric.AuditEvents {
+			t.Fatalf("Test %d: got %d audit events - want %d", i, metric.AuditEvents, test.Metric.AuditEvents)
+		}
+	}
+}
+
+func TestDecryptAll(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Ciphertext []byte `json:"ciphertext"`
+			Context    []byte `json:"context"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !bytes.Equal(request.Context, []byte("tenant")) { // Reject any other context
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"message":"ciphertext is not authentic"}`)
+			return
+		}
+		json.NewEncoder(w).Encode(struct {
+			Plaintext []byte `json:"plaintext"`
+		}{Plaintext: bytes.ToUpper(request.Ciphertext)})
+	}))
+	defer server.Close()
+
+	var items []DecryptRequest
+	for i := 0; i < 40; i++ {
+		item := DecryptRequest{Ciphertext: []byte(fmt.Sprintf("item-%d", i))}
+		if i%4 != 0 {
+			item.Context = []byte("tenant")
+		}
+		items = append(items, item)
+	}
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	results, err := client.DecryptAll(context.Background(), "my-key", items)
+	if err != nil {
+		t.Fatalf("Failed to decrypt items: %v", err)
+	}
+	if len(results) != len(items) {
+		t.Fatalf("Invalid number of results: got %d - want %d", len(results), len(items))
+	}
+	for i, result := range results {
+		if i%4 == 0 {
+			if result.Err != ErrDecrypt {
+				t.Fatalf("Result %d: got error %v - want %v", i, result.Err, ErrDecrypt)
+			}
+			continue
+		}
+		if result.Err != nil {
+			t.Fatalf("Result %d: failed to decrypt item: %v", i, result.Err)
+		}
+		if plaintext := bytes.ToUpper(items[i].Ciphertext); !bytes.Equal(result.Plaintext, plaintext) {
+			t.Fatalf("Result %d: got plaintext %s - want %s", i, result.Plaintext, plaintext)
+		}
+	}
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	config := &tls.Config{ServerName: "kes.local"}
+	custom := &http.Client{
+		Transport: &http.Transport{MaxIdleConnsPerHost: 42},
+		Timeout:   5 * time.Second,
+	}
+
+	client := NewClientWithConfig("https://127.0.0.1:7373", config, WithHTTPClient(custom))
+	if client.HTTPClient.Timeout != custom.Timeout {
+		t.Fatalf("Custom HTTP client has not been applied: got timeout %v - want %v", client.HTTPClient.Timeout, custom.Timeout)
+	}
+	transport, ok := client.HTTPClient.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("Invalid transport: got %T - want %T", client.HTTPClient.Transport, transport)
+	}
+	if transport.MaxIdleConnsPerHost != 42 {
+		t.Fatalf("Custom transport has not been applied: got %d - want %d", transport.MaxIdleConnsPerHost, 42)
+	}
+	if transport.TLSClientConfig != config {
+		t.Fatal("TLS config has not been applied to custom transport")
+	}
+	if custom.Transport.(*http.Transport).TLSClientConfig == config {
+		t.Fatal("Custom transport has been modified")
+	}
+
+	custom = &http.Client{Transport: http.NewFileTransport(http.Dir("."))}
+	client = NewClientWithConfig("https://127.0.0.1:7373", config, WithHTTPClient(custom))
+	if client.HTTPClient.Transport != custom.Transport {
+		t.Fatal("Custom http.RoundTripper has been replaced")
+	}
+}
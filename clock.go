@@ -0,0 +1,61 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import "time"
+
+// Clock is a source of time. Time-based stream features,
+// like idle timeouts, deduplication windows and re-connect
+// delays, use a Clock to read the current time and to wait.
+//
+// By default, the wall clock is used. Tests can provide a
+// Clock that advances manually to check time-based behavior
+// deterministically and without sleeping. See: WithClock and
+// WithReconnectClock.
+//
+// A Clock must be safe for concurrent use.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTimer returns a new Timer that sends the
+	// current time on its channel after at least
+	// duration d.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a timer created by a Clock.
+type Timer interface {
+	// C returns the channel on which the
+	// time is sent once the timer fires.
+	C() <-chan time.Time
+
+	// Stop prevents the Timer from firing. It
+	// returns false if the timer has already
+	// fired or been stopped.
+	Stop() bool
+}
+
+// wallClock is the Clock that uses the
+// time package - i.e. the wall clock.
+type wallClock struct{}
+
+func (wallClock) Now() time.Time { return time.Now() }
+
+func (wallClock) NewTimer(d time.Duration) Timer { return wallTimer{time.NewTimer(d)} }
+
+// wallTimer is the Timer of the wallClock.
+type wallTimer struct{ *time.Timer }
+
+func (t wallTimer) C() <-chan time.Time { return t.Timer.C }
+
+// clockOrDefault returns c or, if c is nil,
+// the wall clock.
+func clockOrDefault(c Clock) Clock {
+	if c == nil {
+		return wallClock{}
+	}
+	return c
+}
@@ -0,0 +1,183 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock that only advances
+// when its Advance method gets called.
+type fakeClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+
+	created chan struct{} // receives a value whenever a timer is created
+}
+
+var _ Clock = (*fakeClock)(nil)
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now:     time.Date(2021, 3, 24, 12, 0, 0, 0, time.UTC),
+		created: make(chan struct{}, 100),
+	}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	t := &fakeTimer{
+		clock: c,
+		when:  c.now.Add(d),
+		c:     make(chan time.Time, 1),
+	}
+	c.timers = append(c.timers, t)
+	c.created <- struct{}{}
+	return t
+}
+
+// Advance advances the clock by d and fires
+// all timers that expire until then.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = c.now.Add(d)
+	for _, t := range c.timers {
+		if !t.done && !t.when.After(c.now) {
+			t.done = true
+			t.c <- c.now
+		}
+	}
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	when  time.Time
+	done  bool // true once the timer has fired or been stopped
+	c     chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	stopped := !t.done
+	t.done = true
+	return stopped
+}
+
+func TestWithClockIdleTimeout(t *testing.T) {
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	go io.WriteString(writer, `{"message":"a"}`+"\n")
+
+	clock := newFakeClock()
+	stream := NewErrorStream(reader, WithIdleTimeout(time.Hour), WithClock(clock))
+	go func() {
+		<-clock.created // The idle timer of the first event
+		clock.Advance(time.Minute)
+		<-clock.created // The idle timer of the second event
+		clock.Advance(time.Hour)
+	}()
+
+	if !stream.Next() {
+		t.Fatalf("Failed to read event: %v", stream.Err())
+	}
+	if stream.Next() {
+		t.Fatal("Next returned true after idle timeout")
+	}
+	if err := stream.Err(); err != ErrIdleTimeout {
+		t.Fatalf("Invalid error: got %v - want %v", err, ErrIdleTimeout)
+	}
+}
+
+func TestWithClockDedup(t *testing.T) {
+	const Events = `{"message":"a"}
+{"message":"a"}
+{"message":"a"}`
+
+	clock := newFakeClock()
+	stream := NewErrorStream(strings.NewReader(Events), WithClock(clock)).Dedup(time.Minute)
+	if !stream.Next() {
+		t.Fatalf("Failed to read event: %v", stream.Err())
+	}
+
+	// The window has expired. Hence, the event is not suppressed.
+	clock.Advance(2 * time.Minute)
+	if !stream.Next() {
+		t.Fatalf("Failed to read event: %v", stream.Err())
+	}
+	if n := stream.RepeatCount(); n != 0 {
+		t.Fatalf("Invalid repeat count: got %d - want %d", n, 0)
+	}
+
+	// The window has not expired. Hence, the event is suppressed
+	// and reported once the stream reaches its end.
+	clock.Advance(30 * time.Second)
+	if !stream.Next() {
+		t.Fatalf("Failed to read event: %v", stream.Err())
+	}
+	if n := stream.RepeatCount(); n != 1 {
+		t.Fatalf("Invalid repeat count: got %d - want %d", n, 1)
+	}
+	if stream.Next() {
+		t.Fatal("Next returned true at the end of the stream")
+	}
+}
+
+func TestWithReconnectClock(t *testing.T) {
+	connections := []string{`{"message":"a"}` + "\n", `{"message":"b"}` + "\n"}
+	connect := func(context.Context) (io.ReadCloser, error) {
+		if len(connections) == 0 {
+			return nil, ErrNotAllowed
+		}
+		conn := connections[0]
+		connections = connections[1:]
+		return ioutil.NopCloser(&brokenReader{Reader: strings.NewReader(conn), Err: errConnectionReset}), nil
+	}
+
+	clock := newFakeClock()
+	stream := NewErrorStream(newReconnectReader(context.Background(), connect, []RetryOption{
+		WithBackoff(time.Hour, time.Hour),
+		WithReconnectClock(clock),
+	}))
+	if !stream.Next() {
+		t.Fatalf("Failed to read event: %v", stream.Err())
+	}
+
+	start := clock.Now()
+	go func() {
+		<-clock.created // The re-connect delay
+		clock.Advance(time.Hour)
+	}()
+	if !stream.Next() {
+		t.Fatalf("Failed to read event: %v", stream.Err())
+	}
+	gapStart, gapEnd, missed := stream.LastGap()
+	if !missed {
+		t.Fatal("Stream did not report a gap after re-connecting")
+	}
+	if !gapStart.Equal(start) || !gapEnd.Equal(start.Add(time.Hour)) {
+		t.Fatalf("Invalid gap: got %v - %v - want %v - %v", gapStart, gapEnd, start, start.Add(time.Hour))
+	}
+}
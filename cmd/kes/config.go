@@ -43,6 +43,7 @@ type serverConfig struct {
 
 	Policies map[string]struct {
 		Paths      []string       `yaml:"paths"`
+		Deny       []string       `yaml:"deny"`
 		Identities []kes.Identity `yaml:"identities"`
 	} `yaml:"policy"`
 
@@ -5,11 +5,11 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	stdlog "log"
 	"os"
-	"sort"
 
 	"github.com/minio/kes"
 )
@@ -88,7 +88,7 @@ func assignIdentity(args []string) {
 		identity = kes.Identity(cli.Arg(0))
 		policy   = cli.Arg(1)
 	)
-	if err := client.AssignIdentity(policy, identity); err != nil {
+	if err := client.AssignIdentity(context.Background(), policy, identity); err != nil {
 		stdlog.Fatalf("Error: failed to assign identity %q to policy %q: %v", identity, policy, err)
 	}
 }
@@ -126,15 +126,21 @@ func listIdentity(args []string) {
 		pattern = cli.Arg(0)
 	}
 
-	identityRoles, err := newClient(insecureSkipVerify).ListIdentities(pattern)
+	iterator, err := newClient(insecureSkipVerify).ListIdentities(context.Background(), pattern)
 	if err != nil {
 		stdlog.Fatalf("Error: failed to list identities matching %q: %v", pattern, err)
 	}
-	identities := make([]string, 0, len(identityRoles))
-	for id := range identityRoles {
-		identities = append(identities, id.String())
+	var (
+		identities    []string
+		identityRoles = map[kes.Identity]string{}
+	)
+	for iterator.Next() {
+		identities = append(identities, iterator.Identity().String())
+		identityRoles[iterator.Identity()] = iterator.Policy()
+	}
+	if err = iterator.Err(); err != nil {
+		stdlog.Fatalf("Error: failed to list identities matching %q: %v", pattern, err)
 	}
-	sort.Strings(identities)
 
 	if isTerm(os.Stdout) {
 		fmt.Println("{")
@@ -191,7 +197,7 @@ func forgetIdentity(args []string) {
 		client   = newClient(insecureSkipVerify)
 		identity = kes.Identity(cli.Arg(0))
 	)
-	if err := client.ForgetIdentity(identity); err != nil {
+	if err := client.DeleteIdentity(context.Background(), identity); err != nil {
 		stdlog.Fatalf("Error: failed to forget identity %q: %v", identity, err)
 	}
 }
@@ -100,7 +100,7 @@ func createKey(args []string) {
 
 	client := newClient(insecureSkipVerify)
 	if len(bytes) > 0 {
-		if err := client.ImportKey(name, bytes); err != nil {
+		if err := client.ImportKey(context.Background(), name, bytes); err != nil {
 			stdlog.Fatalf("Error: failed to import key %q: %v", name, err)
 		}
 	} else {
@@ -210,21 +210,22 @@ func deriveKey(args []string) {
 	}
 
 	var (
-		name    string = cli.Arg(0)
-		context []byte
+		name          string = cli.Arg(0)
+		cryptoContext []byte
 	)
 	if cli.NArg() == 2 {
 		b, err := base64.StdEncoding.DecodeString(cli.Arg(1))
 		if err != nil {
 			stdlog.Fatalf("Error: invalid context: %v", err)
 		}
-		context = b
+		cryptoContext = b
 	}
 
-	key, err := newClient(insecureSkipVerify).GenerateKey(name, context)
+	key, err := newClient(insecureSkipVerify).GenerateKey(context.Background(), name, cryptoContext)
 	if err != nil {
 		stdlog.Fatalf("Error: failed to derive key: %v", err)
 	}
+	defer key.Wipe()
 
 	if isTerm(os.Stdout) {
 		fmt.Println("{")
@@ -5,6 +5,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
@@ -94,7 +95,7 @@ func logTrace(args []string) {
 	client := newClient(insecureSkipVerify)
 	switch strings.ToLower(typeFlag) {
 	case "audit":
-		stream, err := client.AuditLog()
+		stream, err := client.AuditLog(context.Background())
 		if err != nil {
 			stdlog.Fatalf("Error: failed to connect to audit log: %v", err)
 		}
@@ -110,7 +111,7 @@ func logTrace(args []string) {
 		}
 		traceAuditLogWithUI(stream)
 	case "error":
-		stream, err := client.ErrorLog()
+		stream, err := client.ErrorLog(context.Background())
 		if err != nil {
 			stdlog.Fatalf("Error: failed to connect to error log: %v", err)
 		}
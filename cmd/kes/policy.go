@@ -5,6 +5,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -105,7 +106,7 @@ func addPolicy(args []string) {
 	}
 
 	client := newClient(insecureSkipVerify)
-	if err := client.SetPolicy(name, &policy); err != nil {
+	if err := client.SetPolicy(context.Background(), name, &policy); err != nil {
 		stdlog.Fatalf("Error: failed to add policy %q: %v", name, err)
 	}
 }
@@ -141,7 +142,7 @@ func showPolicy(args []string) {
 
 	var name = cli.Arg(0)
 	client := newClient(insecureSkipVerify)
-	policy, err := client.GetPolicy(name)
+	policy, err := client.GetPolicy(context.Background(), name)
 	if err != nil {
 		stdlog.Fatalf("Error: failed to fetch policy %q: %v", name, err)
 	}
@@ -185,10 +186,17 @@ func listPolicies(args []string) {
 		pattern = cli.Arg(0)
 	}
 
-	policies, err := newClient(insecureSkipVerify).ListPolicies(pattern)
+	iterator, err := newClient(insecureSkipVerify).ListPolicies(context.Background(), pattern)
 	if err != nil {
 		stdlog.Fatalf("Error: failed to list policies matching %q: %v", pattern, err)
 	}
+	var policies = []string{}
+	for iterator.Next() {
+		policies = append(policies, iterator.Name())
+	}
+	if err = iterator.Err(); err != nil {
+		stdlog.Fatalf("Error: failed to list policies matching %q: %v", pattern, err)
+	}
 	sort.Strings(policies)
 	if isTerm(os.Stdout) {
 		fmt.Println("[")
@@ -231,7 +239,7 @@ func deletePolicy(args []string) {
 	}
 
 	var name = cli.Arg(0)
-	if err := newClient(insecureSkipVerify).DeletePolicy(name); err != nil {
+	if err := newClient(insecureSkipVerify).DeletePolicy(context.Background(), name); err != nil {
 		stdlog.Fatalf("Error: failed to delete policy %q: %v", name, err)
 	}
 }
@@ -82,6 +82,8 @@ Examples:
 `
 
 func server(args []string) {
+	startTime := time.Now()
+
 	cli := flag.NewFlagSet(args[0], flag.ExitOnError)
 	cli.Usage = func() { fmt.Fprint(os.Stderr, serverCmdUsage) }
 
@@ -188,6 +190,9 @@ func server(args []string) {
 		if err != nil {
 			stdlog.Fatalf("Error: policy %q contains invalid glob patterns: %v", name, err)
 		}
+		if err = p.Deny(policy.Deny...); err != nil {
+			stdlog.Fatalf("Error: policy %q contains invalid glob patterns: %v", name, err)
+		}
 		roles.Set(name, p)
 
 		for _, identity := range policy.Identities {
@@ -211,13 +216,16 @@ func server(args []string) {
 
 	const MaxBody = 1 << 20 // 1 MiB
 	metrics := metric.New()
+	auditLog.Add(metrics.AuditEventCounter())
 	mux := http.NewServeMux()
 	mux.Handle("/v1/key/create/", xhttp.Timeout(15*time.Second, metrics.Count(metrics.Latency(xhttp.AuditLog(auditLog.Log(), roles, xhttp.EnforceHTTP2(xhttp.RequireMethod(http.MethodPost, xhttp.ValidatePath("/v1/key/create/*", xhttp.LimitRequestBody(0, xhttp.TLSProxy(proxy, xhttp.EnforcePolicies(roles, xhttp.HandleCreateKey(store))))))))))))
 	mux.Handle("/v1/key/import/", xhttp.Timeout(15*time.Second, metrics.Count(metrics.Latency(xhttp.AuditLog(auditLog.Log(), roles, xhttp.EnforceHTTP2(xhttp.RequireMethod(http.MethodPost, xhttp.ValidatePath("/v1/key/import/*", xhttp.LimitRequestBody(MaxBody, xhttp.TLSProxy(proxy, xhttp.EnforcePolicies(roles, xhttp.HandleImportKey(store))))))))))))
 	mux.Handle("/v1/key/delete/", xhttp.Timeout(15*time.Second, metrics.Count(metrics.Latency(xhttp.AuditLog(auditLog.Log(), roles, xhttp.EnforceHTTP2(xhttp.RequireMethod(http.MethodDelete, xhttp.ValidatePath("/v1/key/delete/*", xhttp.LimitRequestBody(0, xhttp.TLSProxy(proxy, xhttp.EnforcePolicies(roles, xhttp.HandleDeleteKey(store))))))))))))
+	mux.Handle("/v1/key/describe/", xhttp.Timeout(15*time.Second, metrics.Count(metrics.Latency(xhttp.AuditLog(auditLog.Log(), roles, xhttp.EnforceHTTP2(xhttp.RequireMethod(http.MethodGet, xhttp.ValidatePath("/v1/key/describe/*", xhttp.LimitRequestBody(0, xhttp.TLSProxy(proxy, xhttp.EnforcePolicies(roles, xhttp.HandleDescribeKey(store))))))))))))
 	mux.Handle("/v1/key/generate/", xhttp.Timeout(15*time.Second, metrics.Count(metrics.Latency(xhttp.AuditLog(auditLog.Log(), roles, xhttp.EnforceHTTP2(xhttp.RequireMethod(http.MethodPost, xhttp.ValidatePath("/v1/key/generate/*", xhttp.LimitRequestBody(MaxBody, xhttp.TLSProxy(proxy, xhttp.EnforcePolicies(roles, xhttp.HandleGenerateKey(store))))))))))))
 	mux.Handle("/v1/key/encrypt/", xhttp.Timeout(15*time.Second, metrics.Count(metrics.Latency(xhttp.AuditLog(auditLog.Log(), roles, xhttp.EnforceHTTP2(xhttp.RequireMethod(http.MethodPost, xhttp.ValidatePath("/v1/key/encrypt/*", xhttp.LimitRequestBody(MaxBody/2, xhttp.TLSProxy(proxy, xhttp.EnforcePolicies(roles, xhttp.HandleEncryptKey(store))))))))))))
 	mux.Handle("/v1/key/decrypt/", xhttp.Timeout(15*time.Second, metrics.Count(metrics.Latency(xhttp.AuditLog(auditLog.Log(), roles, xhttp.EnforceHTTP2(xhttp.RequireMethod(http.MethodPost, xhttp.ValidatePath("/v1/key/decrypt/*", xhttp.LimitRequestBody(MaxBody, xhttp.TLSProxy(proxy, xhttp.EnforcePolicies(roles, xhttp.HandleDecryptKey(store))))))))))))
+	mux.Handle("/v1/key/rewrap/", xhttp.Timeout(15*time.Second, metrics.Count(metrics.Latency(xhttp.AuditLog(auditLog.Log(), roles, xhttp.EnforceHTTP2(xhttp.RequireMethod(http.MethodPost, xhttp.ValidatePath("/v1/key/rewrap/*", xhttp.LimitRequestBody(MaxBody, xhttp.TLSProxy(proxy, xhttp.EnforcePolicies(roles, xhttp.HandleReWrapKey(store))))))))))))
 	mux.Handle("/v1/key/list/", xhttp.Timeout(15*time.Second, metrics.Count(metrics.Latency(xhttp.AuditLog(auditLog.Log(), roles, xhttp.EnforceHTTP2(xhttp.RequireMethod(http.MethodGet, xhttp.ValidatePath("/v1/key/list/*", xhttp.LimitRequestBody(0, xhttp.TLSProxy(proxy, xhttp.EnforcePolicies(roles, xhttp.HandleListKeys(store))))))))))))
 
 	mux.Handle("/v1/policy/write/", xhttp.Timeout(10*time.Second, metrics.Count(metrics.Latency(xhttp.AuditLog(auditLog.Log(), roles, xhttp.EnforceHTTP2(xhttp.RequireMethod(http.MethodPost, xhttp.ValidatePath("/v1/policy/write/*", xhttp.LimitRequestBody(MaxBody, xhttp.TLSProxy(proxy, xhttp.EnforcePolicies(roles, xhttp.HandleWritePolicy(roles))))))))))))
@@ -228,6 +236,7 @@ func server(args []string) {
 	mux.Handle("/v1/identity/assign/", xhttp.Timeout(10*time.Second, metrics.Count(metrics.Latency(xhttp.AuditLog(auditLog.Log(), roles, xhttp.EnforceHTTP2(xhttp.RequireMethod(http.MethodPost, xhttp.ValidatePath("/v1/identity/assign/*/*", xhttp.LimitRequestBody(MaxBody, xhttp.TLSProxy(proxy, xhttp.EnforcePolicies(roles, xhttp.HandleAssignIdentity(roles))))))))))))
 	mux.Handle("/v1/identity/list/", xhttp.Timeout(10*time.Second, metrics.Count(metrics.Latency(xhttp.AuditLog(auditLog.Log(), roles, xhttp.EnforceHTTP2(xhttp.RequireMethod(http.MethodGet, xhttp.ValidatePath("/v1/identity/list/*", xhttp.LimitRequestBody(0, xhttp.TLSProxy(proxy, xhttp.EnforcePolicies(roles, xhttp.HandleListIdentities(roles))))))))))))
 	mux.Handle("/v1/identity/forget/", xhttp.Timeout(10*time.Second, metrics.Count(metrics.Latency(xhttp.AuditLog(auditLog.Log(), roles, xhttp.EnforceHTTP2(xhttp.RequireMethod(http.MethodDelete, xhttp.ValidatePath("/v1/identity/forget/*", xhttp.LimitRequestBody(0, xhttp.TLSProxy(proxy, xhttp.EnforcePolicies(roles, xhttp.HandleForgetIdentity(roles))))))))))))
+	mux.Handle("/v1/identity/self/describe", xhttp.Timeout(10*time.Second, metrics.Count(metrics.Latency(xhttp.AuditLog(auditLog.Log(), roles, xhttp.EnforceHTTP2(xhttp.RequireMethod(http.MethodGet, xhttp.ValidatePath("/v1/identity/self/describe", xhttp.LimitRequestBody(0, xhttp.TLSProxy(proxy, xhttp.HandleDescribeSelf(roles))))))))))) // Any identity can describe itself
 
 	mux.Handle("/v1/log/audit/trace", metrics.Count(metrics.Latency(xhttp.AuditLog(auditLog.Log(), roles, xhttp.EnforceHTTP2(xhttp.RequireMethod(http.MethodGet, xhttp.ValidatePath("/v1/log/audit/trace", xhttp.LimitRequestBody(0, xhttp.TLSProxy(proxy, xhttp.EnforcePolicies(roles, xhttp.HandleTraceAuditLog(auditLog)))))))))))
 	mux.Handle("/v1/log/error/trace", metrics.Count(metrics.Latency(xhttp.AuditLog(auditLog.Log(), roles, xhttp.EnforceHTTP2(xhttp.RequireMethod(http.MethodGet, xhttp.ValidatePath("/v1/log/error/trace", xhttp.LimitRequestBody(0, xhttp.TLSProxy(proxy, xhttp.EnforcePolicies(roles, xhttp.HandleTraceErrorLog(errorLog)))))))))))
@@ -236,12 +245,28 @@ func server(args []string) {
 	// Doing so may cause misleading statistics.
 	mux.Handle("/v1/metrics", xhttp.Timeout(10*time.Second, xhttp.AuditLog(auditLog.Log(), roles, xhttp.EnforceHTTP2(xhttp.RequireMethod(http.MethodGet, xhttp.ValidatePath("/v1/metrics", xhttp.LimitRequestBody(0, xhttp.TLSProxy(proxy, xhttp.EnforcePolicies(roles, xhttp.HandleMetrics(metrics))))))))))
 
+	mux.Handle("/v1/api", xhttp.Timeout(10*time.Second, metrics.Count(metrics.Latency(xhttp.AuditLog(auditLog.Log(), roles, xhttp.EnforceHTTP2(xhttp.RequireMethod(http.MethodGet, xhttp.ValidatePath("/v1/api", xhttp.LimitRequestBody(0, xhttp.TLSProxy(proxy, xhttp.HandleListAPIs(serverAPIs(MaxBody)))))))))))) // /v1/api is accessible to any identity
+
+	// /v1/status is accessible to any identity. In contrast to
+	// any other API, it also accepts HEAD requests such that
+	// clients can ping the server cheaply.
+	status := xhttp.ValidatePath("/v1/status", xhttp.LimitRequestBody(0, xhttp.TLSProxy(proxy, xhttp.HandleStatus(version, startTime))))
+	statusGET := xhttp.RequireMethod(http.MethodGet, status)
+	mux.Handle("/v1/status", xhttp.Timeout(10*time.Second, metrics.Count(metrics.Latency(xhttp.AuditLog(auditLog.Log(), roles, xhttp.EnforceHTTP2(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			status(w, r) // The http.Server discards the response body
+		default:
+			statusGET(w, r)
+		}
+	}))))))
+
 	mux.Handle("/version", xhttp.Timeout(10*time.Second, metrics.Count(metrics.Latency(xhttp.AuditLog(auditLog.Log(), roles, xhttp.EnforceHTTP2(xhttp.RequireMethod(http.MethodGet, xhttp.ValidatePath("/version", xhttp.LimitRequestBody(0, xhttp.TLSProxy(proxy, xhttp.HandleVersion(version))))))))))) // /version is accessible to any identity
 	mux.Handle("/", xhttp.Timeout(10*time.Second, metrics.Count(metrics.Latency(xhttp.EnforceHTTP2(xhttp.AuditLog(auditLog.Log(), roles, xhttp.TLSProxy(proxy, http.NotFound)))))))
 
 	server := http.Server{
 		Addr:    config.Addr,
-		Handler: mux,
+		Handler: xhttp.RejectEnclaves(mux.ServeHTTP),
 		TLSConfig: &tls.Config{
 			MinVersion: tls.VersionTLS13,
 		},
@@ -344,6 +369,41 @@ func server(args []string) {
 	}
 }
 
+// serverAPIs returns the list of APIs exposed by the
+// server. It must be kept in sync with the server's
+// HTTP handlers.
+func serverAPIs(maxBody int64) []xhttp.API {
+	return []xhttp.API{
+		{Method: http.MethodPost, Path: "/v1/key/create", MaxBody: 0, Timeout: 15 * time.Second},
+		{Method: http.MethodPost, Path: "/v1/key/import", MaxBody: maxBody, Timeout: 15 * time.Second},
+		{Method: http.MethodDelete, Path: "/v1/key/delete", MaxBody: 0, Timeout: 15 * time.Second},
+		{Method: http.MethodGet, Path: "/v1/key/describe", MaxBody: 0, Timeout: 15 * time.Second},
+		{Method: http.MethodPost, Path: "/v1/key/generate", MaxBody: maxBody, Timeout: 15 * time.Second},
+		{Method: http.MethodPost, Path: "/v1/key/encrypt", MaxBody: maxBody / 2, Timeout: 15 * time.Second},
+		{Method: http.MethodPost, Path: "/v1/key/decrypt", MaxBody: maxBody, Timeout: 15 * time.Second},
+		{Method: http.MethodPost, Path: "/v1/key/rewrap", MaxBody: maxBody, Timeout: 15 * time.Second},
+		{Method: http.MethodGet, Path: "/v1/key/list", MaxBody: 0, Timeout: 15 * time.Second},
+
+		{Method: http.MethodPost, Path: "/v1/policy/write", MaxBody: maxBody, Timeout: 10 * time.Second},
+		{Method: http.MethodGet, Path: "/v1/policy/read", MaxBody: 0, Timeout: 10 * time.Second},
+		{Method: http.MethodGet, Path: "/v1/policy/list", MaxBody: 0, Timeout: 10 * time.Second},
+		{Method: http.MethodDelete, Path: "/v1/policy/delete", MaxBody: 0, Timeout: 10 * time.Second},
+
+		{Method: http.MethodPost, Path: "/v1/identity/assign", MaxBody: maxBody, Timeout: 10 * time.Second},
+		{Method: http.MethodGet, Path: "/v1/identity/list", MaxBody: 0, Timeout: 10 * time.Second},
+		{Method: http.MethodDelete, Path: "/v1/identity/forget", MaxBody: 0, Timeout: 10 * time.Second},
+		{Method: http.MethodGet, Path: "/v1/identity/self/describe", MaxBody: 0, Timeout: 10 * time.Second},
+
+		{Method: http.MethodGet, Path: "/v1/log/audit/trace", MaxBody: 0, Timeout: 0},
+		{Method: http.MethodGet, Path: "/v1/log/error/trace", MaxBody: 0, Timeout: 0},
+
+		{Method: http.MethodGet, Path: "/v1/metrics", MaxBody: 0, Timeout: 10 * time.Second},
+		{Method: http.MethodGet, Path: "/v1/api", MaxBody: 0, Timeout: 10 * time.Second},
+		{Method: http.MethodGet, Path: "/v1/status", MaxBody: 0, Timeout: 10 * time.Second},
+		{Method: http.MethodGet, Path: "/version", MaxBody: 0, Timeout: 10 * time.Second},
+	}
+}
+
 // quiet is a boolean flag.Value that can print
 // to STDOUT.
 //
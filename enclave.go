@@ -0,0 +1,145 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Enclave returns a new EnclaveClient that performs all
+// key, policy and identity operations within the named
+// enclave.
+//
+// An enclave is an isolated namespace at a KES server. Keys,
+// policies and identities of one enclave are not visible to
+// any other enclave. The EnclaveClient shares the Client's
+// HTTP client - including its connections and TLS config.
+//
+// If the enclave does not exist, all operations fail with
+// ErrEnclaveNotFound. It can be matched via errors.As and
+// an EnclaveNotFoundError.
+func (c *Client) Enclave(name string) *EnclaveClient {
+	client := *c
+	client.enclave = name
+	return &EnclaveClient{
+		name:   name,
+		client: &client,
+	}
+}
+
+// EnclaveClient is a KES client that performs all key,
+// policy and identity operations within one enclave.
+// It is created by the Client's Enclave method.
+type EnclaveClient struct {
+	name   string
+	client *Client
+}
+
+// Name returns the name of the enclave.
+func (e *EnclaveClient) Name() string { return e.name }
+
+// CreateKey creates a new cryptographic key with the
+// specified name within the enclave.
+//
+// It returns ErrKeyExists if a key with the same name
+// already exists.
+func (e *EnclaveClient) CreateKey(ctx context.Context, name string) error {
+	return e.client.createKey(ctx, name)
+}
+
+// DeleteKey deletes the key with the specified name
+// within the enclave.
+func (e *EnclaveClient) DeleteKey(ctx context.Context, name string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint(e.client.Endpoint, "/v1/key/delete", url.PathEscape(name)), retryBody(nil))
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.retryClient().Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return parseErrorResponse(resp)
+	}
+	return resp.Body.Close()
+}
+
+// DescribeKey returns the KeyInfo of the key with the
+// specified name within the enclave.
+func (e *EnclaveClient) DescribeKey(ctx context.Context, name string) (*KeyInfo, error) {
+	return e.client.DescribeKey(ctx, name)
+}
+
+// ListKeys returns a new KeyIterator that iterates over
+// all keys within the enclave whose name starts with the
+// given prefix. See: Client.ListKeysIter
+func (e *EnclaveClient) ListKeys(ctx context.Context, prefix string, options ...ListOption) *KeyIterator {
+	return e.client.ListKeysIter(ctx, prefix, options...)
+}
+
+// GenerateKey generates a new data encryption key (DEK)
+// with the named key within the enclave.
+// See: Client.GenerateKey
+func (e *EnclaveClient) GenerateKey(ctx context.Context, name string, context []byte) (*DEK, error) {
+	return e.client.GenerateKey(ctx, name, context)
+}
+
+// Encrypt encrypts the plaintext with the named key
+// within the enclave. See: Client.Encrypt
+func (e *EnclaveClient) Encrypt(ctx context.Context, name string, plaintext, context []byte) ([]byte, error) {
+	return e.client.encrypt(ctx, name, plaintext, context)
+}
+
+// Decrypt decrypts the ciphertext with the named key
+// within the enclave. See: Client.Decrypt
+func (e *EnclaveClient) Decrypt(ctx context.Context, name string, ciphertext, context []byte) ([]byte, error) {
+	return e.client.decrypt(ctx, name, ciphertext, context)
+}
+
+// SetPolicy adds the given policy to the enclave.
+// See: Client.SetPolicy
+func (e *EnclaveClient) SetPolicy(ctx context.Context, name string, policy *Policy) error {
+	return e.client.SetPolicy(ctx, name, policy)
+}
+
+// GetPolicy returns the policy with the given name
+// within the enclave. See: Client.GetPolicy
+func (e *EnclaveClient) GetPolicy(ctx context.Context, name string) (*Policy, error) {
+	return e.client.GetPolicy(ctx, name)
+}
+
+// DeletePolicy removes the policy with the given name
+// from the enclave. See: Client.DeletePolicy
+func (e *EnclaveClient) DeletePolicy(ctx context.Context, name string) error {
+	return e.client.DeletePolicy(ctx, name)
+}
+
+// ListPolicies returns a new PolicyIterator that iterates
+// over all policies within the enclave whose name matches
+// the given glob pattern. See: Client.ListPolicies
+func (e *EnclaveClient) ListPolicies(ctx context.Context, pattern string) (*PolicyIterator, error) {
+	return e.client.ListPolicies(ctx, pattern)
+}
+
+// AssignIdentity assigns the policy within the enclave to
+// the identity. See: Client.AssignIdentity
+func (e *EnclaveClient) AssignIdentity(ctx context.Context, policy string, id Identity) error {
+	return e.client.AssignIdentity(ctx, policy, id)
+}
+
+// DeleteIdentity removes the identity from the enclave.
+// See: Client.DeleteIdentity
+func (e *EnclaveClient) DeleteIdentity(ctx context.Context, id Identity) error {
+	return e.client.DeleteIdentity(ctx, id)
+}
+
+// ListIdentities returns a new IdentityIterator that iterates
+// over all identities within the enclave that match the given
+// glob pattern. See: Client.ListIdentities
+func (e *EnclaveClient) ListIdentities(ctx context.Context, pattern string) (*IdentityIterator, error) {
+	return e.client.ListIdentities(ctx, pattern)
+}
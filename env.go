@@ -0,0 +1,72 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// Environment variables used by NewClientFromEnv.
+const (
+	EnvServer     = "KES_SERVER"      // The KES server endpoint
+	EnvClientCert = "KES_CLIENT_CERT" // Path to the client certificate
+	EnvClientKey  = "KES_CLIENT_KEY"  // Path to the client private key
+	EnvCA         = "KES_CA"          // Path to the CA certificates, optional
+)
+
+// DefaultEndpoint is the KES server endpoint used by
+// NewClientFromEnv if no endpoint has been specified.
+const DefaultEndpoint = "https://127.0.0.1:7373"
+
+// NewClientFromEnv returns a new KES client configured
+// via environment variables:
+//   KES_SERVER:      the KES server endpoint. Defaults to DefaultEndpoint.
+//   KES_CLIENT_CERT: path to the PEM-encoded client certificate. Required.
+//   KES_CLIENT_KEY:  path to the PEM-encoded client private key. Required.
+//   KES_CA:          path to the PEM-encoded CA certificates that
+//                    are used to verify the server certificate.
+//                    Defaults to the system root CAs.
+//
+// It returns an error if a required environment variable
+// is not set or empty, or if the certificates cannot be
+// loaded. The client can be customized further via
+// ClientOptions.
+func NewClientFromEnv(options ...ClientOption) (*Client, error) {
+	return NewClientFromEnvPrefix("", options...)
+}
+
+// NewClientFromEnvPrefix behaves like NewClientFromEnv
+// but looks up the environment variables with the given
+// prefix first. For example, with the prefix "APP_" it
+// reads APP_KES_SERVER, APP_KES_CLIENT_CERT, etc.
+//
+// A prefixed environment variable takes precedence over
+// the same variable without the prefix. Hence, multiple
+// applications can share common settings, like KES_SERVER,
+// while using different client certificates.
+func NewClientFromEnvPrefix(prefix string, options ...ClientOption) (*Client, error) {
+	lookup := func(name string) string {
+		if value, ok := os.LookupEnv(prefix + name); ok && strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+		return strings.TrimSpace(os.Getenv(name))
+	}
+
+	certFile := lookup(EnvClientCert)
+	if certFile == "" {
+		return nil, errors.New("kes: no client certificate: environment variable '" + prefix + EnvClientCert + "' is not set")
+	}
+	keyFile := lookup(EnvClientKey)
+	if keyFile == "" {
+		return nil, errors.New("kes: no client private key: environment variable '" + prefix + EnvClientKey + "' is not set")
+	}
+	endpoint := lookup(EnvServer)
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	return NewClientWithCertFiles(endpoint, certFile, keyFile, lookup(EnvCA), options...)
+}
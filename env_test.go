@@ -0,0 +1,77 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import (
+	"os"
+	"testing"
+)
+
+var newClientFromEnvTests = []struct {
+	Prefix   string
+	Env      map[string]string
+	Endpoint string
+	Err      bool
+}{
+	{ // 0
+		Env:      map[string]string{EnvClientCert: "root.cert", EnvClientKey: "root.key"},
+		Endpoint: DefaultEndpoint,
+	},
+	{ // 1
+		Env:      map[string]string{EnvServer: "https://kes.example.com:7373", EnvClientCert: "root.cert", EnvClientKey: "root.key", EnvCA: "root.cert"},
+		Endpoint: "https://kes.example.com:7373",
+	},
+	{ // 2
+		Prefix:   "APP_",
+		Env:      map[string]string{EnvServer: "https://kes.example.com:7373", "APP_" + EnvServer: "https://app.example.com:7373", "APP_" + EnvClientCert: "root.cert", EnvClientKey: "root.key"},
+		Endpoint: "https://app.example.com:7373",
+	},
+	{ // 3
+		Env: map[string]string{EnvClientKey: "root.key"},
+		Err: true,
+	},
+	{ // 4
+		Env: map[string]string{EnvClientCert: "root.cert", EnvClientKey: " "},
+		Err: true,
+	},
+	{ // 5
+		Env: map[string]string{EnvClientCert: "root.cert", EnvClientKey: "root.key", EnvCA: "unknown"},
+		Err: true,
+	},
+}
+
+func TestNewClientFromEnv(t *testing.T) {
+	vars := []string{EnvServer, EnvClientCert, EnvClientKey, EnvCA}
+	for _, name := range vars {
+		if value, ok := os.LookupEnv(name); ok {
+			defer os.Setenv(name, value)
+		}
+	}
+
+	for i, test := range newClientFromEnvTests {
+		for _, name := range vars {
+			os.Unsetenv(name)
+			os.Unsetenv("APP_" + name)
+		}
+		for name, value := range test.Env {
+			os.Setenv(name, value)
+		}
+
+		client, err := NewClientFromEnvPrefix(test.Prefix)
+		if test.Err && err == nil {
+			t.Fatalf("Test %d: creating client should have failed", i)
+		}
+		if !test.Err && err != nil {
+			t.Fatalf("Test %d: failed to create client: %v", i, err)
+		}
+		if err == nil && client.Endpoint != test.Endpoint {
+			t.Fatalf("Test %d: invalid endpoint: got %q - want %q", i, client.Endpoint, test.Endpoint)
+		}
+	}
+	for _, name := range vars {
+		os.Unsetenv(name)
+		os.Unsetenv("APP_" + name)
+	}
+}
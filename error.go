@@ -6,11 +6,13 @@ package kes
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var (
@@ -27,18 +29,29 @@ var (
 	// to create a cryptographic key which already exists.
 	ErrKeyExists Error = NewError(http.StatusBadRequest, "key does already exist")
 
+	// ErrDecrypt represents a KES server response returned when a client
+	// tries to decrypt a ciphertext that is not authentic. In particular,
+	// when the ciphertext has been produced with a different context value
+	// resp. associated data or a different key.
+	ErrDecrypt Error = NewError(http.StatusBadRequest, "ciphertext is not authentic")
+
 	// ErrPolicyNotFound represents a KES server response returned when a client
 	// tries to access a policy which does not exist.
 	ErrPolicyNotFound Error = NewError(http.StatusNotFound, "policy does not exist")
+
+	// ErrEnclaveNotFound represents a KES server response returned when a
+	// client tries to access an enclave which does not exist.
+	ErrEnclaveNotFound Error = NewError(http.StatusNotFound, "enclave does not exist")
 )
 
 // Error is the type of client-server API errors.
 // A Client returns an Error if a server responds
 // with a well-formed error message.
 //
-// An Error contains the HTTP status code sent by
-// the server. Errors with the same status code and
-// error message are equal. In particular:
+// An Error contains the HTTP status code and, if
+// sent by the server, a stable error code. Errors
+// with the same status code and error message are
+// equal. In particular:
 //   ErrKeyExists == NewError(400, "key does already exist") // true
 //
 // The client may distinguish errors as following:
@@ -54,6 +67,7 @@ var (
 type Error struct {
 	code    int
 	message string
+	errCode string
 }
 
 // NewError returns a new Error with the given
@@ -65,14 +79,341 @@ func NewError(code int, msg string) Error {
 	return Error{
 		code:    code,
 		message: msg,
+		errCode: errorCode(code, msg),
 	}
 }
 
 // Status returns the HTTP status code of the error.
 func (e Error) Status() int { return e.code }
 
+// ErrorCode returns the stable error code of the
+// error, e.g. "key_not_found", or the empty string
+// if the error has no error code.
+//
+// In contrast to the error message, the error code
+// does not change between server versions.
+func (e Error) ErrorCode() string { return e.errCode }
+
 func (e Error) Error() string { return e.message }
 
+// As sets target to the typed error that corresponds
+// to e, if any, and returns true. Otherwise, it returns
+// false. As allows to match an Error via errors.As:
+//   var notFound kes.KeyNotFoundError
+//   if errors.As(err, &notFound) {
+//       // The key does not exist.
+//   }
+//
+// An Error corresponds to a NotAllowedError if its
+// status code is 403 Forbidden. Otherwise, it must
+// have the status code and error code of the
+// corresponding error value - e.g. a KeyNotFoundError
+// must have the status code and error code of
+// ErrKeyNotFound. The error message does not matter.
+func (e Error) As(target interface{}) bool {
+	switch target := target.(type) {
+	case *NotAllowedError:
+		if e.code == http.StatusForbidden {
+			*target = NotAllowedError{Code: e.code, Message: e.message}
+			return true
+		}
+	case *KeyNotFoundError:
+		if e.matches(ErrKeyNotFound) {
+			*target = KeyNotFoundError{Code: e.code, Message: e.message}
+			return true
+		}
+	case *KeyExistsError:
+		if e.matches(ErrKeyExists) {
+			*target = KeyExistsError{Code: e.code, Message: e.message}
+			return true
+		}
+	case *DecryptError:
+		if e.matches(ErrDecrypt) {
+			*target = DecryptError{Code: e.code, Message: e.message}
+			return true
+		}
+	case *PolicyNotFoundError:
+		if e.matches(ErrPolicyNotFound) {
+			*target = PolicyNotFoundError{Code: e.code, Message: e.message}
+			return true
+		}
+	case *EnclaveNotFoundError:
+		if e.matches(ErrEnclaveNotFound) {
+			*target = EnclaveNotFoundError{Code: e.code, Message: e.message}
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether e has the same status
+// code and error code as target.
+func (e Error) matches(target Error) bool {
+	return e.errCode != "" && e.code == target.code && e.errCode == target.errCode
+}
+
+// Error codes of the errors sent by the server.
+const (
+	codeNotAllowed      = "not_allowed"
+	codeKeyNotFound     = "key_not_found"
+	codeKeyExists       = "key_exists"
+	codeNotAuthentic    = "not_authentic"
+	codePolicyNotFound  = "policy_not_found"
+	codeEnclaveNotFound = "enclave_not_found"
+	codeKeyNotVersioned = "key_not_versioned"
+)
+
+// errorCode returns the error code of the error
+// with the given status code and error message.
+//
+// Older servers do not send error codes. Hence, the
+// error code of such errors is derived from the error
+// message. It returns the empty string if there is no
+// error code for the given status code and message.
+func errorCode(status int, msg string) string {
+	switch {
+	case status == http.StatusForbidden && msg == "prohibited by policy":
+		return codeNotAllowed
+	case status == http.StatusNotFound && msg == "key does not exist":
+		return codeKeyNotFound
+	case status == http.StatusBadRequest && msg == "key does already exist":
+		return codeKeyExists
+	case status == http.StatusBadRequest && msg == "ciphertext is not authentic":
+		return codeNotAuthentic
+	case status == http.StatusNotFound && msg == "policy does not exist":
+		return codePolicyNotFound
+	case status == http.StatusNotFound && msg == "enclave does not exist":
+		return codeEnclaveNotFound
+	case status == http.StatusBadRequest && msg == "key does not support versioning":
+		return codeKeyNotVersioned
+	default:
+		return ""
+	}
+}
+
+// NotAllowedError is the error returned when the client
+// is not allowed to perform an operation - e.g. because
+// its policy does not grant access.
+type NotAllowedError struct {
+	Code    int    // The HTTP status code
+	Message string // The error message sent by the server
+}
+
+// Status returns the HTTP status code of the error.
+func (e NotAllowedError) Status() int { return e.Code }
+
+func (e NotAllowedError) Error() string { return e.Message }
+
+// Is reports whether target is ErrNotAllowed. It
+// allows to match a NotAllowedError via errors.Is:
+//   if errors.Is(err, kes.ErrNotAllowed) {
+//       // The client is not allowed to perform the operation.
+//   }
+func (e NotAllowedError) Is(target error) bool { return target == ErrNotAllowed }
+
+// KeyNotFoundError is the error returned when the
+// client tries to use a key that does not exist.
+type KeyNotFoundError struct {
+	Code    int    // The HTTP status code
+	Message string // The error message sent by the server
+}
+
+// Status returns the HTTP status code of the error.
+func (e KeyNotFoundError) Status() int { return e.Code }
+
+func (e KeyNotFoundError) Error() string { return e.Message }
+
+// KeyExistsError is the error returned when the client
+// tries to create a key that already exists.
+type KeyExistsError struct {
+	Code    int    // The HTTP status code
+	Message string // The error message sent by the server
+}
+
+// Status returns the HTTP status code of the error.
+func (e KeyExistsError) Status() int { return e.Code }
+
+func (e KeyExistsError) Error() string { return e.Message }
+
+// DecryptError is the error returned when the client
+// tries to decrypt a ciphertext that is not authentic.
+type DecryptError struct {
+	Code    int    // The HTTP status code
+	Message string // The error message sent by the server
+}
+
+// Status returns the HTTP status code of the error.
+func (e DecryptError) Status() int { return e.Code }
+
+func (e DecryptError) Error() string { return e.Message }
+
+// PolicyNotFoundError is the error returned when the
+// client tries to access a policy that does not exist.
+type PolicyNotFoundError struct {
+	Code    int    // The HTTP status code
+	Message string // The error message sent by the server
+}
+
+// Status returns the HTTP status code of the error.
+func (e PolicyNotFoundError) Status() int { return e.Code }
+
+func (e PolicyNotFoundError) Error() string { return e.Message }
+
+// EnclaveNotFoundError is the error returned when the
+// client tries to access an enclave that does not exist.
+type EnclaveNotFoundError struct {
+	Code    int    // The HTTP status code
+	Message string // The error message sent by the server
+}
+
+// Status returns the HTTP status code of the error.
+func (e EnclaveNotFoundError) Status() int { return e.Code }
+
+func (e EnclaveNotFoundError) Error() string { return e.Message }
+
+// TooManyRequestsError is the error returned when the
+// server rejects a request because it is overloaded, i.e.
+// responds with 429 Too Many Requests.
+//
+// A Client retries such requests on its own if retries are
+// enabled - see WithRetry. Otherwise, the caller should wait
+// at least RetryAfter before sending the request again.
+//
+// A TooManyRequestsError wraps the Error with the same status
+// code and message. Hence, code that matches an Error via
+// errors.As keeps working:
+//   var e kes.Error
+//   if errors.As(err, &e) && e.Status() == http.StatusTooManyRequests {
+//       // The server is overloaded.
+//   }
+type TooManyRequestsError struct {
+	Code       int           // The HTTP status code
+	Message    string        // The error message sent by the server
+	RetryAfter time.Duration // The delay requested by the server, if any
+}
+
+// Status returns the HTTP status code of the error.
+func (e TooManyRequestsError) Status() int { return e.Code }
+
+func (e TooManyRequestsError) Error() string {
+	if e.Message == "" {
+		return "kes: too many requests"
+	}
+	return e.Message
+}
+
+// Unwrap returns the Error with the status code
+// and error message of the TooManyRequestsError.
+func (e TooManyRequestsError) Unwrap() error { return NewError(e.Code, e.Message) }
+
+// KeyLengthError is the error returned when a client
+// tries to import a cryptographic key that does not
+// have the required length.
+type KeyLengthError struct {
+	Length int // The length of the key in bytes
+	Want   int // The required length in bytes
+}
+
+func (e KeyLengthError) Error() string {
+	return fmt.Sprintf("kes: invalid key length: got %d bytes - want %d bytes", e.Length, e.Want)
+}
+
+// KeyVersioningError is the error returned by a Client
+// when an operation requires a versioned key but the
+// server does not version the key - e.g. when re-wrapping
+// a ciphertext with the latest key version.
+type KeyVersioningError struct {
+	Key string // The name of the key
+}
+
+// errKeyNotVersioned is the server response that
+// corresponds to a KeyVersioningError.
+var errKeyNotVersioned = NewError(http.StatusBadRequest, "key does not support versioning")
+
+func (e KeyVersioningError) Error() string {
+	return fmt.Sprintf("kes: key '%s' does not support versioning", e.Key)
+}
+
+// NotSupportedError is the error returned by a Client
+// when the KES server does not support an API - e.g.
+// because it is an older server.
+type NotSupportedError struct {
+	API string // The API path, e.g. /v1/key/usage
+}
+
+func (e NotSupportedError) Error() string {
+	return fmt.Sprintf("kes: server does not support '%s'", e.API)
+}
+
+// isNotSupported reports whether the error response
+// indicates that the server does not support the API.
+// A server without a route for the API responds with
+// 404 Not Found, like for a non-existing key, but does
+// not send a JSON error. Some proxies respond with 405
+// or 501 instead.
+func isNotSupported(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	case http.StatusNotFound:
+		return !strings.HasPrefix(strings.TrimSpace(resp.Header.Get("Content-Type")), "application/json")
+	default:
+		return false
+	}
+}
+
+// SSEEnvelopeError is the error returned when a
+// blob is not a well-formed SSEEnvelope.
+type SSEEnvelopeError struct {
+	Reason string // Why the envelope is malformed
+	Err    error  // The underlying error, if any
+}
+
+func (e SSEEnvelopeError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("kes: malformed SSE envelope: %s: %v", e.Reason, e.Err)
+	}
+	return "kes: malformed SSE envelope: " + e.Reason
+}
+
+// Unwrap returns the underlying error, if any.
+func (e SSEEnvelopeError) Unwrap() error { return e.Err }
+
+// PolicyDiffError is the error returned by ApplyPolicyDiff
+// when a policy cannot be changed.
+type PolicyDiffError struct {
+	Op   string // The failed operation: create, update or delete
+	Name string // The name of the policy
+	Err  error  // The error returned by the Client
+}
+
+func (e PolicyDiffError) Error() string {
+	return fmt.Sprintf("kes: failed to %s policy '%s': %v", e.Op, e.Name, e.Err)
+}
+
+// Unwrap returns the error returned by the Client.
+func (e PolicyDiffError) Unwrap() error { return e.Err }
+
+// ConnError is the error returned by a Client when
+// it cannot reach a KES server - e.g. because the
+// server is down or not reachable via the network.
+//
+// In contrast to an Error, a ConnError indicates
+// that the server has not sent any response. In
+// particular, a ConnError is never caused by an
+// authentication or authorization failure.
+type ConnError struct {
+	Endpoint string // The KES server endpoint
+	Err      error  // The underlying connection error
+}
+
+func (e ConnError) Error() string {
+	return fmt.Sprintf("kes: cannot connect to '%s': %v", e.Endpoint, e.Err)
+}
+
+// Unwrap returns the underlying connection error.
+func (e ConnError) Unwrap() error { return e.Err }
+
 // parseErrorResponse returns an error containing
 // the response status code and response body
 // as error message if the response is an error
@@ -89,7 +430,7 @@ func parseErrorResponse(resp *http.Response) error {
 		return nil
 	}
 	if resp.Body == nil {
-		return NewError(resp.StatusCode, "")
+		return newResponseError(resp, "", "")
 	}
 	defer resp.Body.Close()
 
@@ -103,19 +444,72 @@ func parseErrorResponse(resp *http.Response) error {
 	if strings.HasPrefix(contentType, "application/json") {
 		type Response struct {
 			Message string `json:"message"`
+			Code    string `json:"code"`
 		}
 		var response Response
 		if err := json.NewDecoder(io.LimitReader(resp.Body, size)).Decode(&response); err != nil {
 			return err
 		}
-		return NewError(resp.StatusCode, response.Message)
+		return newResponseError(resp, response.Message, response.Code)
 	}
 
 	var sb strings.Builder
 	if _, err := io.Copy(&sb, io.LimitReader(resp.Body, size)); err != nil {
 		return err
 	}
-	return NewError(resp.StatusCode, sb.String())
+	return newResponseError(resp, sb.String(), "")
+}
+
+// newResponseError returns the error for the given
+// error response, error message and error code. In
+// general, it returns an Error. However, it returns a
+// more specific error if the error has to carry additional
+// information from the response - e.g. a TooManyRequestsError.
+func newResponseError(resp *http.Response, msg, code string) error {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return TooManyRequestsError{
+			Code:       resp.StatusCode,
+			Message:    msg,
+			RetryAfter: parseRetryAfter(resp),
+		}
+	}
+	return newError(resp.StatusCode, msg, code)
+}
+
+// newError returns a new Error with the given status
+// code, error message and error code. If code is empty,
+// the error code is derived from the status code and
+// error message, like for NewError.
+func newError(status int, msg, code string) Error {
+	if code == "" {
+		return NewError(status, msg)
+	}
+	return Error{code: status, message: msg, errCode: code}
+}
+
+// parseUnexpectedResponse returns the error of a
+// response whose status code does not indicate
+// success. In contrast to parseErrorResponse, it
+// returns a non-nil error for any status code and
+// always closes the response body.
+func parseUnexpectedResponse(resp *http.Response) error {
+	defer resp.Body.Close()
+	if err := parseErrorResponse(resp); err != nil {
+		return err
+	}
+	return NewError(resp.StatusCode, "unexpected response status: "+resp.Status)
+}
+
+// parseNotAllowedResponse returns the Error of a 403
+// Forbidden response. The Error contains the error
+// message sent by the server. If the response does not
+// contain an error message, it returns ErrNotAllowed.
+func parseNotAllowedResponse(resp *http.Response) error {
+	var e Error
+	if err := parseUnexpectedResponse(resp); errors.As(err, &e) && e.Error() != "" {
+		return e
+	}
+	return ErrNotAllowed
 }
 
 func parseErrorTrailer(trailer http.Header) error {
@@ -134,10 +528,11 @@ func parseErrorTrailer(trailer http.Header) error {
 
 	type Response struct {
 		Message string `json:"message"`
+		Code    string `json:"code"`
 	}
 	var response Response
 	if err = json.Unmarshal([]byte(errMessage), &response); err != nil {
 		return err
 	}
-	return NewError(status, response.Message)
+	return newError(status, response.Message, response.Code)
 }
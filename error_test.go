@@ -5,7 +5,11 @@
 package kes
 
 import (
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"strings"
 	"testing"
 )
 
@@ -18,6 +22,7 @@ var newErrorTests = []struct {
 	{Code: http.StatusNotFound, Message: "key does not exist", Err: ErrKeyNotFound},
 	{Code: http.StatusBadRequest, Message: "key does already exist", Err: ErrKeyExists},
 	{Code: http.StatusForbidden, Message: "prohibited by policy", Err: ErrNotAllowed},
+	{Code: http.StatusBadRequest, Message: "ciphertext is not authentic", Err: ErrDecrypt},
 }
 
 func TestNewError(t *testing.T) {
@@ -28,3 +33,89 @@ func TestNewError(t *testing.T) {
 		}
 	}
 }
+
+var errorAsTests = []struct {
+	Err        error
+	NotAllowed bool
+	NotFound   bool
+	Exists     bool
+	Decrypt    bool
+	NoPolicy   bool
+	NoEnclave  bool
+}{
+	{Err: ErrNotAllowed, NotAllowed: true}, // 0
+	{Err: NewError(http.StatusForbidden, "identity cannot assign policy to itself"), NotAllowed: true}, // 1
+	{Err: ErrKeyNotFound, NotFound: true},                                                // 2
+	{Err: ErrKeyExists, Exists: true},                                                    // 3
+	{Err: ErrPolicyNotFound, NoPolicy: true},                                             // 4
+	{Err: fmt.Errorf("kes: failed to create key: %w", ErrKeyExists), Exists: true},       // 5
+	{Err: ErrDecrypt, Decrypt: true},                                                     // 6
+	{Err: NewError(http.StatusNotFound, "enclave does not exist"), NoEnclave: true},      // 7
+	{Err: errors.New("key does not exist")},                                              // 8
+	{Err: newError(http.StatusNotFound, "no such key", codeKeyNotFound), NotFound: true}, // 9
+	{Err: newError(http.StatusBadRequest, "no such key", codeKeyNotFound)},               // 10
+	{Err: NewError(http.StatusNotFound, "404 page not found")},                           // 11
+}
+
+func TestErrorAs(t *testing.T) {
+	for i, test := range errorAsTests {
+		var notAllowed NotAllowedError
+		if ok := errors.As(test.Err, &notAllowed); ok != test.NotAllowed {
+			t.Fatalf("Test %d: NotAllowedError: got %v - want %v", i, ok, test.NotAllowed)
+		}
+		var notFound KeyNotFoundError
+		if ok := errors.As(test.Err, &notFound); ok != test.NotFound {
+			t.Fatalf("Test %d: KeyNotFoundError: got %v - want %v", i, ok, test.NotFound)
+		}
+		var exists KeyExistsError
+		if ok := errors.As(test.Err, &exists); ok != test.Exists {
+			t.Fatalf("Test %d: KeyExistsError: got %v - want %v", i, ok, test.Exists)
+		}
+		var decrypt DecryptError
+		if ok := errors.As(test.Err, &decrypt); ok != test.Decrypt {
+			t.Fatalf("Test %d: DecryptError: got %v - want %v", i, ok, test.Decrypt)
+		}
+		var noPolicy PolicyNotFoundError
+		if ok := errors.As(test.Err, &noPolicy); ok != test.NoPolicy {
+			t.Fatalf("Test %d: PolicyNotFoundError: got %v - want %v", i, ok, test.NoPolicy)
+		}
+		var noEnclave EnclaveNotFoundError
+		if ok := errors.As(test.Err, &noEnclave); ok != test.NoEnclave {
+			t.Fatalf("Test %d: EnclaveNotFoundError: got %v - want %v", i, ok, test.NoEnclave)
+		}
+	}
+
+	var notFound KeyNotFoundError
+	if !errors.As(ErrKeyNotFound, &notFound) {
+		t.Fatal("ErrKeyNotFound is not a KeyNotFoundError")
+	}
+	if notFound.Status() != http.StatusNotFound || notFound.Error() != ErrKeyNotFound.Error() {
+		t.Fatalf("Invalid KeyNotFoundError: got %d %q - want %d %q", notFound.Status(), notFound.Error(), http.StatusNotFound, ErrKeyNotFound.Error())
+	}
+}
+
+var parseErrorResponseTests = []struct {
+	Status int
+	Body   string
+	Err    error
+}{
+	{Status: http.StatusNotFound, Body: `{"message":"key does not exist"}`, Err: ErrKeyNotFound},                                                                // 0
+	{Status: http.StatusNotFound, Body: `{"message":"key does not exist","code":"key_not_found"}`, Err: ErrKeyNotFound},                                         // 1
+	{Status: http.StatusNotFound, Body: `{"message":"no such key","code":"key_not_found"}`, Err: newError(http.StatusNotFound, "no such key", codeKeyNotFound)}, // 2
+	{Status: http.StatusBadRequest, Body: `{"message":"ciphertext is not authentic","code":"not_authentic"}`, Err: ErrDecrypt},                                  // 3
+	{Status: http.StatusNotFound, Body: `{"message":"key does not exist","code":"other"}`, Err: newError(http.StatusNotFound, "key does not exist", "other")},   // 4
+}
+
+func TestParseErrorResponse(t *testing.T) {
+	for i, test := range parseErrorResponseTests {
+		resp := &http.Response{
+			StatusCode:    test.Status,
+			ContentLength: -1,
+			Header:        http.Header{"Content-Type": []string{"application/json"}},
+			Body:          ioutil.NopCloser(strings.NewReader(test.Body)),
+		}
+		if err := parseErrorResponse(resp); err != test.Err {
+			t.Fatalf("Test %d: got %#v - want %#v", i, err, test.Err)
+		}
+	}
+}
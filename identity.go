@@ -1,5 +1,12 @@
 package kes
 
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+)
+
 // IdentityUnknown is the identity returned
 // by an IdentityFunc if it cannot map a
 // particular X.509 certificate to an actual
@@ -19,3 +26,46 @@ func (id Identity) IsUnknown() bool { return id == IdentityUnknown }
 // String returns the string representation of
 // the identity.
 func (id Identity) String() string { return string(id) }
+
+// ComputeIdentity returns the identity of the X.509
+// certificate. It is the hex-encoded SHA-256 hash of
+// the certificate's public key - i.e. the identity a
+// KES server computes by default for a client that
+// presents the certificate.
+//
+// It returns IdentityUnknown if cert is nil.
+func ComputeIdentity(cert *x509.Certificate) Identity {
+	if cert == nil {
+		return IdentityUnknown
+	}
+	h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return Identity(hex.EncodeToString(h[:]))
+}
+
+// ComputeTLSIdentity returns the identity of the TLS
+// certificate. It is equal to the identity of its leaf
+// certificate. See ComputeIdentity.
+//
+// It returns IdentityUnknown if the TLS certificate
+// does not contain a valid X.509 certificate.
+func ComputeTLSIdentity(cert tls.Certificate) Identity {
+	if cert.Leaf != nil {
+		return ComputeIdentity(cert.Leaf)
+	}
+	if len(cert.Certificate) == 0 {
+		return IdentityUnknown
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return IdentityUnknown
+	}
+	return ComputeIdentity(leaf)
+}
+
+// IdentityInfo describes an identity as seen
+// by a KES server.
+type IdentityInfo struct {
+	Identity Identity // The identity computed by the server
+	Policy   string   // The policy assigned to the identity, if any
+	IsAdmin  bool     // Indicates whether the identity is the root identity
+}
@@ -0,0 +1,59 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"testing"
+)
+
+func TestComputeIdentity(t *testing.T) {
+	const Identity = "3ecfcdf38fcbe141ae26a1030f81e96b753365a46760ae6b578698a97c59fd22"
+
+	certPEM, err := ioutil.ReadFile("root.cert")
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		t.Fatal("Failed to decode certificate: no PEM block")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	if id := ComputeIdentity(cert); id != Identity {
+		t.Fatalf("Invalid identity: got %s - want %s", id, Identity)
+	}
+	if id := ComputeIdentity(nil); !id.IsUnknown() {
+		t.Fatalf("Invalid identity: got %s - want %s", id, IdentityUnknown)
+	}
+}
+
+func TestComputeTLSIdentity(t *testing.T) {
+	const Identity = "3ecfcdf38fcbe141ae26a1030f81e96b753365a46760ae6b578698a97c59fd22"
+
+	cert, err := tls.LoadX509KeyPair("root.cert", "root.key")
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	if id := ComputeTLSIdentity(cert); id != Identity {
+		t.Fatalf("Invalid identity: got %s - want %s", id, Identity)
+	}
+
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	if id := ComputeTLSIdentity(cert); id != Identity {
+		t.Fatalf("Invalid identity: got %s - want %s", id, Identity)
+	}
+	if id := ComputeTLSIdentity(tls.Certificate{}); !id.IsUnknown() {
+		t.Fatalf("Invalid identity: got %s - want %s", id, IdentityUnknown)
+	}
+}
@@ -136,7 +136,7 @@ func TestImportKey(t *testing.T) {
 
 	key := fmt.Sprintf("KES-test-%x", sioutil.MustRandom(12))
 	for i, test := range importKeyTests {
-		if err := client.ImportKey(key, test.Key); err != nil {
+		if err := client.ImportKey(context.Background(), key, test.Key); err != nil {
 			t.Fatalf("Failed to import key '%s': %v", key, err)
 		}
 
@@ -180,7 +180,7 @@ func TestGenerateKey(t *testing.T) {
 	defer client.DeleteKey(key) // Cleanup
 
 	for i, test := range generateKeyTests {
-		dek, err := client.GenerateKey(key, test.Context)
+		dek, err := client.GenerateKey(context.Background(), key, test.Context)
 		if err == nil && test.ShouldFail {
 			t.Fatalf("Test %d: Test should have failed but succeeded", i)
 		}
@@ -405,14 +405,14 @@ func TestReadWritePolicy(t *testing.T) {
 
 	name := fmt.Sprintf("KES-test-%x", sioutil.MustRandom(12))
 	for i, test := range readWritePolicyTests {
-		if err := client.SetPolicy(name, test.Policy); err != nil {
+		if err := client.SetPolicy(context.Background(), name, test.Policy); err != nil {
 			t.Fatalf("Test %d: Failed to create policy '%s': %v", i, name, err)
 		}
-		if _, err = client.GetPolicy(name); err != nil {
-			client.DeletePolicy(name) // cleanup
+		if _, err = client.GetPolicy(context.Background(), name); err != nil {
+			client.DeletePolicy(context.Background(), name) // cleanup
 			t.Fatalf("Test %d: Failed to read policy '%s': %v", i, name, err)
 		}
-		client.DeletePolicy(name) // cleanup
+		client.DeletePolicy(context.Background(), name) // cleanup
 	}
 }
 
@@ -427,13 +427,13 @@ func TestAssignIdentity(t *testing.T) {
 	}
 
 	name := fmt.Sprintf("KES-test-%x", sioutil.MustRandom(12))
-	if err := client.SetPolicy(name, newPolicy("/version")); err != nil {
+	if err := client.SetPolicy(context.Background(), name, newPolicy("/version")); err != nil {
 		t.Fatalf("Failed to create policy '%s': %v", name, err)
 	}
-	defer client.DeletePolicy(name)
+	defer client.DeletePolicy(context.Background(), name)
 
 	identity := kes.Identity(hex.EncodeToString(sioutil.MustRandom(32)))
-	if err := client.AssignIdentity(name, identity); err != nil {
+	if err := client.AssignIdentity(context.Background(), name, identity); err != nil {
 		t.Fatalf("Failed to assign identity '%s' to policy '%s': %v", identity, name, err)
 	}
 }
@@ -449,16 +449,16 @@ func TestForgetIdentity(t *testing.T) {
 	}
 
 	name := fmt.Sprintf("KES-test-%x", sioutil.MustRandom(12))
-	if err := client.SetPolicy(name, newPolicy("/version")); err != nil {
+	if err := client.SetPolicy(context.Background(), name, newPolicy("/version")); err != nil {
 		t.Fatalf("Failed to create policy '%s': %v", name, err)
 	}
-	defer client.DeletePolicy(name)
+	defer client.DeletePolicy(context.Background(), name)
 
 	identity := kes.Identity(hex.EncodeToString(sioutil.MustRandom(32)))
-	if err := client.AssignIdentity(name, identity); err != nil {
+	if err := client.AssignIdentity(context.Background(), name, identity); err != nil {
 		t.Fatalf("Failed to assign identity '%s' to policy '%s': %v", identity, name, err)
 	}
-	if err := client.ForgetIdentity(identity); err != nil {
+	if err := client.DeleteIdentity(context.Background(), identity); err != nil {
 		t.Fatalf("Failed to forget identity '%s': %v", identity, err)
 	}
 }
@@ -472,7 +472,7 @@ func TestMetrics(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to create KES client: %v", err)
 	}
-	metric, err := client.Metrics()
+	metric, err := client.Metrics(context.Background())
 	if err != nil {
 		t.Fatalf("Failed to fetch KES metrics: %v", err)
 	}
@@ -6,7 +6,6 @@ package auth
 
 import (
 	"crypto"
-	"crypto/sha256"
 	"crypto/x509"
 	"encoding/hex"
 	"errors"
@@ -143,6 +142,25 @@ func (r *Roles) IsAssigned(id kes.Identity) bool {
 	return false
 }
 
+// PolicyOf returns the name of the policy
+// assigned to the given identity.
+//
+// It returns false if no policy is assigned
+// to the identity or the assigned policy
+// does not exist anymore.
+func (r *Roles) PolicyOf(id kes.Identity) (string, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if r.effectiveRoles != nil {
+		if name, ok := r.effectiveRoles[id]; ok {
+			_, ok = r.roles[name]
+			return name, ok
+		}
+	}
+	return "", false
+}
+
 func (r *Roles) Identities() map[kes.Identity]string {
 	r.lock.RLock()
 	defer r.lock.RUnlock()
@@ -227,10 +245,4 @@ func Identify(req *http.Request, f IdentityFunc) kes.Identity {
 
 // defaultIdentify computes the SHA-256 of the
 // public key in cert and returns it as hex.
-func defaultIdentify(cert *x509.Certificate) kes.Identity {
-	if cert == nil {
-		return kes.IdentityUnknown
-	}
-	h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
-	return kes.Identity(hex.EncodeToString(h[:]))
-}
+func defaultIdentify(cert *x509.Certificate) kes.Identity { return kes.ComputeIdentity(cert) }
@@ -23,9 +23,12 @@ type AuditResponseWriter struct {
 	// on the first invocation of Write resp. WriteHeader.
 	Logger *log.Logger
 
-	URL      url.URL      // The request URL
-	Identity kes.Identity // The client's X.509 identity
-	Time     time.Time    // The time when we receive the request
+	URL       url.URL      // The request URL
+	Method    string       // The request HTTP method
+	Identity  kes.Identity // The client's X.509 identity
+	IP        string       // The client's IP address
+	UserAgent string       // The client's User-Agent
+	Time      time.Time    // The time when we receive the request
 
 	sentHeader bool // Set to true on first WriteHeader
 }
@@ -49,8 +52,11 @@ func (w *AuditResponseWriter) WriteHeader(statusCode int) {
 		event := kes.AuditEvent{
 			Time: w.Time,
 			Request: kes.AuditEventRequest{
-				Path:     w.URL.Path,
-				Identity: w.Identity.String(),
+				Path:      w.URL.Path,
+				Method:    w.Method,
+				Identity:  w.Identity.String(),
+				IP:        w.IP,
+				UserAgent: w.UserAgent,
 			},
 			Response: kes.AuditEventResponse{
 				StatusCode: statusCode,
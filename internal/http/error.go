@@ -17,6 +17,10 @@ import (
 // response status code to err.Status(). Otherwise, it will
 // send 500 (internal server error).
 //
+// If err has an 'ErrorCode() string' method that returns a
+// non-empty error code then Error sends the error code as
+// part of the JSON response body.
+//
 // If err is nil then Error will send the status code 500 and
 // an empty JSON response body - i.e. '{}'.
 func Error(w http.ResponseWriter, err error) error {
@@ -29,14 +33,11 @@ func Error(w http.ResponseWriter, err error) error {
 	w.Header().Set("X-Content-Type-Options", "nosniff")
 	w.WriteHeader(status)
 
-	const (
-		emptyMsg = `{}`
-		format   = `{"message":"%v"}`
-	)
+	const emptyMsg = `{}`
 	if err == nil {
 		_, err = io.WriteString(w, emptyMsg)
 	} else {
-		_, err = io.WriteString(w, fmt.Sprintf(format, err))
+		_, err = io.WriteString(w, errorMessage(err))
 	}
 	return err
 }
@@ -65,14 +66,24 @@ func ErrorTrailer(w http.ResponseWriter, err error) {
 		status = e.Status()
 	}
 
-	const (
-		emptyMsg = `{}`
-		format   = `{"message":"%v"}`
-	)
+	const emptyMsg = `{}`
 	w.Header().Set("Status", strconv.Itoa(status))
 	if err == nil {
 		w.Header().Set("Error", emptyMsg)
 	} else {
-		w.Header().Set("Error", fmt.Sprintf(format, err))
+		w.Header().Set("Error", errorMessage(err))
+	}
+}
+
+// errorMessage returns the JSON error message of err.
+// It contains the error code of err, if any.
+func errorMessage(err error) string {
+	const (
+		format     = `{"message":"%v"}`
+		codeFormat = `{"message":"%v","code":"%s"}`
+	)
+	if e, ok := err.(interface{ ErrorCode() string }); ok && e.ErrorCode() != "" {
+		return fmt.Sprintf(codeFormat, err, e.ErrorCode())
 	}
+	return fmt.Sprintf(format, err)
 }
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"path"
 	"strconv"
@@ -85,6 +86,22 @@ func ValidatePath(apiPattern string, f http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// RejectEnclaves returns an http.HandlerFunc that rejects
+// any request that addresses an enclave before calling f.
+//
+// The server does not support enclaves. It manages a single
+// set of keys, policies and identities. Hence, it must not
+// silently apply a request for an enclave to this set.
+func RejectEnclaves(f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["enclave"]; ok {
+			Error(w, kes.ErrEnclaveNotFound)
+			return
+		}
+		f(w, r)
+	}
+}
+
 // LimitRequestBody returns an http.HandlerFunc that limits the
 // body of incoming requests to n bytes before calling f.
 //
@@ -122,9 +139,12 @@ func AuditLog(logger *log.Logger, roles *auth.Roles, f http.HandlerFunc) http.Ha
 			ResponseWriter: w,
 			Logger:         logger,
 
-			URL:      *r.URL,
-			Identity: auth.Identify(r, roles.Identify),
-			Time:     time.Now(),
+			URL:       *r.URL,
+			Method:    r.Method,
+			Identity:  auth.Identify(r, roles.Identify),
+			IP:        remoteIP(r),
+			UserAgent: r.UserAgent(),
+			Time:      time.Now(),
 		}
 		f(w, r)
 	}
@@ -140,6 +160,55 @@ func HandleVersion(version string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) { fmt.Fprintf(w, `{"version":"%s"}`, version) }
 }
 
+// HandleStatus returns a handler function that returns
+// the server version and the time elapsed since start.
+func HandleStatus(version string, start time.Time) http.HandlerFunc {
+	type Response struct {
+		Version string        `json:"version"`
+		UpTime  time.Duration `json:"uptime"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Response{
+			Version: version,
+			UpTime:  time.Since(start).Round(time.Second),
+		})
+	}
+}
+
+// API describes an API endpoint of the KES server.
+type API struct {
+	Method  string        // The HTTP method, e.g. POST
+	Path    string        // The API path without any resource name
+	MaxBody int64         // The max. request body size in bytes
+	Timeout time.Duration // The request timeout. 0 if there is none
+}
+
+// HandleListAPIs returns a handler function that returns
+// the given APIs such that clients can detect which APIs
+// the server supports.
+func HandleListAPIs(apis []API) http.HandlerFunc {
+	type Response struct {
+		Method  string `json:"method"`
+		Path    string `json:"path"`
+		MaxBody int64  `json:"max_body"`
+		Timeout int64  `json:"timeout"` // in seconds
+	}
+	responses := make([]Response, 0, len(apis))
+	for _, api := range apis {
+		responses = append(responses, Response{
+			Method:  api.Method,
+			Path:    api.Path,
+			MaxBody: api.MaxBody,
+			Timeout: int64(api.Timeout.Truncate(time.Second).Seconds()),
+		})
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(responses)
+	}
+}
+
 // HandleCreateKey returns a handler function that generates a new
 // random Secret and stores in the Store under the request name, if
 // it doesn't exist.
@@ -234,6 +303,33 @@ func HandleDeleteKey(store *secret.Store) http.HandlerFunc {
 	}
 }
 
+// HandleDescribeKey returns an http.HandlerFunc that returns
+// the name of the key with the request name, if it exists.
+//
+// It never sends the key itself to the client. Therefore, it
+// is a cheap way for a client to check whether a key exists.
+func HandleDescribeKey(store *secret.Store) http.HandlerFunc {
+	var ErrInvalidKeyName = kes.NewError(http.StatusBadRequest, "invalid key name")
+	type Response struct {
+		Name string `json:"name"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := pathBase(r.URL.Path)
+		if name == "" {
+			Error(w, ErrInvalidKeyName)
+			return
+		}
+		if _, err := store.Get(name); err != nil {
+			Error(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Response{
+			Name: name,
+		})
+	}
+}
+
 // HandleGenerateKey returns an http.HandlerFunc that generates
 // a data encryption key (DEK) at random and returns the plaintext
 // and ciphertext version of the DEK to the client. The DEK ciphertext
@@ -281,6 +377,8 @@ func HandleGenerateKey(store *secret.Store) http.HandlerFunc {
 			Error(w, err)
 			return
 		}
+		defer kes.Wipe(dataKey)
+
 		ciphertext, err := secret.Wrap(dataKey, req.Context)
 		if err != nil {
 			Error(w, err)
@@ -386,12 +484,43 @@ func HandleDecryptKey(store *secret.Store) http.HandlerFunc {
 			Error(w, err)
 			return
 		}
+		defer kes.Wipe(plaintext)
+
 		json.NewEncoder(w).Encode(Response{
 			Plaintext: plaintext,
 		})
 	}
 }
 
+// HandleReWrapKey returns an http.HandlerFunc that handles
+// requests to re-encrypt a ciphertext with the latest version
+// of a key.
+//
+// The secret.Store does not version keys. Hence, there is no
+// newer key version to re-encrypt with. Therefore, the returned
+// http.HandlerFunc rejects the request, if the key exists,
+// without decrypting the ciphertext. The client receives an
+// error with a stable error code such that it does not fall
+// back to decrypting and encrypting the ciphertext itself.
+func HandleReWrapKey(store *secret.Store) http.HandlerFunc {
+	var (
+		ErrInvalidKeyName  = kes.NewError(http.StatusBadRequest, "invalid key name")
+		ErrKeyNotVersioned = kes.NewError(http.StatusBadRequest, "key does not support versioning")
+	)
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := pathBase(r.URL.Path)
+		if name == "" {
+			Error(w, ErrInvalidKeyName)
+			return
+		}
+		if _, err := store.Get(name); err != nil {
+			Error(w, err)
+			return
+		}
+		Error(w, ErrKeyNotVersioned)
+	}
+}
+
 // HandleListKeys returns an http.HandlerFunc that lists
 // all keys stored by the secret.Store that match the
 // glob pattern specified by the client.
@@ -571,6 +700,32 @@ func HandleListIdentities(roles *auth.Roles) http.HandlerFunc {
 	}
 }
 
+// HandleDescribeSelf returns a handler function that returns
+// the identity of the client, the name of the policy assigned
+// to it and whether it is the root identity.
+func HandleDescribeSelf(roles *auth.Roles) http.HandlerFunc {
+	type Response struct {
+		Identity kes.Identity `json:"identity"`
+		Policy   string       `json:"policy,omitempty"`
+		IsAdmin  bool         `json:"admin,omitempty"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity := auth.Identify(r, roles.Identify)
+		if identity.IsUnknown() {
+			Error(w, kes.ErrNotAllowed)
+			return
+		}
+		policy, _ := roles.PolicyOf(identity)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Response{
+			Identity: identity,
+			Policy:   policy,
+			IsAdmin:  identity == roles.Root,
+		})
+	}
+}
+
 func HandleForgetIdentity(roles *auth.Roles) http.HandlerFunc {
 	var (
 		ErrIdentityUnknown = kes.NewError(http.StatusBadRequest, "identity is unknown")
@@ -658,3 +813,13 @@ func HandleMetrics(metrics *metric.Metrics) http.HandlerFunc {
 }
 
 func pathBase(p string) string { return path.Base(p) }
+
+// remoteIP returns the IP address of the client
+// that sent the request r.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -6,8 +6,15 @@ package http
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	"github.com/minio/kes"
+	"github.com/minio/kes/internal/mem"
+	"github.com/minio/kes/internal/secret"
 )
 
 var validatePathHandlerTests = []struct {
@@ -60,6 +67,163 @@ func TestValidatePathHandler(t *testing.T) {
 	}
 }
 
+var requireMethodTests = []struct {
+	Method     string
+	Request    string
+	StatusCode int
+}{
+	{Method: http.MethodGet, Request: http.MethodGet, StatusCode: http.StatusOK},                 // 0
+	{Method: http.MethodGet, Request: http.MethodHead, StatusCode: http.StatusMethodNotAllowed},  // 1
+	{Method: http.MethodGet, Request: http.MethodPost, StatusCode: http.StatusMethodNotAllowed},  // 2
+	{Method: http.MethodPost, Request: http.MethodHead, StatusCode: http.StatusMethodNotAllowed}, // 3
+	{Method: http.MethodDelete, Request: http.MethodDelete, StatusCode: http.StatusOK},           // 4
+}
+
+func TestRequireMethod(t *testing.T) {
+	const baseURL = "https://localhost:7373"
+	var f = func(w http.ResponseWriter, req *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	for i, test := range requireMethodTests {
+		req, err := http.NewRequest(test.Request, baseURL+"/v1/status", nil)
+		if err != nil {
+			t.Fatalf("Test %d: failed to create request: %v", i, err)
+		}
+
+		var resp dummyResponseWriter
+		RequireMethod(test.Method, f)(&resp, req)
+		if resp.StatusCode != test.StatusCode {
+			t.Fatalf("Test %d: got status code %d - want %d", i, resp.StatusCode, test.StatusCode)
+		}
+	}
+}
+
+var rejectEnclavesTests = []struct {
+	Path       string
+	StatusCode int
+}{
+	{Path: "/v1/key/create/my-key", StatusCode: http.StatusOK},                        // 0
+	{Path: "/v1/key/create/my-key?enclave=tenant-1", StatusCode: http.StatusNotFound}, // 1
+	{Path: "/v1/key/create/my-key?enclave=", StatusCode: http.StatusNotFound},         // 2
+}
+
+func TestRejectEnclaves(t *testing.T) {
+	const baseURL = "https://localhost:7373"
+	var f = func(w http.ResponseWriter, req *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	for i, test := range rejectEnclavesTests {
+		req, err := http.NewRequest(http.MethodGet, baseURL+test.Path, nil)
+		if err != nil {
+			t.Fatalf("Test %d: failed to create request URL: %v", i, err)
+		}
+
+		var resp dummyResponseWriter
+		RejectEnclaves(f)(&resp, req)
+		if resp.StatusCode != test.StatusCode {
+			t.Fatalf("Test %d: got status code %d - want %d", i, resp.StatusCode, test.StatusCode)
+		}
+	}
+}
+
+func TestHandleDescribeKey(t *testing.T) {
+	store := &secret.Store{Remote: &mem.Store{}}
+	if err := store.Create("my-key", secret.Secret{}); err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/v1/key/describe/", RequireMethod(http.MethodGet, ValidatePath("/v1/key/describe/*", LimitRequestBody(0, HandleDescribeKey(store)))))
+	mux.Handle("/", http.NotFoundHandler())
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &kes.Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	info, err := client.DescribeKey(context.Background(), "my-key")
+	if err != nil {
+		t.Fatalf("Failed to describe key: %v", err)
+	}
+	if info.Name != "my-key" {
+		t.Fatalf("Invalid key name: got '%s' - want '%s'", info.Name, "my-key")
+	}
+	if _, err = client.DescribeKey(context.Background(), "other-key"); err != kes.ErrKeyNotFound {
+		t.Fatalf("Invalid error: got %v - want %v", err, kes.ErrKeyNotFound)
+	}
+
+	// A server without the describe API responds with a plain 404.
+	oldServer := httptest.NewServer(http.NotFoundHandler())
+	defer oldServer.Close()
+
+	client = &kes.Client{Endpoint: oldServer.URL, HTTPClient: *oldServer.Client()}
+	var notSupported kes.NotSupportedError
+	if _, err = client.DescribeKey(context.Background(), "my-key"); !errors.As(err, &notSupported) {
+		t.Fatalf("Invalid error: got %v - want %T", err, notSupported)
+	}
+}
+
+func TestHandleReWrapKey(t *testing.T) {
+	store := &secret.Store{Remote: &mem.Store{}}
+	if err := store.Create("my-key", secret.Secret{}); err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+
+	var requests []string
+	mux := http.NewServeMux()
+	mux.Handle("/v1/key/rewrap/", RequireMethod(http.MethodPost, ValidatePath("/v1/key/rewrap/*", LimitRequestBody(1<<20, HandleReWrapKey(store)))))
+	mux.Handle("/", http.NotFoundHandler())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		mux.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	client := &kes.Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	_, err := client.ReWrap(context.Background(), "my-key", []byte("ciphertext"), nil)
+	if err != (kes.KeyVersioningError{Key: "my-key"}) {
+		t.Fatalf("Invalid error: got %v - want %v", err, kes.KeyVersioningError{Key: "my-key"})
+	}
+	if len(requests) != 1 {
+		t.Fatalf("Client fell back to decrypt and encrypt: got requests %v", requests)
+	}
+	if _, err = client.ReWrap(context.Background(), "other-key", []byte("ciphertext"), nil); err != kes.ErrKeyNotFound {
+		t.Fatalf("Invalid error: got %v - want %v", err, kes.ErrKeyNotFound)
+	}
+}
+
+var keyExistsTests = []struct {
+	Name   string
+	Exists bool
+}{
+	{Name: "my-key", Exists: true},     // 0
+	{Name: "other-key", Exists: false}, // 1
+}
+
+func TestKeyExists(t *testing.T) {
+	store := &secret.Store{Remote: &mem.Store{}}
+	if err := store.Create("my-key", secret.Secret{}); err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+
+	server := httptest.NewServer(RequireMethod(http.MethodGet, ValidatePath("/v1/key/describe/*", LimitRequestBody(0, HandleDescribeKey(store)))))
+	defer server.Close()
+
+	client := &kes.Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	for i, test := range keyExistsTests {
+		exists, err := client.KeyExists(context.Background(), test.Name)
+		if err != nil {
+			t.Fatalf("Test %d: failed to check whether key exists: %v", i, err)
+		}
+		if exists != test.Exists {
+			t.Fatalf("Test %d: got %v - want %v", i, exists, test.Exists)
+		}
+	}
+
+	// A key name that is not a valid path segment
+	// is rejected by the server and must not be
+	// reported as non-existing key.
+	if _, err := client.KeyExists(context.Background(), "my-key/x"); err == nil {
+		t.Fatal("KeyExists succeeded for an invalid key name")
+	}
+}
+
 var (
 	_ http.ResponseWriter = (*dummyResponseWriter)(nil)
 	_ http.Flusher        = (*dummyResponseWriter)(nil)
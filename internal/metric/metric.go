@@ -5,6 +5,7 @@
 package metric
 
 import (
+	"io"
 	"net/http"
 	"strconv"
 	"time"
@@ -43,12 +44,26 @@ func New() *Metrics {
 			Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1.0, 1.5, 3.0, 5.0, 10.0}, // from 10ms to 10s
 			Help:      "Histogram of request response times spawning from 10ms to 10s.",
 		}),
+		requestActive: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "kes",
+			Subsystem: "http",
+			Name:      "request_active",
+			Help:      "Number of active requests that are not finished, yet.",
+		}),
+		auditEvents: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "kes",
+			Subsystem: "log",
+			Name:      "audit_events",
+			Help:      "Number of audit log events written to the audit log targets.",
+		}),
 	}
 
 	metrics.registry.MustRegister(metrics.requestSucceeded)
 	metrics.registry.MustRegister(metrics.requestErrored)
 	metrics.registry.MustRegister(metrics.requestFailed)
 	metrics.registry.MustRegister(metrics.requestLatency)
+	metrics.registry.MustRegister(metrics.requestActive)
+	metrics.registry.MustRegister(metrics.auditEvents)
 	return metrics
 }
 
@@ -61,6 +76,8 @@ type Metrics struct {
 	requestFailed    prometheus.Counter
 	requestErrored   prometheus.Counter
 	requestLatency   prometheus.Histogram
+	requestActive    prometheus.Gauge
+	auditEvents      prometheus.Counter
 }
 
 // EncodeTo collects all outstanding metrics information
@@ -85,8 +102,14 @@ func (m *Metrics) EncodeTo(encoder expfmt.Encoder) error {
 // Count distingushes requests that fail with some sort of
 // well-defined error (HTTP 4xx) and requests that fail due
 // to some internal error (HTTP 5xx).
+//
+// Count also tracks how many requests are currently
+// active - i.e. have been received but not finished.
 func (m *Metrics) Count(h http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		m.requestActive.Inc()
+		defer m.requestActive.Dec()
+
 		h(&countResponseWriter{
 			ResponseWriter: w,
 			flusher:        w.(http.Flusher),
@@ -97,6 +120,16 @@ func (m *Metrics) Count(h http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// AuditEventCounter returns an io.Writer that counts
+// how many audit events have been written to it.
+//
+// It expects that each audit event is written by a
+// single Write call - as done by a log.Logger - and
+// should be added as audit log target.
+func (m *Metrics) AuditEventCounter() io.Writer {
+	return auditEventCounter{counter: m.auditEvents}
+}
+
 // Latency returns a HandlerFunc that wraps h and measures the
 // internal request-response latency.
 //
@@ -194,3 +227,14 @@ func (w *countResponseWriter) Flush() {
 		w.flusher.Flush()
 	}
 }
+
+// auditEventCounter is an io.Writer that
+// counts one audit event per Write call.
+type auditEventCounter struct {
+	counter prometheus.Counter
+}
+
+func (w auditEventCounter) Write(p []byte) (int, error) {
+	w.counter.Inc()
+	return len(p), nil
+}
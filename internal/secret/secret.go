@@ -180,7 +180,7 @@ func (s Secret) Unwrap(ciphertext []byte, associatedData []byte) ([]byte, error)
 	}
 	plaintext, err := aead.Open(nil, sealedSecret.Nonce, sealedSecret.Bytes, associatedData)
 	if err != nil {
-		return nil, kes.NewError(http.StatusBadRequest, "ciphertext is not authentic")
+		return nil, kes.ErrDecrypt
 	}
 	return plaintext, nil
 }
@@ -6,23 +6,43 @@ package kes
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
 // NewErrorStream returns an new ErrorStream that
 // splits r into lines and tries to parse each
 // line as JSON-encoded ErrorEvent.
-func NewErrorStream(r io.Reader) *ErrorStream {
-	s := &ErrorStream{
-		scanner: bufio.NewScanner(r),
+//
+// The ErrorStream can be customized via StreamOptions.
+func NewErrorStream(r io.Reader, options ...StreamOption) *ErrorStream {
+	return &ErrorStream{
+		stream: newStream(r, options),
+		event:  new(ErrorEvent),
 	}
-	if closer, ok := r.(io.Closer); ok {
-		s.closer = closer
+}
+
+// NewGzipErrorStream returns a new ErrorStream that
+// reads gzip-compressed ErrorEvents from r. It returns
+// an error if r does not start with a valid gzip header.
+//
+// Closing the returned ErrorStream closes the gzip
+// decompressor and r, if it implements io.Closer.
+func NewGzipErrorStream(r io.Reader, options ...StreamOption) (*ErrorStream, error) {
+	gz, err := newGzipReader(r)
+	if err != nil {
+		return nil, err
 	}
-	return s
+	return NewErrorStream(gz, options...), nil
 }
 
 // ErrorStream provides a convenient interface for
@@ -43,31 +63,116 @@ func NewErrorStream(r io.Reader) *ErrorStream {
 // if it implements io.Closer, and any subsequent call to
 // Next will return false.
 type ErrorStream struct {
-	scanner *bufio.Scanner
+	stream *stream
+	event  *ErrorEvent // shared with derived streams
 
-	event ErrorEvent
-	err   error
+	// next advances a derived stream, e.g. a
+	// filtered stream, to its next ErrorEvent.
+	// It is nil for the underlying stream.
+	next func(context.Context) bool
 
-	closer io.Closer
-	closed bool
+	count  uint64 // number of events returned by Next
+	repeat int    // number of events collapsed into the current one, see Dedup
 }
 
 // Err returns the first non-EOF error that was encountered
 // while iterating over the stream and un-marshaling ErrorEvents.
+// If the iteration stopped because the stream has been closed
+// Err returns ErrStreamClosed. It returns nil if the iteration
+// stopped at the end of the stream.
 //
 // Err does not return any error returned from Close.
-func (s *ErrorStream) Err() error { return s.err }
+func (s *ErrorStream) Err() error { return s.stream.err }
+
+// State returns the ErrorStream's StreamState. Once Next
+// returned false, the state tells why the stream stopped.
+// For example, a stream in the StreamEOF state reached the
+// end of the underlying io.Reader while a StreamErrored
+// stream stopped due to the error returned by Err.
+//
+// State must not be called concurrently with Next.
+func (s *ErrorStream) State() StreamState { return s.stream.state() }
 
 // Event returns the most recent ErrorEvent generated by a
 // call to Next.
-func (s *ErrorStream) Event() ErrorEvent { return s.event }
+func (s *ErrorStream) Event() ErrorEvent { return *s.event }
+
+// MaxEventSize returns the maximum size of a single
+// ErrorEvent. A larger event stops the iteration.
+func (s *ErrorStream) MaxEventSize() int { return s.stream.config.MaxEventSize }
+
+// Count returns the number of ErrorEvents that
+// have been returned by Next so far. It does
+// not include empty lines nor any ErrorEvents that
+// have been skipped or filtered out.
+func (s *ErrorStream) Count() uint64 { return s.count }
+
+// InvalidCount returns the number of invalid ErrorEvents
+// that have been skipped. It is always zero unless the
+// stream has been created with the WithSkipInvalid option.
+func (s *ErrorStream) InvalidCount() int { return s.stream.invalid }
+
+// LastDecodeError returns the most recent error that
+// occurred while un-marshaling an invalid ErrorEvent
+// that has been skipped. It is always nil unless the
+// stream has been created with the WithSkipInvalid option.
+func (s *ErrorStream) LastDecodeError() error {
+	if !s.stream.config.SkipInvalid {
+		return nil
+	}
+	return s.stream.decodeErr
+}
+
+// IOErr returns the most recent error that occurred while
+// reading from the underlying io.Reader - e.g. a network
+// error or bufio.ErrTooLong if an ErrorEvent is too large.
+// In contrast to Err, it never returns an un-marshaling
+// error, ErrStreamClosed or a context error.
+func (s *ErrorStream) IOErr() error { return s.stream.ioErr }
+
+// DecodeErr returns the most recent error that occurred
+// while un-marshaling an ErrorEvent - regardless of whether
+// the ErrorEvent has been skipped or stopped the iteration.
+// In contrast to Err, it never returns an I/O error.
+func (s *ErrorStream) DecodeErr() error { return s.stream.decodeErr }
+
+// TeeErr returns the first error that occurred while
+// writing an ErrorEvent to the io.Writer set via the
+// WithTee option. It is always nil unless the stream
+// has been created with the WithTee option.
+func (s *ErrorStream) TeeErr() error { return s.stream.teeErr }
+
+// LastGap returns the time span of the most recent re-connect
+// of a stream returned by Client.ErrorLogRetry. The start is
+// the time when the connection broke and the end the time when
+// the stream has re-connected. ErrorEvents produced during the
+// gap may be missing. The end is zero while re-connecting.
+//
+// LastGap returns false if the connection has not broken
+// so far or if the stream does not re-connect at all.
+func (s *ErrorStream) LastGap() (start, end time.Time, missed bool) {
+	if r, ok := s.stream.reader.(*reconnectReader); ok {
+		return r.lastGap()
+	}
+	return start, end, false
+}
 
 // Bytes returns the most recent raw ErrorEvent content generated
 // by a call to Next. It may not contain valid JSON.
 //
 // The underlying array may point to data that will be overwritten
-// by a subsequent call to Next. It does no allocation.
-func (s *ErrorStream) Bytes() []byte { return s.scanner.Bytes() }
+// by a subsequent call to Next. It does no allocation - unless
+// the stream has been created with the WithSafeBytes option.
+func (s *ErrorStream) Bytes() []byte { return s.stream.Bytes() }
+
+// RawCopy returns a copy of the most recent raw ErrorEvent
+// content generated by a call to Next. In contrast to Bytes,
+// the returned slice is not modified by subsequent calls to
+// Next.
+//
+// RawCopy returns nil unless the stream has been created with
+// the WithRetainRaw option.
+func (s *ErrorStream) RawCopy() []byte { return s.stream.raw }
 
 // Next advances the stream to the next ErrorEvent, which will then
 // be available through the Event and Bytes method. It returns false
@@ -75,43 +180,177 @@ func (s *ErrorStream) Bytes() []byte { return s.scanner.Bytes() }
 // stream, closing the stream or in case of an error.
 // After Next returns false, the Err method will return any error that
 // occurred while iterating and parsing the stream.
-func (s *ErrorStream) Next() bool {
-	if s.err != nil || s.closed {
-		return false
+func (s *ErrorStream) Next() bool { return s.NextContext(context.Background()) }
+
+// NextContext behaves like Next but stops the iteration
+// once the ctx.Done() channel completes. Then, Err returns
+// ctx.Err().
+//
+// If the underlying io.Reader implements io.Closer,
+// NextContext closes it once ctx.Done() completes to
+// unblock a pending read. Therefore, the ErrorStream
+// cannot be used anymore once ctx has been canceled.
+func (s *ErrorStream) NextContext(ctx context.Context) bool {
+	var ok bool
+	if s.next != nil {
+		ok = s.next(ctx)
+	} else {
+		ok = s.stream.nextContext(ctx, s.event)
 	}
+	if ok {
+		s.count++
+	}
+	return ok
+}
 
-	// Iterate over the stream until we find a non-empty line.
-	for {
-		if !s.scanner.Scan() {
-			if !s.closed { // Once the stream is closed we ignore the error
-				s.err = s.scanner.Err()
-			}
-			return false
-		}
-		if len(s.scanner.Bytes()) != 0 {
-			break
+// Range calls fn for each ErrorEvent of the stream until
+// fn returns false or the iteration stops. It returns the
+// error, if any, that stopped the iteration. Returning false
+// from fn stops the iteration without an error.
+//
+// Range does not close the stream.
+func (s *ErrorStream) Range(fn func(ErrorEvent) bool) error {
+	for s.Next() {
+		if !fn(*s.event) {
+			return nil
 		}
 	}
-	if err := json.Unmarshal(s.scanner.Bytes(), &s.event); err != nil {
-		if !s.closed { // Once the stream is closed we ignore the error
-			s.err = err
-		}
-		return false
-	}
-	return true
+	return s.Err()
 }
 
 // Close closes the underlying stream - i.e. the io.Reader if
 // if implements io.Closer. After Close has been called once
 // the Next method will return false.
-func (s *ErrorStream) Close() (err error) {
-	if s.closer != nil {
-		s.closed = true
-		err = s.closer.Close()
+func (s *ErrorStream) Close() error { return s.stream.Close() }
+
+// CloseWithContext behaves like Close but reads and discards
+// the remaining content of the underlying io.Reader before
+// closing it. For an HTTP response body, this allows the
+// http.Transport to reuse the connection.
+//
+// If the ctx.Done() channel completes before the end of the
+// stream has been reached, CloseWithContext closes the stream
+// without reading the remaining content. Hence, for a stream
+// that does not end on its own, e.g. the server error log,
+// the ctx should have a deadline.
+//
+// CloseWithContext must not be called concurrently to Next.
+func (s *ErrorStream) CloseWithContext(ctx context.Context) error {
+	return s.stream.closeWithContext(ctx)
+}
+
+// Filter returns an ErrorStream that only contains
+// the ErrorEvents of s with a message that matches
+// the regular expression re.
+//
+// It is equivalent to:
+//   s.FilterFunc(func(e ErrorEvent) bool { return re.MatchString(e.Message) })
+func (s *ErrorStream) Filter(re *regexp.Regexp) *ErrorStream {
+	return s.FilterFunc(func(event ErrorEvent) bool { return re.MatchString(event.Message) })
+}
+
+// FilterFunc returns an ErrorStream that only contains
+// the ErrorEvents of s for which keep returns true.
+// Its Next method advances past any ErrorEvent rejected
+// by keep. Rejected ErrorEvents do not stop the iteration.
+//
+// The returned ErrorStream shares the underlying stream
+// with s. Closing one of them closes both.
+func (s *ErrorStream) FilterFunc(keep func(ErrorEvent) bool) *ErrorStream {
+	return &ErrorStream{
+		stream: s.stream,
+		event:  s.event,
+		next: func(ctx context.Context) bool {
+			for s.NextContext(ctx) {
+				if keep(*s.event) {
+					return true
+				}
+			}
+			return false
+		},
 	}
-	return err
 }
 
+// Dedup returns an ErrorStream that collapses consecutive
+// ErrorEvents of s with the same message. Once an ErrorEvent
+// has been returned, any ErrorEvent with the same message
+// received within the given time window gets suppressed.
+//
+// The number of suppressed ErrorEvents is reported by the
+// RepeatCount method. An ErrorEvent with the same message
+// received after the window has passed is returned with
+// the number of ErrorEvents suppressed before it. If an
+// ErrorEvent with a different message is received, or s
+// reaches its end, while ErrorEvents are suppressed, the
+// most recent suppressed ErrorEvent is returned first,
+// with the number of suppressed ErrorEvents.
+//
+// Hence, ErrorEvents with a different message are never
+// delayed.
+//
+// The returned ErrorStream shares the underlying stream
+// with s. Closing one of them closes both.
+func (s *ErrorStream) Dedup(window time.Duration) *ErrorStream {
+	var (
+		d = &ErrorStream{
+			stream: s.stream,
+			event:  s.event,
+		}
+
+		last     string    // message of the most recent returned event
+		since    time.Time // when the most recent event has been returned
+		returned bool      // whether any event has been returned yet
+
+		suppressed ErrorEvent // most recent suppressed event
+		repeat     int        // number of suppressed events
+
+		stash   ErrorEvent // event received but not returned yet
+		stashed bool
+
+		clock = clockOrDefault(s.stream.config.Clock)
+	)
+	d.next = func(ctx context.Context) bool {
+		for {
+			var event ErrorEvent
+			if stashed {
+				event, stashed = stash, false
+			} else if s.NextContext(ctx) {
+				event = *s.event
+			} else {
+				if repeat > 0 { // Report suppressed events before stopping
+					*d.event, d.repeat, repeat = suppressed, repeat, 0
+					return true
+				}
+				return false
+			}
+
+			now := clock.Now()
+			if returned && event.Message == last {
+				if now.Sub(since) < window {
+					suppressed = event
+					repeat++
+					continue
+				}
+			} else if repeat > 0 {
+				stash, stashed = event, true
+				*d.event, d.repeat, repeat = suppressed, repeat, 0
+				return true
+			}
+
+			*d.event, d.repeat, repeat = event, repeat, 0
+			last, since, returned = event.Message, now, true
+			return true
+		}
+	}
+	return d
+}
+
+// RepeatCount returns the number of ErrorEvents that
+// have been collapsed into the most recent ErrorEvent
+// generated by a call to Next. It is only non-zero for
+// streams returned by Dedup.
+func (s *ErrorStream) RepeatCount() int { return s.repeat }
+
 // ErrorEvent is the event type the KES server produces when it
 // encounters and logs an error.
 //
@@ -119,20 +358,230 @@ func (s *ErrorStream) Close() (err error) {
 // receives a stream of JSON-encoded error events separated
 // by a newline.
 type ErrorEvent struct {
-	Message string `json:"message"` // The logged error message
+	Message string    `json:"message"`         // The logged error message
+	Level   string    `json:"level,omitempty"` // The severity of the error. Older servers don't send it
+	Time    time.Time `json:"time"`            // The point in time when the error occurred. Older servers don't send it
+
+	// Fields contains structured context about the error,
+	// e.g. the key name or the identity. Older servers don't
+	// send it. Then Fields is nil.
+	Fields map[string]interface{} `json:"fields,omitempty"`
 }
 
+// HasTime returns true if and only if the ErrorEvent
+// contains a point in time. Older servers do not send
+// the time of an ErrorEvent.
+func (e ErrorEvent) HasTime() bool { return !e.Time.IsZero() }
+
+// reset resets all fields of e such that
+// it can be used to decode another event.
+func (e *ErrorEvent) reset() { *e = ErrorEvent{} }
+
+// MarshalJSON returns the ErrorEvent's JSON representation.
+// It omits the time if the ErrorEvent does not contain one.
+func (e ErrorEvent) MarshalJSON() ([]byte, error) {
+	type ErrorEventJSON struct {
+		Message string                 `json:"message"`
+		Level   string                 `json:"level,omitempty"`
+		Time    *time.Time             `json:"time,omitempty"`
+		Fields  map[string]interface{} `json:"fields,omitempty"`
+	}
+	event := ErrorEventJSON{
+		Message: e.Message,
+		Level:   e.Level,
+		Fields:  e.Fields,
+	}
+	if e.HasTime() {
+		event.Time = &e.Time
+	}
+	return json.Marshal(event)
+}
+
+// Field returns the value of the structured field with
+// the given key and true, if the ErrorEvent contains such
+// a field. Otherwise, it returns nil and false.
+func (e ErrorEvent) Field(key string) (interface{}, bool) {
+	value, ok := e.Fields[key]
+	return value, ok
+}
+
+// Severity returns the severity Level of the ErrorEvent.
+//
+// It returns LevelUnspecified if the ErrorEvent does
+// not contain a level - e.g. because it has been produced
+// by an older server - or if the level is not known.
+func (e ErrorEvent) Severity() Level {
+	switch strings.ToLower(strings.TrimSpace(e.Level)) {
+	case "info":
+		return LevelInfo
+	case "warn", "warning":
+		return LevelWarn
+	case "error":
+		return LevelError
+	default:
+		return LevelUnspecified
+	}
+}
+
+// Level is the severity of an ErrorEvent.
+type Level string
+
+// All valid ErrorEvent severity levels.
+const (
+	LevelUnspecified Level = ""
+	LevelInfo        Level = "info"
+	LevelWarn        Level = "warn"
+	LevelError       Level = "error"
+)
+
+// String returns the string representation
+// of the Level.
+func (l Level) String() string { return string(l) }
+
 // NewAuditStream returns a new AuditStream that
 // splits r into lines and tries to parse each
 // line as JSON-encoded AuditEvent.
-func NewAuditStream(r io.Reader) *AuditStream {
-	s := &AuditStream{
-		scanner: bufio.NewScanner(r),
+//
+// The AuditStream can be customized via StreamOptions.
+func NewAuditStream(r io.Reader, options ...StreamOption) *AuditStream {
+	return &AuditStream{
+		stream: newStream(r, options),
+		event:  new(AuditEvent),
+	}
+}
+
+// NewGzipAuditStream returns a new AuditStream that
+// reads gzip-compressed AuditEvents from r. It returns
+// an error if r does not start with a valid gzip header.
+//
+// Closing the returned AuditStream closes the gzip
+// decompressor and r, if it implements io.Closer.
+func NewGzipAuditStream(r io.Reader, options ...StreamOption) (*AuditStream, error) {
+	gz, err := newGzipReader(r)
+	if err != nil {
+		return nil, err
 	}
-	if closer, ok := r.(io.Closer); ok {
-		s.closer = closer
+	return NewAuditStream(gz, options...), nil
+}
+
+// NewAuditStreamAt returns a new AuditStream that reads
+// AuditEvents from r starting at the given offset. It
+// seeks to the offset before reading.
+//
+// It allows resuming a stream, e.g. of an archived audit
+// log file, at the Offset of a previous AuditStream. The
+// Offset of the returned AuditStream starts at offset.
+func NewAuditStreamAt(r io.ReadSeeker, offset int64, options ...StreamOption) (*AuditStream, error) {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
 	}
-	return s
+	stream := NewAuditStream(r, options...)
+	stream.stream.consumed = offset
+	stream.offset = offset
+	return stream, nil
+}
+
+// ValidateAuditLog reads r until the end and checks that
+// each non-empty line is a JSON-encoded AuditEvent. It
+// returns the number of valid AuditEvents, the first error
+// encountered and the line number, starting at 1, of the
+// line that caused the error. If all lines are valid, it
+// returns a nil error and a line number of 0.
+//
+// Lines larger than the DefaultMaxEventSize stop the
+// validation with bufio.ErrTooLong. Similarly, an error
+// returned by r stops the validation.
+func ValidateAuditLog(r io.Reader) (valid int, firstErr error, firstErrLine int) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), DefaultMaxEventSize)
+
+	var line int
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var event AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			if firstErr == nil {
+				firstErr, firstErrLine = err, line
+			}
+			continue
+		}
+		valid++
+	}
+	if err := scanner.Err(); err != nil && firstErr == nil {
+		firstErr, firstErrLine = err, line+1
+	}
+	return valid, firstErr, firstErrLine
+}
+
+// ErrNoAuditChain is the error returned by VerifyAuditChain
+// if an audit log does not contain a hash chain - e.g. because
+// the server does not emit Hash and PrevHash fields.
+var ErrNoAuditChain = errors.New("kes: audit log contains no hash chain")
+
+// VerifyAuditChain reads r until the end and checks that the
+// AuditEvents form an unbroken hash chain - i.e. that the
+// PrevHash of each AuditEvent is equal to the Hash of the
+// preceding AuditEvent. Empty lines are ignored.
+//
+// It returns the number of verified AuditEvents and the line
+// number, starting at 1, of the first AuditEvent that does not
+// link to its predecessor. If the chain is intact, it returns
+// a line number of 0. The PrevHash of the first AuditEvent is
+// not checked since an archived log may start in the middle
+// of the server's audit log.
+//
+// VerifyAuditChain checks the links between AuditEvents but
+// does not recompute their hashes.
+//
+// It returns ErrNoAuditChain if the first AuditEvent has
+// neither a Hash nor a PrevHash or if r contains no AuditEvent
+// at all. A line that is not a JSON-encoded AuditEvent, lines
+// larger than the DefaultMaxEventSize and errors returned by
+// r stop the verification with an error and the line number.
+func VerifyAuditChain(r io.Reader) (verified int, brokenAt int, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), DefaultMaxEventSize)
+
+	var (
+		line     int
+		chained  bool
+		prevHash string
+	)
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var event AuditEvent
+		if err = json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return verified, line, err
+		}
+		if !chained {
+			if event.Hash == "" && event.PrevHash == "" {
+				return 0, 0, ErrNoAuditChain
+			}
+			chained = true
+		} else if event.PrevHash != prevHash {
+			return verified, line, nil
+		}
+		if event.Hash == "" {
+			return verified, line, nil
+		}
+		prevHash = event.Hash
+		verified++
+	}
+	if err = scanner.Err(); err != nil {
+		return verified, line + 1, err
+	}
+	if !chained {
+		return 0, 0, ErrNoAuditChain
+	}
+	return verified, 0, nil
 }
 
 // AuditStream provides a convenient interface for
@@ -153,31 +602,150 @@ func NewAuditStream(r io.Reader) *AuditStream {
 // if it implements io.Closer, and any subsequent call to
 // Next will return false.
 type AuditStream struct {
-	scanner *bufio.Scanner
+	count uint64 // number of events returned by Next. Accessed atomically, must be 64-bit aligned
+
+	stream *stream
+	event  *AuditEvent // shared with derived streams
 
-	event AuditEvent
-	err   error
+	// next advances a derived stream, e.g. a
+	// filtered stream, to its next AuditEvent.
+	// It is nil for the underlying stream.
+	next func(context.Context) bool
 
-	closer io.Closer
-	closed bool
+	peek       AuditEvent // the next event, see Peek
+	peeked     bool       // whether peek holds the next event
+	peekOffset int64      // the offset after the peeked event
+
+	offset int64  // the offset after the most recent event, see Offset
+	token  string // the ID of the most recent event with an ID, see Token
 }
 
 // Err returns the first non-EOF error that was encountered
 // while iterating over the stream and un-marshaling AuditEvents.
+// If the iteration stopped because the stream has been closed
+// Err returns ErrStreamClosed. It returns nil if the iteration
+// stopped at the end of the stream.
 //
 // Err does not return any error returned from Close.
-func (s *AuditStream) Err() error { return s.err }
+func (s *AuditStream) Err() error { return s.stream.err }
+
+// State returns the AuditStream's StreamState. Once Next
+// returned false, the state tells why the stream stopped.
+// For example, a stream in the StreamEOF state reached the
+// end of the underlying io.Reader while a StreamErrored
+// stream stopped due to the error returned by Err.
+//
+// State must not be called concurrently with Next.
+func (s *AuditStream) State() StreamState {
+	if s.peeked { // Next will return the peeked event
+		return StreamActive
+	}
+	return s.stream.state()
+}
 
 // Event returns the most recent AuditEvent generated by a
 // call to Next.
-func (s *AuditStream) Event() AuditEvent { return s.event }
+func (s *AuditStream) Event() AuditEvent { return *s.event }
+
+// MaxEventSize returns the maximum size of a single
+// AuditEvent. A larger event stops the iteration.
+func (s *AuditStream) MaxEventSize() int { return s.stream.config.MaxEventSize }
+
+// Count returns the number of AuditEvents that
+// have been returned by Next so far. It does
+// not include empty lines nor any AuditEvents that
+// have been skipped or filtered out.
+func (s *AuditStream) Count() uint64 { return atomic.LoadUint64(&s.count) }
+
+// Offset returns the number of bytes of the underlying
+// io.Reader that have been consumed up to and including
+// the most recent AuditEvent returned by Next or skipped
+// by Skip. Empty lines and events skipped because they
+// are invalid or filtered out count as consumed as well.
+//
+// A stream can be resumed at the Offset, e.g. after a
+// restart, via NewAuditStreamAt without processing any
+// AuditEvent twice. For a stream created with
+// NewGzipAuditStream, Offset refers to the uncompressed
+// content.
+func (s *AuditStream) Offset() int64 { return s.offset }
+
+// Token returns the ID of the most recent AuditEvent
+// returned by Next that carries an ID. Before Next has
+// returned such an event, Token returns the token passed
+// to WithResumeToken, if any. AuditEvents skipped by Skip
+// are not parsed and do not change the token.
+//
+// A subscription can be resumed after the event via
+// Client.AuditLog and WithResumeToken.
+func (s *AuditStream) Token() string { return s.token }
+
+// Stats returns a snapshot of the stream's statistics.
+// It does not allocate and can be called concurrently
+// to iterating the stream - e.g. to expose the stream's
+// progress periodically.
+//
+// The number of empty lines and bytes read refer to the
+// underlying stream. Hence, a derived stream, e.g. a
+// filtered stream, reports the same values as the stream
+// it has been derived from.
+func (s *AuditStream) Stats() StreamStats {
+	stats := s.stream.stats()
+	stats.Events = atomic.LoadUint64(&s.count)
+	return stats
+}
+
+// InvalidCount returns the number of invalid AuditEvents
+// that have been skipped. It is always zero unless the
+// stream has been created with the WithSkipInvalid option.
+func (s *AuditStream) InvalidCount() int { return s.stream.invalid }
+
+// LastDecodeError returns the most recent error that
+// occurred while un-marshaling an invalid AuditEvent
+// that has been skipped. It is always nil unless the
+// stream has been created with the WithSkipInvalid option.
+func (s *AuditStream) LastDecodeError() error {
+	if !s.stream.config.SkipInvalid {
+		return nil
+	}
+	return s.stream.decodeErr
+}
+
+// IOErr returns the most recent error that occurred while
+// reading from the underlying io.Reader - e.g. a network
+// error or bufio.ErrTooLong if an AuditEvent is too large.
+// In contrast to Err, it never returns an un-marshaling
+// error, ErrStreamClosed or a context error.
+func (s *AuditStream) IOErr() error { return s.stream.ioErr }
+
+// DecodeErr returns the most recent error that occurred
+// while un-marshaling an AuditEvent - regardless of whether
+// the AuditEvent has been skipped or stopped the iteration.
+// In contrast to Err, it never returns an I/O error.
+func (s *AuditStream) DecodeErr() error { return s.stream.decodeErr }
+
+// TeeErr returns the first error that occurred while
+// writing an AuditEvent to the io.Writer set via the
+// WithTee option. It is always nil unless the stream
+// has been created with the WithTee option.
+func (s *AuditStream) TeeErr() error { return s.stream.teeErr }
 
 // Bytes returns the most recent raw AuditEvent content generated
 // by a call to Next. It may not contain valid JSON.
 //
 // The underlying array may point to data that will be overwritten
-// by a subsequent call to Next. It does no allocation.
-func (s *AuditStream) Bytes() []byte { return s.scanner.Bytes() }
+// by a subsequent call to Next. It does no allocation - unless
+// the stream has been created with the WithSafeBytes option.
+func (s *AuditStream) Bytes() []byte { return s.stream.Bytes() }
+
+// RawCopy returns a copy of the most recent raw AuditEvent
+// content generated by a call to Next. In contrast to Bytes,
+// the returned slice is not modified by subsequent calls to
+// Next.
+//
+// RawCopy returns nil unless the stream has been created with
+// the WithRetainRaw option.
+func (s *AuditStream) RawCopy() []byte { return s.stream.raw }
 
 // Next advances the stream to the next AuditEvent, which will then
 // be available through the Event and Bytes method. It returns false
@@ -185,42 +753,304 @@ func (s *AuditStream) Bytes() []byte { return s.scanner.Bytes() }
 // stream, closing the stream or in case of an error.
 // After Next returns false, the Err method will return any error that
 // occurred while iterating and parsing the stream.
-func (s *AuditStream) Next() bool {
-	if s.err != nil || s.closed {
-		return false
+func (s *AuditStream) Next() bool { return s.NextContext(context.Background()) }
+
+// NextContext behaves like Next but stops the iteration
+// once the ctx.Done() channel completes. Then, Err returns
+// ctx.Err().
+//
+// If the underlying io.Reader implements io.Closer,
+// NextContext closes it once ctx.Done() completes to
+// unblock a pending read. Therefore, the AuditStream
+// cannot be used anymore once ctx has been canceled.
+func (s *AuditStream) NextContext(ctx context.Context) bool {
+	var ok bool
+	if s.peeked {
+		*s.event, s.peeked = s.peek, false
+		s.offset = s.peekOffset
+		ok = true
+	} else if ok = s.advance(ctx); ok {
+		s.offset = s.stream.consumed
+	}
+	if ok {
+		s.record(s.event)
 	}
+	return ok
+}
 
-	// Iterate over the stream until we find a non-empty line.
-	for {
-		if !s.scanner.Scan() {
-			if !s.closed { // Once the stream is closed we ignore the error
-				s.err = s.scanner.Err()
-			}
+// NextInto behaves like Next but decodes the next AuditEvent
+// into ev. Callers can pass the same AuditEvent on every call
+// to control allocations. If a custom decoder has been set via
+// WithDecoder, NextInto does not reset ev such that the decoder
+// can reuse ev's memory. The AuditStream does not retain ev.
+//
+// As with Next, empty lines are skipped and, once NextInto
+// returns false, Err returns the error, if any, that stopped
+// the iteration. Event returns a copy of ev.
+//
+// For a derived stream, e.g. a filtered stream, or once Peek
+// has been called, NextInto calls Next and copies the event
+// into ev.
+func (s *AuditStream) NextInto(ev *AuditEvent) bool {
+	if s.next != nil || s.peeked {
+		if !s.Next() {
 			return false
 		}
-		if len(s.scanner.Bytes()) != 0 {
-			break
-		}
+		*ev = *s.event
+		return true
 	}
 
-	if err := json.Unmarshal(s.scanner.Bytes(), &s.event); err != nil {
-		if !s.closed { // Once the stream is closed we ignore the error
-			s.err = err
-		}
+	s.stream.reuse = true
+	ok := s.stream.nextContext(context.Background(), ev)
+	s.stream.reuse = false
+	if !ok {
 		return false
 	}
+	if redact := s.stream.config.Redactor; redact != nil {
+		redact(ev)
+	}
+	*s.event = *ev
+	s.offset = s.stream.consumed
+	s.record(ev)
 	return true
 }
 
+// record updates the stream's event count and resume
+// token once event has been returned by the stream.
+func (s *AuditStream) record(event *AuditEvent) {
+	atomic.AddUint64(&s.count, 1)
+	if event.ID != "" {
+		s.token = event.ID
+	}
+}
+
+// Peek returns the next AuditEvent without advancing
+// the stream. The next call of Next returns the same
+// AuditEvent. Peek does not change the AuditEvent
+// returned by Event. However, once Peek has been called,
+// Bytes and RawCopy refer to the peeked AuditEvent.
+//
+// Peek returns false if there is no next AuditEvent.
+// Then, the Err method returns any error that occurred,
+// just like after Next returns false.
+//
+// Peek must not be called concurrently with Next.
+func (s *AuditStream) Peek() (AuditEvent, bool) {
+	if s.peeked {
+		return s.peek, true
+	}
+
+	event := *s.event
+	if !s.advance(context.Background()) {
+		return AuditEvent{}, false
+	}
+	s.peek, s.peeked = *s.event, true
+	s.peekOffset = s.stream.consumed
+	*s.event = event
+	return s.peek, true
+}
+
+// advance advances the stream to its next
+// AuditEvent.
+func (s *AuditStream) advance(ctx context.Context) bool {
+	if s.next != nil {
+		return s.next(ctx)
+	}
+	if !s.stream.nextContext(ctx, s.event) {
+		return false
+	}
+	if redact := s.stream.config.Redactor; redact != nil {
+		redact(s.event)
+	}
+	return true
+}
+
+// Skip advances the stream past up to n AuditEvents
+// without parsing them. It returns the number of events
+// skipped and the error, if any, that stopped the stream.
+//
+// Skip stops early once the stream reaches its end or
+// encounters an error. In the former case, it returns
+// fewer than n events and a nil error.
+//
+// A derived stream, e.g. a filtered stream, has to parse
+// its events to decide whether to skip them. Hence, Skip
+// is only cheaper than calling Next n times for streams
+// returned by NewAuditStream.
+func (s *AuditStream) Skip(n int) (int, error) {
+	var skipped int
+	if s.peeked && n > 0 {
+		s.peeked = false
+		s.offset = s.peekOffset
+		skipped++
+	}
+	if s.next == nil {
+		if k := s.stream.skip(n - skipped); k > 0 {
+			s.offset = s.stream.consumed
+			skipped += k
+		}
+		return skipped, s.stream.err
+	}
+
+	for skipped < n && s.advance(context.Background()) {
+		s.offset = s.stream.consumed
+		skipped++
+	}
+	return skipped, s.stream.err
+}
+
+// Range calls fn for each AuditEvent of the stream until
+// fn returns false or the iteration stops. It returns the
+// error, if any, that stopped the iteration. Returning false
+// from fn stops the iteration without an error.
+//
+// Range does not close the stream.
+func (s *AuditStream) Range(fn func(AuditEvent) bool) error {
+	for s.Next() {
+		if !fn(*s.event) {
+			return nil
+		}
+	}
+	return s.Err()
+}
+
 // Close closes the underlying stream - i.e. the io.Reader if
 // if implements io.Closer. After Close has been called once
 // the Next method will return false.
-func (s *AuditStream) Close() (err error) {
-	if s.closer != nil {
-		s.closed = true
-		err = s.closer.Close()
+func (s *AuditStream) Close() error { return s.stream.Close() }
+
+// CloseWithContext behaves like Close but reads and discards
+// the remaining content of the underlying io.Reader before
+// closing it. For an HTTP response body, this allows the
+// http.Transport to reuse the connection.
+//
+// If the ctx.Done() channel completes before the end of the
+// stream has been reached, CloseWithContext closes the stream
+// without reading the remaining content. Hence, for a stream
+// that does not end on its own, e.g. the server audit log,
+// the ctx should have a deadline.
+//
+// CloseWithContext must not be called concurrently to Next.
+func (s *AuditStream) CloseWithContext(ctx context.Context) error {
+	return s.stream.closeWithContext(ctx)
+}
+
+// OnlyStatus returns an AuditStream that only contains
+// the AuditEvents of s with a response status code within
+// [min, max]. For example, OnlyStatus(400, 599) returns
+// a stream of all failed requests.
+//
+// It is equivalent to:
+//   s.FilterFunc(func(e AuditEvent) bool {
+//       return e.Response.StatusCode >= min && e.Response.StatusCode <= max
+//   })
+func (s *AuditStream) OnlyStatus(min, max int) *AuditStream {
+	return s.FilterFunc(func(event AuditEvent) bool {
+		return event.Response.StatusCode >= min && event.Response.StatusCode <= max
+	})
+}
+
+// SlowerThan returns an AuditStream that only contains
+// the AuditEvents of s for which the server took longer
+// than d to handle the request - i.e. the Response.Time
+// exceeds d.
+//
+// It is equivalent to:
+//   s.FilterFunc(func(e AuditEvent) bool { return e.Response.Time > d })
+func (s *AuditStream) SlowerThan(d time.Duration) *AuditStream {
+	return s.FilterFunc(func(event AuditEvent) bool { return event.Response.Time > d })
+}
+
+// FilterFunc returns an AuditStream that only contains
+// the AuditEvents of s for which keep returns true.
+// Its Next method advances past any AuditEvent rejected
+// by keep. Rejected AuditEvents do not stop the iteration.
+//
+// The keep function is called with the un-marshaled
+// AuditEvent. Therefore, an AuditEvent that is not
+// valid JSON stops the iteration before keep is called.
+//
+// The returned AuditStream shares the underlying stream
+// with s. Closing one of them closes both.
+func (s *AuditStream) FilterFunc(keep func(AuditEvent) bool) *AuditStream {
+	return &AuditStream{
+		stream: s.stream,
+		event:  s.event,
+		next: func(ctx context.Context) bool {
+			for s.NextContext(ctx) {
+				if keep(*s.event) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+// Limit returns an AuditStream that contains at most the
+// first n AuditEvents of s. Once n AuditEvents have been
+// returned, its Next method returns false. Reaching the
+// limit is not an error. Hence, Err returns nil unless
+// s stopped due to an error before.
+//
+// Limit composes with filters. For example, the following
+// returns the first 100 failed requests:
+//   s.OnlyStatus(400, 599).Limit(100)
+//
+// The returned AuditStream shares the underlying stream
+// with s. Closing one of them closes both.
+func (s *AuditStream) Limit(n int) *AuditStream {
+	var count int
+	return &AuditStream{
+		stream: s.stream,
+		event:  s.event,
+		next: func(ctx context.Context) bool {
+			if count >= n || !s.NextContext(ctx) {
+				return false
+			}
+			count++
+			return true
+		},
 	}
-	return err
+}
+
+// Channel returns a channel that receives the AuditEvents
+// of the stream and a channel that receives the error, if
+// any, that stopped the iteration.
+//
+// Channel starts a goroutine that iterates over the stream
+// until it reaches the end of the stream, encounters an error,
+// the ctx.Done() channel completes or the stream gets closed.
+// Then it sends the error, if any, and closes both channels.
+//
+// Once Channel has been called, the AuditStream must not be
+// used for iterating anymore. However, it can be closed to
+// stop the goroutine.
+func (s *AuditStream) Channel(ctx context.Context) (<-chan AuditEvent, <-chan error) {
+	var (
+		events = make(chan AuditEvent)
+		errCh  = make(chan error, 1)
+	)
+	go func() {
+		defer close(events)
+		defer close(errCh)
+
+		for s.NextContext(ctx) {
+			select {
+			case events <- s.Event():
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			case <-s.stream.done:
+				errCh <- ErrStreamClosed
+				return
+			}
+		}
+		if err := s.Err(); err != nil {
+			errCh <- err
+		}
+	}()
+	return events, errCh
 }
 
 // AuditEvent is the event type the KES server produces when it
@@ -241,13 +1071,142 @@ type AuditEvent struct {
 	// Response contains audit log information
 	// about the response sent to the client.
 	Response AuditEventResponse `json:"response"`
+
+	// ID identifies the audit event within the
+	// server's audit log. It is empty if the server
+	// does not assign IDs to audit events.
+	ID string `json:"id,omitempty"`
+
+	// Hash is the hash of the audit event within
+	// the hash chain over all audit events. It is
+	// empty if the server does not emit a hash chain.
+	// See VerifyAuditChain.
+	Hash string `json:"hash,omitempty"`
+
+	// PrevHash is the Hash of the preceding audit
+	// event. It is empty if the server does not emit
+	// a hash chain.
+	PrevHash string `json:"prev_hash,omitempty"`
 }
 
+// reset resets all fields of a such that
+// it can be used to decode another event.
+func (a *AuditEvent) reset() { *a = AuditEvent{} }
+
 // String returns the AuditEvent's string representation
-// which is valid JSON.
+// which is valid JSON. The ID, Hash and PrevHash are only
+// included if they are not empty.
 func (a *AuditEvent) String() string {
-	const format = `{"time":"%s","request":%s,"response":%s}`
-	return fmt.Sprintf(format, a.Time.Format(time.RFC3339), a.Request.String(), a.Response.String())
+	var sb strings.Builder
+	sb.WriteString(`{"time":"`)
+	sb.WriteString(a.Time.Format(time.RFC3339))
+	sb.WriteString(`","request":`)
+	sb.WriteString(a.Request.String())
+	sb.WriteString(`,"response":`)
+	sb.WriteString(a.Response.String())
+	writeOptional := func(name, value string) {
+		if value != "" {
+			text, _ := json.Marshal(value) // Cannot fail for a string
+			sb.WriteString(`,"` + name + `":`)
+			sb.Write(text)
+		}
+	}
+	writeOptional("id", a.ID)
+	writeOptional("hash", a.Hash)
+	writeOptional("prev_hash", a.PrevHash)
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// MarshalJSON returns the AuditEvent's JSON representation.
+//
+// It is equal to the default JSON encoding of the AuditEvent
+// struct and ensures that the AuditEvent gets encoded as JSON
+// object even though it implements encoding.TextMarshaler.
+func (a AuditEvent) MarshalJSON() ([]byte, error) {
+	type AuditEventJSON AuditEvent
+	return json.Marshal(AuditEventJSON(a))
+}
+
+// MarshalIndentLine returns the AuditEvent's indented JSON
+// representation followed by a newline. It is meant for
+// pretty-printing events - e.g. when replaying an audit log.
+func (a AuditEvent) MarshalIndentLine() ([]byte, error) {
+	text, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(text, '\n'), nil
+}
+
+// MarshalText returns a human-readable, single-line
+// representation of the AuditEvent. It contains the
+// time, identity, request path, response status and
+// the time it took to handle the request. For example:
+//   2021-01-01T10:00:00Z 2ecb8804e7702a6b 200 /v1/key/create/my-key 3ms
+//
+// The identity is shortened to its first 16 characters
+// and the format will not change in future versions.
+func (a AuditEvent) MarshalText() ([]byte, error) {
+	identity := a.Request.Identity
+	if len(identity) > 16 {
+		identity = identity[:16]
+	}
+	if identity == "" {
+		identity = "-"
+	}
+	const format = "%s %s %d %s %v"
+	return []byte(fmt.Sprintf(format, a.Time.UTC().Format(time.RFC3339), identity, a.Response.StatusCode, a.Request.Path, a.Response.Time)), nil
+}
+
+// NewAuditEventWriter returns a new AuditEventWriter
+// that writes AuditEvents to w.
+func NewAuditEventWriter(w io.Writer) *AuditEventWriter {
+	return &AuditEventWriter{
+		writer: bufio.NewWriter(w),
+		out:    w,
+	}
+}
+
+// AuditEventWriter writes AuditEvents as JSON lines - i.e.
+// one JSON-encoded AuditEvent per line. Its output can be
+// read by an AuditStream.
+//
+// An AuditEventWriter buffers its output. Once all AuditEvents
+// have been written, the Flush or Close method should be called
+// to write any buffered data to the underlying io.Writer.
+type AuditEventWriter struct {
+	writer *bufio.Writer
+	out    io.Writer
+}
+
+// Write writes the given AuditEvent as single
+// line of JSON.
+func (w *AuditEventWriter) Write(event AuditEvent) error {
+	text, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err = w.writer.Write(text); err != nil {
+		return err
+	}
+	return w.writer.WriteByte('\n')
+}
+
+// Flush writes any buffered data to the underlying
+// io.Writer.
+func (w *AuditEventWriter) Flush() error { return w.writer.Flush() }
+
+// Close flushes any buffered data and closes the
+// underlying io.Writer if it implements io.Closer.
+func (w *AuditEventWriter) Close() error {
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+	if closer, ok := w.out.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
 }
 
 // AuditEventRequest contains the audit information
@@ -255,16 +1214,46 @@ func (a *AuditEvent) String() string {
 //
 // In particular, it contains the identity of the
 // client and other audit-related information.
+//
+// Older servers do not send the HTTP method, client
+// IP and user agent. Then, these fields are empty.
 type AuditEventRequest struct {
-	Path     string `json:"path"`
-	Identity string `json:"identity"`
+	Path      string `json:"path"`
+	Method    string `json:"method,omitempty"` // The HTTP method - e.g. GET or POST
+	Identity  string `json:"identity"`
+	IP        string `json:"ip,omitempty"`         // The client IP address
+	UserAgent string `json:"user_agent,omitempty"` // The client User-Agent
 }
 
+// IsWrite returns true if the request has been sent with
+// an HTTP method that modifies state at the server - i.e.
+// POST, PUT, PATCH or DELETE.
+//
+// IsWrite returns false if the HTTP method is empty. For
+// example, when the event has been produced by an older
+// server.
+func (a AuditEventRequest) IsWrite() bool {
+	switch a.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// API returns the API operation and the resource name,
+// e.g. the key name, of the request. It returns false
+// if the request path does not refer to any API.
+//
+// For example, the path "/v1/key/create/my-key" refers
+// to the KeyCreate API and the resource name "my-key".
+func (a AuditEventRequest) API() (API, string, bool) { return parseAPI(a.Path) }
+
 // String returns the AuditEventRequest's string representation
 // which is valid JSON.
 func (a *AuditEventRequest) String() string {
-	const format = `{"path":"%s","identity":"%s"}`
-	return fmt.Sprintf(format, a.Path, a.Identity)
+	text, _ := json.Marshal(a) // Cannot fail since an AuditEventRequest only contains strings
+	return string(text)
 }
 
 // AuditEventResponse contains the audit information
@@ -272,14 +1261,22 @@ func (a *AuditEventRequest) String() string {
 //
 // In particular, it contains the response status code
 // and other audit-related information.
+//
+// Older servers do not send the response size. Then,
+// the Size field is zero.
 type AuditEventResponse struct {
 	StatusCode int           `json:"code"`
-	Time       time.Duration `json:"time"`
+	Time       time.Duration `json:"time"`           // The time it took to handle the request
+	Size       int64         `json:"size,omitempty"` // The size of the response body in bytes
 }
 
 // String returns the AuditEventResponse's string
 // representation which is valid JSON.
 func (a *AuditEventResponse) String() string {
-	const format = `{"code":%d,"time":%d}`
-	return fmt.Sprintf(format, a.StatusCode, a.Time)
+	if a.Size == 0 {
+		const format = `{"code":%d,"time":%d}`
+		return fmt.Sprintf(format, a.StatusCode, a.Time)
+	}
+	const format = `{"code":%d,"time":%d,"size":%d}`
+	return fmt.Sprintf(format, a.StatusCode, a.Time, a.Size)
 }
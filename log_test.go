@@ -0,0 +1,1819 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var maxEventSizeTests = []struct {
+	MaxEventSize int
+	Size         int // Size of the event message
+	Err          error
+}{
+	{MaxEventSize: 0, Size: 1 << 10, Err: nil},                               // 0
+	{MaxEventSize: 0, Size: DefaultMaxEventSize, Err: bufio.ErrTooLong},      // 1
+	{MaxEventSize: 1 << 20, Size: DefaultMaxEventSize, Err: nil},             // 2
+	{MaxEventSize: 1 << 10, Size: 1 << 10, Err: bufio.ErrTooLong},            // 3
+	{MaxEventSize: 1 << 10, Size: 512, Err: nil},                             // 4
+	{MaxEventSize: -1, Size: 2 * DefaultMaxEventSize, Err: bufio.ErrTooLong}, // 5
+}
+
+func TestWithMaxEventSize(t *testing.T) {
+	for i, test := range maxEventSizeTests {
+		event := `{"message":"` + strings.Repeat("a", test.Size) + `"}`
+
+		errStream := NewErrorStream(strings.NewReader(event), WithMaxEventSize(test.MaxEventSize))
+		for errStream.Next() {
+		}
+		if err := errStream.Err(); err != test.Err {
+			t.Fatalf("Test %d: got error %v - want error %v", i, err, test.Err)
+		}
+		if test.MaxEventSize > 0 && errStream.MaxEventSize() != test.MaxEventSize {
+			t.Fatalf("Test %d: got max. event size %d - want %d", i, errStream.MaxEventSize(), test.MaxEventSize)
+		}
+		if test.MaxEventSize <= 0 && errStream.MaxEventSize() != DefaultMaxEventSize {
+			t.Fatalf("Test %d: got max. event size %d - want %d", i, errStream.MaxEventSize(), DefaultMaxEventSize)
+		}
+
+		event = `{"request":{"path":"` + strings.Repeat("a", test.Size) + `"}}`
+		auditStream := NewAuditStream(strings.NewReader(event), WithMaxEventSize(test.MaxEventSize))
+		for auditStream.Next() {
+		}
+		if err := auditStream.Err(); err != test.Err {
+			t.Fatalf("Test %d: got error %v - want error %v", i, err, test.Err)
+		}
+	}
+}
+
+func TestNextContext(t *testing.T) {
+	reader, writer := io.Pipe()
+	defer writer.Close()
+
+	go writer.Write([]byte(`{"message":"first event"}` + "\n"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := NewErrorStream(reader)
+	if !stream.NextContext(ctx) {
+		t.Fatalf("Failed to read first event: %v", stream.Err())
+	}
+	if msg := stream.Event().Message; msg != "first event" {
+		t.Fatalf("Invalid event: got '%s' - want '%s'", msg, "first event")
+	}
+
+	time.AfterFunc(10*time.Millisecond, cancel) // Cancel while NextContext waits for the next event
+	if stream.NextContext(ctx) {
+		t.Fatal("NextContext returned true after ctx has been canceled")
+	}
+	if err := stream.Err(); err != context.Canceled {
+		t.Fatalf("Invalid error: got %v - want %v", err, context.Canceled)
+	}
+	if stream.Next() {
+		t.Fatal("Next returned true after ctx has been canceled")
+	}
+}
+
+func TestAuditStreamChannel(t *testing.T) {
+	const Events = `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key"},"response":{"code":200}}
+
+{"time":"2020-03-24T12:38:02Z","request":{"path":"/v1/key/delete/my-key"},"response":{"code":200}}`
+
+	stream := NewAuditStream(strings.NewReader(Events))
+	events, errCh := stream.Channel(context.Background())
+
+	var n int
+	for range events {
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("Invalid number of events: got %d - want %d", n, 2)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("Channel failed: %v", err)
+	}
+
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	go writer.Write([]byte(Events))
+
+	stream = NewAuditStream(reader)
+	events, errCh = stream.Channel(context.Background())
+	<-events // Receive only the first event and close the stream
+	if err := stream.Close(); err != nil {
+		t.Fatalf("Failed to close stream: %v", err)
+	}
+	for range events {
+	}
+	if err := <-errCh; !errors.Is(err, ErrStreamClosed) {
+		t.Fatalf("Invalid error after stream has been closed: got %v - want %v", err, ErrStreamClosed)
+	}
+
+	reader, writer = io.Pipe()
+	defer writer.Close()
+	go writer.Write([]byte(Events))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream = NewAuditStream(reader)
+	events, errCh = stream.Channel(ctx)
+	<-events // Receive only the first event, then cancel and close concurrently
+	cancel()
+	if err := stream.Close(); err != nil {
+		t.Fatalf("Failed to close stream: %v", err)
+	}
+	for range events {
+	}
+	if err := <-errCh; err != context.Canceled && !errors.Is(err, ErrStreamClosed) {
+		t.Fatalf("Invalid error after ctx has been canceled: got %v - want %v", err, context.Canceled)
+	}
+}
+
+var errorStreamFilterTests = []struct {
+	Pattern  string
+	Messages []string
+}{
+	{ // 0
+		Pattern:  ".*",
+		Messages: []string{"policy: access denied", "aws: secret not found", "vault: policy denied"},
+	},
+	{ // 1
+		Pattern:  "policy.*denied",
+		Messages: []string{"policy: access denied", "vault: policy denied"},
+	},
+	{ // 2
+		Pattern:  "^aws:",
+		Messages: []string{"aws: secret not found"},
+	},
+	{ // 3
+		Pattern:  "gemalto",
+		Messages: nil,
+	},
+}
+
+func TestErrorStreamFilter(t *testing.T) {
+	const Events = `{"message":"policy: access denied"}
+{"message":"aws: secret not found"}
+
+{"message":"vault: policy denied"}`
+
+	for i, test := range errorStreamFilterTests {
+		stream := NewErrorStream(strings.NewReader(Events)).Filter(regexp.MustCompile(test.Pattern))
+
+		var messages []string
+		for stream.Next() {
+			messages = append(messages, stream.Event().Message)
+		}
+		if err := stream.Err(); err != nil {
+			t.Fatalf("Test %d: failed to iterate over stream: %v", i, err)
+		}
+		if len(messages) != len(test.Messages) {
+			t.Fatalf("Test %d: got %d events - want %d", i, len(messages), len(test.Messages))
+		}
+		for j := range messages {
+			if messages[j] != test.Messages[j] {
+				t.Fatalf("Test %d: got message '%s' - want '%s'", i, messages[j], test.Messages[j])
+			}
+		}
+	}
+}
+
+func TestAuditStreamFilterFunc(t *testing.T) {
+	const Events = `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key"},"response":{"code":200}}
+{"time":"2020-03-24T12:38:02Z","request":{"path":"/v1/policy/list/*"},"response":{"code":200}}
+{"time":"2020-03-24T12:39:02Z","request":{"path":"/v1/key/delete/my-key"},"response":{"code":200}}`
+
+	stream := NewAuditStream(strings.NewReader(Events)).FilterFunc(func(event AuditEvent) bool {
+		return strings.HasPrefix(event.Request.Path, "/v1/key/")
+	})
+
+	var paths []string
+	for stream.Next() {
+		paths = append(paths, stream.Event().Request.Path)
+		if string(stream.Bytes()) != strings.Split(Events, "\n")[2*(len(paths)-1)] {
+			t.Fatalf("Event %d: raw event does not match un-marshaled event", len(paths)-1)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("Failed to iterate over stream: %v", err)
+	}
+	if n := stream.Count(); n != 2 {
+		t.Fatalf("Invalid event count: got %d - want %d", n, 2)
+	}
+	if len(paths) != 2 || paths[0] != "/v1/key/create/my-key" || paths[1] != "/v1/key/delete/my-key" {
+		t.Fatalf("Invalid events: got %v", paths)
+	}
+}
+
+var skipInvalidTests = []struct {
+	Events       string
+	SkipInvalid  bool
+	Valid        int
+	InvalidCount int
+	Err          bool
+}{
+	{ // 0
+		Events:      `{"message":"a"}` + "\n" + `{"message":}` + "\n" + `{"message":"c"}`,
+		SkipInvalid: false,
+		Valid:       1,
+		Err:         true,
+	},
+	{ // 1
+		Events:       `{"message":"a"}` + "\n" + `{"message":}` + "\n" + `{"message":"c"}`,
+		SkipInvalid:  true,
+		Valid:        2,
+		InvalidCount: 1,
+	},
+	{ // 2
+		Events:       `not json` + "\n\n" + `{"message":1}` + "\n" + `{"message":"c"}`,
+		SkipInvalid:  true,
+		Valid:        1,
+		InvalidCount: 2,
+	},
+}
+
+func TestWithSkipInvalid(t *testing.T) {
+	for i, test := range skipInvalidTests {
+		var options []StreamOption
+		if test.SkipInvalid {
+			options = append(options, WithSkipInvalid())
+		}
+		stream := NewErrorStream(strings.NewReader(test.Events), options...)
+
+		var valid int
+		for stream.Next() {
+			valid++
+		}
+		if err := stream.Err(); (err != nil) != test.Err {
+			t.Fatalf("Test %d: got error %v - want error: %v", i, err, test.Err)
+		}
+		if valid != test.Valid {
+			t.Fatalf("Test %d: got %d valid events - want %d", i, valid, test.Valid)
+		}
+		if n := stream.Count(); n != uint64(test.Valid) {
+			t.Fatalf("Test %d: got event count %d - want %d", i, n, test.Valid)
+		}
+		if n := stream.InvalidCount(); n != test.InvalidCount {
+			t.Fatalf("Test %d: got %d invalid events - want %d", i, n, test.InvalidCount)
+		}
+		if (stream.LastDecodeError() != nil) != (test.InvalidCount > 0) {
+			t.Fatalf("Test %d: invalid last decode error: %v", i, stream.LastDecodeError())
+		}
+	}
+}
+
+var strictDecodingTests = []struct {
+	Event       string
+	SkipInvalid bool
+	Valid       int
+	Err         bool
+}{
+	{Event: `{"message":"a"}`, Valid: 1},                                   // 0
+	{Event: `{"message":"a","unknown":true}`, Valid: 0, Err: true},         // 1
+	{Event: `{"message":"a","unknown":true}`, Valid: 0, SkipInvalid: true}, // 2
+	{Event: `{"message":"a"} {"message":"b"}`, Valid: 0, Err: true},        // 3
+}
+
+func TestWithStrictDecoding(t *testing.T) {
+	for i, test := range strictDecodingTests {
+		options := []StreamOption{WithStrictDecoding()}
+		if test.SkipInvalid {
+			options = append(options, WithSkipInvalid())
+		}
+		stream := NewErrorStream(strings.NewReader(test.Event), options...)
+
+		var valid int
+		for stream.Next() {
+			valid++
+		}
+		if err := stream.Err(); (err != nil) != test.Err {
+			t.Fatalf("Test %d: got error %v - want error: %v", i, err, test.Err)
+		}
+		if valid != test.Valid {
+			t.Fatalf("Test %d: got %d valid events - want %d", i, valid, test.Valid)
+		}
+	}
+}
+
+func TestWithRetainRaw(t *testing.T) {
+	const Events = `{"message":"a"}
+{"message":"b"}`
+
+	stream := NewErrorStream(strings.NewReader(Events))
+	for stream.Next() {
+		if raw := stream.RawCopy(); raw != nil {
+			t.Fatalf("RawCopy returned %q without WithRetainRaw", raw)
+		}
+	}
+
+	var raw [][]byte
+	stream = NewErrorStream(strings.NewReader(Events), WithRetainRaw())
+	for stream.Next() {
+		raw = append(raw, stream.RawCopy())
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("Failed to iterate over stream: %v", err)
+	}
+	for i, line := range strings.Split(Events, "\n") {
+		if string(raw[i]) != line {
+			t.Fatalf("Event %d: got raw content %q - want %q", i, raw[i], line)
+		}
+	}
+}
+
+var errorEventSeverityTests = []struct {
+	Event    string
+	Severity Level
+}{
+	{Event: `{"message":"a"}`, Severity: LevelUnspecified},                 // 0
+	{Event: `{"message":"a","level":"info"}`, Severity: LevelInfo},         // 1
+	{Event: `{"message":"a","level":"WARNING"}`, Severity: LevelWarn},      // 2
+	{Event: `{"message":"a","level":"error"}`, Severity: LevelError},       // 3
+	{Event: `{"message":"a","level":"fatal"}`, Severity: LevelUnspecified}, // 4
+}
+
+func TestErrorEventSeverity(t *testing.T) {
+	for i, test := range errorEventSeverityTests {
+		stream := NewErrorStream(strings.NewReader(test.Event))
+		if !stream.Next() {
+			t.Fatalf("Test %d: failed to parse event: %v", i, stream.Err())
+		}
+		if severity := stream.Event().Severity(); severity != test.Severity {
+			t.Fatalf("Test %d: got severity '%v' - want '%v'", i, severity, test.Severity)
+		}
+	}
+}
+
+var errorEventTimeTests = []struct {
+	Event   string
+	HasTime bool
+	Time    time.Time
+}{
+	{Event: `{"message":"a"}`, HasTime: false}, // 0
+	{Event: `{"message":"a","time":"2021-03-24T12:37:33Z"}`, HasTime: true, Time: time.Date(2021, 3, 24, 12, 37, 33, 0, time.UTC)}, // 1
+}
+
+func TestErrorEventTime(t *testing.T) {
+	for i, test := range errorEventTimeTests {
+		stream := NewErrorStream(strings.NewReader(test.Event))
+		if !stream.Next() {
+			t.Fatalf("Test %d: failed to parse event: %v", i, stream.Err())
+		}
+		event := stream.Event()
+		if event.HasTime() != test.HasTime {
+			t.Fatalf("Test %d: got HasTime %v - want %v", i, event.HasTime(), test.HasTime)
+		}
+		if !event.Time.Equal(test.Time) {
+			t.Fatalf("Test %d: got time %v - want %v", i, event.Time, test.Time)
+		}
+
+		text, err := event.MarshalJSON()
+		if err != nil {
+			t.Fatalf("Test %d: failed to marshal event: %v", i, err)
+		}
+		if string(text) != test.Event {
+			t.Fatalf("Test %d: got JSON %s - want %s", i, text, test.Event)
+		}
+	}
+}
+
+var errorEventFieldsTests = []struct {
+	Event string
+	Key   string
+	Value interface{}
+	OK    bool
+}{
+	{Event: `{"message":"a"}`, Key: "key", OK: false},                                                        // 0
+	{Event: `{"message":"a","fields":{"key":"my-key"}}`, Key: "key", Value: "my-key", OK: true},              // 1
+	{Event: `{"message":"a","fields":{"attempts":3,"key":"my-key"}}`, Key: "attempts", Value: 3.0, OK: true}, // 2
+	{Event: `{"message":"a","fields":{"key":"my-key"}}`, Key: "identity", OK: false},                         // 3
+}
+
+func TestErrorEventFields(t *testing.T) {
+	for i, test := range errorEventFieldsTests {
+		stream := NewErrorStream(strings.NewReader(test.Event))
+		if !stream.Next() {
+			t.Fatalf("Test %d: failed to parse event: %v", i, stream.Err())
+		}
+		event := stream.Event()
+		value, ok := event.Field(test.Key)
+		if ok != test.OK {
+			t.Fatalf("Test %d: got %v - want %v", i, ok, test.OK)
+		}
+		if value != test.Value {
+			t.Fatalf("Test %d: got value %v - want %v", i, value, test.Value)
+		}
+
+		text, err := event.MarshalJSON()
+		if err != nil {
+			t.Fatalf("Test %d: failed to marshal event: %v", i, err)
+		}
+		if string(text) != test.Event {
+			t.Fatalf("Test %d: got JSON %s - want %s", i, text, test.Event)
+		}
+	}
+}
+
+var auditEventRequestStringTests = []struct {
+	Request AuditEventRequest
+	Output  string
+}{
+	{ // 0
+		Request: AuditEventRequest{Path: "/v1/key/create/my-key", Identity: "dd46485b"},
+		Output:  `{"path":"/v1/key/create/my-key","identity":"dd46485b"}`,
+	},
+	{ // 1
+		Request: AuditEventRequest{Path: "/v1/key/create/my-key", Identity: "dd46485b", IP: "10.1.2.3", UserAgent: `curl "7.68"`},
+		Output:  `{"path":"/v1/key/create/my-key","identity":"dd46485b","ip":"10.1.2.3","user_agent":"curl \"7.68\""}`,
+	},
+	{ // 2
+		Request: AuditEventRequest{Path: "/v1/key/delete/my-key", Method: "DELETE", Identity: "dd46485b"},
+		Output:  `{"path":"/v1/key/delete/my-key","method":"DELETE","identity":"dd46485b"}`,
+	},
+}
+
+func TestAuditEventRequestString(t *testing.T) {
+	for i, test := range auditEventRequestStringTests {
+		if output := test.Request.String(); output != test.Output {
+			t.Fatalf("Test %d: got %s - want %s", i, output, test.Output)
+		}
+	}
+}
+
+var auditEventStringTests = []struct {
+	Event  AuditEvent
+	Output string
+}{
+	{ // 0
+		Event: AuditEvent{
+			Time:     time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC),
+			Request:  AuditEventRequest{Path: "/v1/key/create/my-key", Identity: "dd46485b"},
+			Response: AuditEventResponse{StatusCode: 200},
+		},
+		Output: `{"time":"2021-01-01T10:00:00Z","request":{"path":"/v1/key/create/my-key","identity":"dd46485b"},"response":%s}`,
+	},
+	{ // 1
+		Event: AuditEvent{
+			Time:     time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC),
+			Request:  AuditEventRequest{Path: "/v1/key/create/my-key", Identity: "dd46485b"},
+			Response: AuditEventResponse{StatusCode: 200},
+			ID:       "42",
+			Hash:     "a1b2",
+			PrevHash: "c3d4",
+		},
+		Output: `{"time":"2021-01-01T10:00:00Z","request":{"path":"/v1/key/create/my-key","identity":"dd46485b"},"response":%s,"id":"42","hash":"a1b2","prev_hash":"c3d4"}`,
+	},
+	{ // 2
+		Event: AuditEvent{
+			Time:     time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC),
+			Request:  AuditEventRequest{Path: "/v1/key/create/my-key", Identity: "dd46485b"},
+			Response: AuditEventResponse{StatusCode: 200},
+			Hash:     "a1b2",
+		},
+		Output: `{"time":"2021-01-01T10:00:00Z","request":{"path":"/v1/key/create/my-key","identity":"dd46485b"},"response":%s,"hash":"a1b2"}`,
+	},
+}
+
+func TestAuditEventString(t *testing.T) {
+	for i, test := range auditEventStringTests {
+		output := fmt.Sprintf(test.Output, test.Event.Response.String())
+		if s := test.Event.String(); s != output {
+			t.Fatalf("Test %d: got %s - want %s", i, s, output)
+		}
+
+		var event AuditEvent
+		if err := json.Unmarshal([]byte(output), &event); err != nil {
+			t.Fatalf("Test %d: String is not valid JSON: %v", i, err)
+		}
+		if event.ID != test.Event.ID || event.Hash != test.Event.Hash || event.PrevHash != test.Event.PrevHash {
+			t.Fatalf("Test %d: String does not preserve ID and hashes: got %s", i, output)
+		}
+	}
+}
+
+var auditEventRequestIsWriteTests = []struct {
+	Method  string
+	IsWrite bool
+}{
+	{Method: "", IsWrite: false},      // 0
+	{Method: "GET", IsWrite: false},   // 1
+	{Method: "HEAD", IsWrite: false},  // 2
+	{Method: "POST", IsWrite: true},   // 3
+	{Method: "PUT", IsWrite: true},    // 4
+	{Method: "DELETE", IsWrite: true}, // 5
+}
+
+func TestAuditEventRequestIsWrite(t *testing.T) {
+	for i, test := range auditEventRequestIsWriteTests {
+		request := AuditEventRequest{Method: test.Method}
+		if isWrite := request.IsWrite(); isWrite != test.IsWrite {
+			t.Fatalf("Test %d: got %v - want %v", i, isWrite, test.IsWrite)
+		}
+	}
+}
+
+func TestErrStreamClosed(t *testing.T) {
+	const Events = `{"message":"a"}
+{"message":"b"}`
+
+	stream := NewErrorStream(ioutil.NopCloser(strings.NewReader(Events)))
+	if !stream.Next() {
+		t.Fatalf("Failed to read first event: %v", stream.Err())
+	}
+	stream.Close()
+	if stream.Next() {
+		t.Fatal("Next returned true after stream has been closed")
+	}
+	if err := stream.Err(); !errors.Is(err, ErrStreamClosed) {
+		t.Fatalf("Invalid error: got %v - want %v", err, ErrStreamClosed)
+	}
+
+	stream = NewErrorStream(ioutil.NopCloser(strings.NewReader(Events)))
+	for stream.Next() {
+	}
+	stream.Close()
+	if stream.Next() {
+		t.Fatal("Next returned true after stream has been closed")
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("Closing a stream after reaching its end changed its error: got %v - want %v", err, nil)
+	}
+}
+
+func TestAuditEventWriter(t *testing.T) {
+	const Events = `{"time":"2020-03-24T12:37:33.123456789Z","request":{"path":"/v1/key/create/my-key","method":"POST","identity":"dd46485b","ip":"10.1.2.3"},"response":{"code":200,"time":12106}}
+{"time":"2020-03-24T12:38:02Z","request":{"path":"/v1/policy/list/*","identity":"dd46485b"},"response":{"code":403,"time":15572}}`
+
+	var buffer strings.Builder
+	writer := NewAuditEventWriter(&buffer)
+	stream := NewAuditStream(strings.NewReader(Events))
+	for stream.Next() {
+		if err := writer.Write(stream.Event()); err != nil {
+			t.Fatalf("Failed to write event: %v", err)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("Failed to iterate over stream: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	if output := buffer.String(); output != Events+"\n" {
+		t.Fatalf("Invalid output: got %s - want %s", output, Events+"\n")
+	}
+}
+
+// closeRecorder is an io.ReadCloser that
+// records whether it has been closed.
+type closeRecorder struct {
+	io.Reader
+	Closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.Closed = true
+	return nil
+}
+
+func TestNewGzipAuditStream(t *testing.T) {
+	const Events = `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key","identity":"dd46485b"},"response":{"code":200,"time":12106}}
+{"time":"2020-03-24T12:38:02Z","request":{"path":"/v1/policy/list/*","identity":"dd46485b"},"response":{"code":403,"time":15572}}`
+
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	if _, err := io.WriteString(gz, Events); err != nil {
+		t.Fatalf("Failed to compress events: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("Failed to compress events: %v", err)
+	}
+
+	reader := &closeRecorder{Reader: &buffer}
+	stream, err := NewGzipAuditStream(reader)
+	if err != nil {
+		t.Fatalf("Failed to create stream: %v", err)
+	}
+	var n int
+	for stream.Next() {
+		n++
+	}
+	if err = stream.Err(); err != nil {
+		t.Fatalf("Failed to iterate over stream: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("Invalid number of events: got %d - want %d", n, 2)
+	}
+	if err = stream.Close(); err != nil {
+		t.Fatalf("Failed to close stream: %v", err)
+	}
+	if !reader.Closed {
+		t.Fatal("Closing the stream did not close the underlying reader")
+	}
+
+	if _, err = NewGzipAuditStream(strings.NewReader(Events)); err == nil {
+		t.Fatal("Created stream from non-gzip data")
+	}
+}
+
+var auditStreamSkipTests = []struct {
+	Skip    int
+	Skipped int
+	Next    string // path of the next event, empty if none
+}{
+	{Skip: 0, Skipped: 0, Next: "/v1/key/create/a"}, // 0
+	{Skip: 2, Skipped: 2, Next: "/v1/key/create/c"}, // 1
+	{Skip: 3, Skipped: 3, Next: ""},                 // 2
+	{Skip: 5, Skipped: 3, Next: ""},                 // 3
+}
+
+func TestAuditStreamSkip(t *testing.T) {
+	const Events = `{"request":{"path":"/v1/key/create/a"}}
+
+{"request":{"path":"/v1/key/create/b"}}
+{"request":{"path":"/v1/key/create/c"}}`
+
+	for i, test := range auditStreamSkipTests {
+		stream := NewAuditStream(strings.NewReader(Events))
+		n, err := stream.Skip(test.Skip)
+		if err != nil {
+			t.Fatalf("Test %d: failed to skip events: %v", i, err)
+		}
+		if n != test.Skipped {
+			t.Fatalf("Test %d: got %d skipped events - want %d", i, n, test.Skipped)
+		}
+		if test.Next == "" {
+			if stream.Next() {
+				t.Fatalf("Test %d: stream contains unexpected event: %v", i, stream.Event())
+			}
+			continue
+		}
+		if !stream.Next() {
+			t.Fatalf("Test %d: failed to read next event: %v", i, stream.Err())
+		}
+		if path := stream.Event().Request.Path; path != test.Next {
+			t.Fatalf("Test %d: got path '%s' - want '%s'", i, path, test.Next)
+		}
+	}
+
+	// Skipped events must not be parsed.
+	stream := NewAuditStream(strings.NewReader("not JSON\n" + Events))
+	if _, err := stream.Skip(1); err != nil {
+		t.Fatalf("Failed to skip invalid event: %v", err)
+	}
+	if !stream.Next() {
+		t.Fatalf("Failed to read next event: %v", stream.Err())
+	}
+}
+
+var auditEventResponseTests = []struct {
+	Response string
+	Size     int64
+}{
+	{Response: `{"code":200,"time":12106}`, Size: 0},                // 0
+	{Response: `{"code":200,"time":12106,"size":4096}`, Size: 4096}, // 1
+}
+
+func TestAuditEventResponseSize(t *testing.T) {
+	for i, test := range auditEventResponseTests {
+		var response AuditEventResponse
+		if err := json.Unmarshal([]byte(test.Response), &response); err != nil {
+			t.Fatalf("Test %d: failed to unmarshal response: %v", i, err)
+		}
+		if response.Size != test.Size {
+			t.Fatalf("Test %d: got size %d - want %d", i, response.Size, test.Size)
+		}
+		if s := response.String(); s != test.Response {
+			t.Fatalf("Test %d: got %s - want %s", i, s, test.Response)
+		}
+	}
+}
+
+var auditEventRequestAPITests = []struct {
+	Path string
+	API  API
+	Name string
+	OK   bool
+}{
+	{Path: "/v1/key/create/my-key", API: KeyCreate, Name: "my-key", OK: true},                             // 0
+	{Path: "/v1/key/decrypt/my-key", API: KeyDecrypt, Name: "my-key", OK: true},                           // 1
+	{Path: "/v1/policy/write/my-policy", API: PolicyWrite, Name: "my-policy", OK: true},                   // 2
+	{Path: "/v1/identity/assign/af43c/my-policy", API: IdentityAssign, Name: "af43c/my-policy", OK: true}, // 3
+	{Path: "/v1/key/list/*", API: KeyList, Name: "*", OK: true},                                           // 4
+	{Path: "/v1/log/audit/trace", API: AuditLogTrace, Name: "", OK: true},                                 // 5
+	{Path: "/version", API: ServerVersion, Name: "", OK: true},                                            // 6
+	{Path: "/v1/key/create", API: "", Name: "", OK: false},                                                // 7
+	{Path: "/v1/key/unknown/my-key", API: "", Name: "", OK: false},                                        // 8
+	{Path: "", API: "", Name: "", OK: false},                                                              // 9
+	{Path: "/v1/identity/self/describe", API: IdentitySelf, Name: "", OK: true},                           // 10
+	{Path: "/v1/status", API: ServerStatus, Name: "", OK: true},                                           // 11
+	{Path: "/v1/key/rewrap/my-key", API: KeyReWrap, Name: "my-key", OK: true},                             // 12
+}
+
+func TestAuditEventRequestAPI(t *testing.T) {
+	for i, test := range auditEventRequestAPITests {
+		api, name, ok := AuditEventRequest{Path: test.Path}.API()
+		if ok != test.OK {
+			t.Fatalf("Test %d: got %v - want %v", i, ok, test.OK)
+		}
+		if api != test.API {
+			t.Fatalf("Test %d: got API '%v' - want '%v'", i, api, test.API)
+		}
+		if name != test.Name {
+			t.Fatalf("Test %d: got name '%s' - want '%s'", i, name, test.Name)
+		}
+	}
+}
+
+func TestErrorStreamDedup(t *testing.T) {
+	const Events = `{"message":"a"}
+{"message":"a"}
+{"message":"a"}
+{"message":"b"}
+{"message":"c"}
+{"message":"c"}`
+
+	type Event struct {
+		Message string
+		Repeat  int
+	}
+	var (
+		hourWindow = []Event{{"a", 0}, {"a", 2}, {"b", 0}, {"c", 0}, {"c", 1}}
+		zeroWindow = []Event{{"a", 0}, {"a", 0}, {"a", 0}, {"b", 0}, {"c", 0}, {"c", 0}}
+	)
+	for window, events := range map[time.Duration][]Event{time.Hour: hourWindow, 0: zeroWindow} {
+		stream := NewErrorStream(strings.NewReader(Events)).Dedup(window)
+		var i int
+		for ; stream.Next(); i++ {
+			if i >= len(events) {
+				t.Fatalf("Window %v: got more than %d events", window, len(events))
+			}
+			if msg := stream.Event().Message; msg != events[i].Message {
+				t.Fatalf("Window %v: event %d: got message '%s' - want '%s'", window, i, msg, events[i].Message)
+			}
+			if n := stream.RepeatCount(); n != events[i].Repeat {
+				t.Fatalf("Window %v: event %d: got repeat count %d - want %d", window, i, n, events[i].Repeat)
+			}
+		}
+		if err := stream.Err(); err != nil {
+			t.Fatalf("Window %v: failed to iterate over stream: %v", window, err)
+		}
+		if i != len(events) {
+			t.Fatalf("Window %v: got %d events - want %d", window, i, len(events))
+		}
+	}
+}
+
+func TestAuditStreamPeek(t *testing.T) {
+	const Events = `{"request":{"path":"/v1/key/create/a"}}
+{"request":{"path":"/v1/key/create/b"}}
+not JSON`
+
+	stream := NewAuditStream(strings.NewReader(Events))
+	if event, ok := stream.Peek(); !ok || event.Request.Path != "/v1/key/create/a" {
+		t.Fatalf("Failed to peek first event: got '%s' - want '%s'", event.Request.Path, "/v1/key/create/a")
+	}
+	if event, ok := stream.Peek(); !ok || event.Request.Path != "/v1/key/create/a" {
+		t.Fatalf("Peeking twice advanced the stream: got '%s' - want '%s'", event.Request.Path, "/v1/key/create/a")
+	}
+	if !stream.Next() || stream.Event().Request.Path != "/v1/key/create/a" {
+		t.Fatalf("Next did not return the peeked event: got '%s' - want '%s'", stream.Event().Request.Path, "/v1/key/create/a")
+	}
+
+	if event, ok := stream.Peek(); !ok || event.Request.Path != "/v1/key/create/b" {
+		t.Fatalf("Failed to peek second event: got '%s' - want '%s'", event.Request.Path, "/v1/key/create/b")
+	}
+	if path := stream.Event().Request.Path; path != "/v1/key/create/a" {
+		t.Fatalf("Peek changed the current event: got '%s' - want '%s'", path, "/v1/key/create/a")
+	}
+	if !stream.Next() || stream.Event().Request.Path != "/v1/key/create/b" {
+		t.Fatalf("Next did not return the peeked event: got '%s' - want '%s'", stream.Event().Request.Path, "/v1/key/create/b")
+	}
+	if stream.Count() != 2 {
+		t.Fatalf("Invalid count: got %d - want %d", stream.Count(), 2)
+	}
+
+	if _, ok := stream.Peek(); ok {
+		t.Fatal("Peeked an invalid event")
+	}
+	if stream.Err() == nil {
+		t.Fatal("Peeking an invalid event did not set an error")
+	}
+	if stream.Next() {
+		t.Fatal("Next returned true after Peek failed")
+	}
+}
+
+func TestWithSplitFunc(t *testing.T) {
+	const Events = "{\"message\":\"a\"}\x00{\"message\":\"b\"}\x00\x00{\"message\":\"c\"}"
+
+	splitNUL := func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, 0); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+
+	var messages []string
+	stream := NewErrorStream(strings.NewReader(Events), WithSplitFunc(splitNUL))
+	for stream.Next() {
+		messages = append(messages, stream.Event().Message)
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("Failed to iterate over stream: %v", err)
+	}
+	if s := strings.Join(messages, ","); s != "a,b,c" {
+		t.Fatalf("Invalid messages: got %s - want %s", s, "a,b,c")
+	}
+}
+
+func TestWithDecoder(t *testing.T) {
+	const Events = `{"message":"a"}
+{"message":"b"}
+
+{"message":"c"}`
+
+	var calls int
+	decode := func(data []byte, v interface{}) error {
+		calls++
+		event, ok := v.(*ErrorEvent)
+		if !ok {
+			return fmt.Errorf("invalid event type %T", v)
+		}
+		if event.Message != "" {
+			return errors.New("event has not been reset by the stream")
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			return err
+		}
+		event.Message = strings.ToUpper(event.Message)
+		return nil
+	}
+
+	var messages []string
+	stream := NewErrorStream(strings.NewReader(Events), WithDecoder(decode))
+	for stream.Next() {
+		messages = append(messages, stream.Event().Message)
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("Failed to iterate over stream: %v", err)
+	}
+	if s := strings.Join(messages, ","); s != "A,B,C" {
+		t.Fatalf("Invalid messages: got %s - want %s", s, "A,B,C")
+	}
+	if calls != 3 {
+		t.Fatalf("Decoder has been called %d times - want %d", calls, 3)
+	}
+
+	errDecode := errors.New("decode error")
+	stream = NewErrorStream(strings.NewReader(Events), WithDecoder(func([]byte, interface{}) error { return errDecode }))
+	if stream.Next() {
+		t.Fatal("Next should have failed")
+	}
+	if err := stream.Err(); err != errDecode {
+		t.Fatalf("Invalid error: got %v - want %v", err, errDecode)
+	}
+
+	// Passing json.Unmarshal behaves like the default
+	// decoder. In particular, fields of a previous event
+	// must not leak into the next one.
+	const AuditEvents = `{"request":{"path":"/v1/key/create/my-key","method":"POST"}}
+{"request":{"path":"/v1/key/list/*"}}`
+	audit := NewAuditStream(strings.NewReader(AuditEvents), WithDecoder(json.Unmarshal))
+	if !audit.Next() || !audit.Next() {
+		t.Fatalf("Failed to read event: %v", audit.Err())
+	}
+	if method := audit.Event().Request.Method; method != "" {
+		t.Fatalf("Event contains method of previous event: got %q - want %q", method, "")
+	}
+}
+
+var auditEventMarshalTests = []struct {
+	Event string
+	Text  string
+}{
+	{ // 0
+		Event: `{"time":"2021-01-01T10:00:00Z","request":{"path":"/v1/key/create/my-key","identity":"2ecb8804e7702a6b768e87cfa843b8f9"},"response":{"code":200,"time":3000000}}`,
+		Text:  "2021-01-01T10:00:00Z 2ecb8804e7702a6b 200 /v1/key/create/my-key 3ms",
+	},
+	{ // 1
+		Event: `{"time":"2021-01-01T11:00:00+01:00","request":{"path":"/v1/key/decrypt/my-key","method":"POST","identity":"abc"},"response":{"code":403,"time":1500}}`,
+		Text:  "2021-01-01T10:00:00Z abc 403 /v1/key/decrypt/my-key 1.5µs",
+	},
+	{ // 2
+		Event: `{"time":"2021-01-01T10:00:00Z","request":{"path":"/version","identity":""},"response":{"code":200,"time":0,"size":17}}`,
+		Text:  "2021-01-01T10:00:00Z - 200 /version 0s",
+	},
+}
+
+func TestAuditEventMarshal(t *testing.T) {
+	for i, test := range auditEventMarshalTests {
+		var event AuditEvent
+		if err := json.Unmarshal([]byte(test.Event), &event); err != nil {
+			t.Fatalf("Test %d: failed to unmarshal event: %v", i, err)
+		}
+
+		text, err := event.MarshalText()
+		if err != nil {
+			t.Fatalf("Test %d: failed to marshal event as text: %v", i, err)
+		}
+		if string(text) != test.Text {
+			t.Fatalf("Test %d: got %q - want %q", i, text, test.Text)
+		}
+
+		// The JSON encoding must not be affected by MarshalText.
+		type AuditEventJSON AuditEvent
+		want, _ := json.Marshal(AuditEventJSON(event))
+		got, err := json.Marshal(event)
+		if err != nil {
+			t.Fatalf("Test %d: failed to marshal event as JSON: %v", i, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("Test %d: got %s - want %s", i, got, want)
+		}
+
+		indented, err := event.MarshalIndentLine()
+		if err != nil {
+			t.Fatalf("Test %d: failed to marshal event: %v", i, err)
+		}
+		var buffer bytes.Buffer
+		if err = json.Indent(&buffer, got, "", "  "); err != nil {
+			t.Fatalf("Test %d: failed to indent event: %v", i, err)
+		}
+		buffer.WriteByte('\n')
+		if !bytes.Equal(indented, buffer.Bytes()) {
+			t.Fatalf("Test %d: got %s - want %s", i, indented, buffer.Bytes())
+		}
+	}
+}
+
+var auditStreamOnlyStatusTests = []struct {
+	Min, Max int
+	Paths    []string
+}{
+	{Min: 400, Max: 599, Paths: []string{"/v1/key/create/my-key", "/v1/key/decrypt/my-key"}}, // 0
+	{Min: 200, Max: 299, Paths: []string{"/v1/policy/list/*", "/v1/key/delete/my-key"}},      // 1
+	{Min: 500, Max: 599, Paths: []string{"/v1/key/decrypt/my-key"}},                          // 2
+	{Min: 404, Max: 404, Paths: nil},                                                         // 3
+}
+
+func TestAuditStreamOnlyStatus(t *testing.T) {
+	const Events = `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key"},"response":{"code":400}}
+{"time":"2020-03-24T12:38:02Z","request":{"path":"/v1/policy/list/*"},"response":{"code":200}}
+{"time":"2020-03-24T12:38:32Z","request":{"path":"/v1/key/decrypt/my-key"},"response":{"code":503}}
+{"time":"2020-03-24T12:39:02Z","request":{"path":"/v1/key/delete/my-key"},"response":{"code":200}}`
+
+	for i, test := range auditStreamOnlyStatusTests {
+		stream := NewAuditStream(strings.NewReader(Events)).OnlyStatus(test.Min, test.Max)
+
+		var paths []string
+		for stream.Next() {
+			paths = append(paths, stream.Event().Request.Path)
+		}
+		if err := stream.Err(); err != nil {
+			t.Fatalf("Test %d: failed to iterate over stream: %v", i, err)
+		}
+		if len(paths) != len(test.Paths) {
+			t.Fatalf("Test %d: got %d events - want %d", i, len(paths), len(test.Paths))
+		}
+		for j := range paths {
+			if paths[j] != test.Paths[j] {
+				t.Fatalf("Test %d: event %d: got path %q - want %q", i, j, paths[j], test.Paths[j])
+			}
+		}
+	}
+}
+
+var auditStreamSlowerThanTests = []struct {
+	Duration time.Duration
+	Paths    []string
+}{
+	{Duration: 0, Paths: []string{"/v1/key/create/my-key", "/v1/key/decrypt/my-key", "/v1/key/delete/my-key"}}, // 0
+	{Duration: time.Millisecond, Paths: []string{"/v1/key/decrypt/my-key", "/v1/key/delete/my-key"}},           // 1
+	{Duration: 5 * time.Millisecond, Paths: []string{"/v1/key/decrypt/my-key"}},                                // 2
+	{Duration: time.Second, Paths: nil}, // 3
+}
+
+func TestAuditStreamSlowerThan(t *testing.T) {
+	const Events = `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key"},"response":{"code":200,"time":1000000}}
+{"time":"2020-03-24T12:38:02Z","request":{"path":"/v1/policy/list/*"},"response":{"code":200,"time":0}}
+{"time":"2020-03-24T12:38:32Z","request":{"path":"/v1/key/decrypt/my-key"},"response":{"code":200,"time":250000000}}
+{"time":"2020-03-24T12:39:02Z","request":{"path":"/v1/key/delete/my-key"},"response":{"code":200,"time":5000000}}`
+
+	for i, test := range auditStreamSlowerThanTests {
+		stream := NewAuditStream(strings.NewReader(Events)).SlowerThan(test.Duration)
+
+		var paths []string
+		for stream.Next() {
+			paths = append(paths, stream.Event().Request.Path)
+		}
+		if err := stream.Err(); err != nil {
+			t.Fatalf("Test %d: failed to iterate over stream: %v", i, err)
+		}
+		if len(paths) != len(test.Paths) {
+			t.Fatalf("Test %d: got %d events - want %d", i, len(paths), len(test.Paths))
+		}
+		for j := range paths {
+			if paths[j] != test.Paths[j] {
+				t.Fatalf("Test %d: event %d: got path %q - want %q", i, j, paths[j], test.Paths[j])
+			}
+		}
+	}
+}
+
+func TestWithTee(t *testing.T) {
+	const Events = `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key"},"response":{"code":200}}
+
+{"time":"2020-03-24T12:38:02Z","request":{"path":"/v1/policy/list/*"},"response":{"code":}}
+{"time":"2020-03-24T12:39:02Z","request":{"path":"/v1/key/delete/my-key"},"response":{"code":200}}`
+	const Tee = `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key"},"response":{"code":200}}
+{"time":"2020-03-24T12:39:02Z","request":{"path":"/v1/key/delete/my-key"},"response":{"code":200}}
+`
+
+	var buffer bytes.Buffer
+	stream := NewAuditStream(strings.NewReader(Events), WithTee(&buffer), WithSkipInvalid())
+	for stream.Next() {
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("Failed to iterate over stream: %v", err)
+	}
+	if err := stream.TeeErr(); err != nil {
+		t.Fatalf("Failed to write to tee: %v", err)
+	}
+	if buffer.String() != Tee {
+		t.Fatalf("Invalid tee content: got %q - want %q", buffer.String(), Tee)
+	}
+
+	// A failing tee must not stop the iteration unless
+	// the stream has been created with WithStrictTee.
+	errTee := errors.New("tee failed")
+	stream = NewAuditStream(strings.NewReader(Events), WithTee(errorWriter{errTee}), WithSkipInvalid())
+	for stream.Next() {
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("Failed to iterate over stream: %v", err)
+	}
+	if n := stream.Count(); n != 2 {
+		t.Fatalf("Invalid event count: got %d - want %d", n, 2)
+	}
+	if err := stream.TeeErr(); err != errTee {
+		t.Fatalf("Invalid tee error: got %v - want %v", err, errTee)
+	}
+
+	stream = NewAuditStream(strings.NewReader(Events), WithTee(errorWriter{errTee}), WithStrictTee(), WithSkipInvalid())
+	for stream.Next() {
+	}
+	if err := stream.Err(); err != errTee {
+		t.Fatalf("Invalid error: got %v - want %v", err, errTee)
+	}
+	if n := stream.Count(); n != 0 {
+		t.Fatalf("Invalid event count: got %d - want %d", n, 0)
+	}
+}
+
+// errorWriter is an io.Writer that always fails.
+type errorWriter struct{ err error }
+
+func (w errorWriter) Write([]byte) (int, error) { return 0, w.err }
+
+func TestCloseWithContext(t *testing.T) {
+	const Events = `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key"},"response":{"code":200}}
+{"time":"2020-03-24T12:39:02Z","request":{"path":"/v1/key/delete/my-key"},"response":{"code":200}}
+`
+	content := strings.NewReader(Events + strings.Repeat(" ", 1<<20))
+	reader := &closeRecorder{Reader: content}
+	stream := NewAuditStream(reader)
+	if !stream.Next() {
+		t.Fatalf("Failed to read event: %v", stream.Err())
+	}
+	if err := stream.CloseWithContext(context.Background()); err != nil {
+		t.Fatalf("Failed to close stream: %v", err)
+	}
+	if !reader.Closed {
+		t.Fatal("Stream has not been closed")
+	}
+	if n := content.Len(); n != 0 {
+		t.Fatalf("Stream has not been drained: %d bytes remaining", n)
+	}
+	if stream.Next() {
+		t.Fatal("Next returned true after stream has been closed")
+	}
+	if err := stream.Err(); err != ErrStreamClosed {
+		t.Fatalf("Invalid error: got %v - want %v", err, ErrStreamClosed)
+	}
+
+	// A stream that does not end must be closed
+	// once the ctx deadline has been exceeded.
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go func() {
+		for {
+			if _, err := pw.Write([]byte(Events)); err != nil {
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := NewAuditStream(pr).CloseWithContext(ctx); err != nil {
+		t.Fatalf("Failed to close stream: %v", err)
+	}
+	if _, err := pr.Read(make([]byte, 1)); err != io.ErrClosedPipe {
+		t.Fatalf("Stream has not been closed: got %v - want %v", err, io.ErrClosedPipe)
+	}
+}
+
+func TestStreamIOErrDecodeErr(t *testing.T) {
+	const Events = `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key"},"response":{"code":200}}
+{"time":"2020-03-24T12:38:02Z","request":{"path":"/v1/policy/list/*"},"response":{"code":}}`
+
+	stream := NewAuditStream(strings.NewReader(Events))
+	for stream.Next() {
+	}
+	if stream.Err() == nil || stream.DecodeErr() != stream.Err() {
+		t.Fatalf("Invalid decode error: got %v - want %v", stream.DecodeErr(), stream.Err())
+	}
+	if err := stream.IOErr(); err != nil {
+		t.Fatalf("Invalid I/O error: got %v - want <nil>", err)
+	}
+	if err := stream.LastDecodeError(); err != nil {
+		t.Fatalf("Invalid last decode error: got %v - want <nil>", err)
+	}
+
+	errRead := errors.New("connection reset")
+	stream = NewAuditStream(io.MultiReader(strings.NewReader(Events), errorReader{errRead}), WithSkipInvalid())
+	for stream.Next() {
+	}
+	if err := stream.Err(); err != errRead {
+		t.Fatalf("Invalid error: got %v - want %v", err, errRead)
+	}
+	if err := stream.IOErr(); err != errRead {
+		t.Fatalf("Invalid I/O error: got %v - want %v", err, errRead)
+	}
+	if stream.DecodeErr() == nil || stream.DecodeErr() != stream.LastDecodeError() {
+		t.Fatalf("Invalid decode error: got %v - want %v", stream.DecodeErr(), stream.LastDecodeError())
+	}
+}
+
+// errorReader is an io.Reader that always fails.
+type errorReader struct{ err error }
+
+func (r errorReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestStreamRange(t *testing.T) {
+	const Events = `{"message":"a"}
+{"message":"b"}
+{"message":"c"}`
+
+	var messages []string
+	err := NewErrorStream(strings.NewReader(Events)).Range(func(event ErrorEvent) bool {
+		messages = append(messages, event.Message)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("Failed to iterate over stream: %v", err)
+	}
+	if len(messages) != 3 || messages[0] != "a" || messages[2] != "c" {
+		t.Fatalf("Invalid events: got %v", messages)
+	}
+
+	messages = messages[:0]
+	err = NewErrorStream(strings.NewReader(Events)).Range(func(event ErrorEvent) bool {
+		messages = append(messages, event.Message)
+		return event.Message != "b"
+	})
+	if err != nil {
+		t.Fatalf("Stopping the iteration must not cause an error: %v", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("Invalid events: got %v", messages)
+	}
+
+	var paths []string
+	err = NewAuditStream(strings.NewReader(`{"request":{"path":"/version"},"response":{"code":200}}` + "\n{")).Range(func(event AuditEvent) bool {
+		paths = append(paths, event.Request.Path)
+		return true
+	})
+	if err == nil {
+		t.Fatal("Range should have failed")
+	}
+	if len(paths) != 1 || paths[0] != "/version" {
+		t.Fatalf("Invalid events: got %v", paths)
+	}
+}
+
+var auditStreamLimitTests = []struct {
+	Limit    int
+	Failed   bool
+	Expected int
+}{
+	{Limit: 0, Expected: 0},               // 0
+	{Limit: 2, Expected: 2},               // 1
+	{Limit: 10, Expected: 4},              // 2
+	{Limit: 1, Failed: true, Expected: 1}, // 3
+	{Limit: 5, Failed: true, Expected: 2}, // 4
+}
+
+func TestAuditStreamLimit(t *testing.T) {
+	const Events = `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key"},"response":{"code":400}}
+{"time":"2020-03-24T12:38:02Z","request":{"path":"/v1/policy/list/*"},"response":{"code":200}}
+{"time":"2020-03-24T12:38:32Z","request":{"path":"/v1/key/decrypt/my-key"},"response":{"code":503}}
+{"time":"2020-03-24T12:39:02Z","request":{"path":"/v1/key/delete/my-key"},"response":{"code":200}}`
+
+	for i, test := range auditStreamLimitTests {
+		stream := NewAuditStream(strings.NewReader(Events))
+		if test.Failed {
+			stream = stream.OnlyStatus(400, 599)
+		}
+		stream = stream.Limit(test.Limit)
+
+		var n int
+		for stream.Next() {
+			n++
+		}
+		if err := stream.Err(); err != nil {
+			t.Fatalf("Test %d: failed to iterate over stream: %v", i, err)
+		}
+		if n != test.Expected {
+			t.Fatalf("Test %d: got %d events - want %d", i, n, test.Expected)
+		}
+	}
+}
+
+var auditStreamStatsTests = []struct {
+	Events string
+	Stats  StreamStats
+	Close  bool
+}{
+	{ // 0
+		Events: "",
+		Stats:  StreamStats{},
+	},
+	{ // 1
+		Events: `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key"},"response":{"code":200}}` + "\n\n" +
+			`{"time":"2020-03-24T12:38:02Z","request":{"path":"/v1/policy/list/*"},"response":{"code":403}}` + "\n\n",
+		Stats: StreamStats{Events: 2, EmptyLines: 2},
+	},
+	{ // 2
+		Events: `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key"},"response":{"code":200}}` + "\n\n" + `{"time":`,
+		Stats:  StreamStats{Events: 1, EmptyLines: 1, Errored: true},
+	},
+	{ // 3
+		Events: `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key"},"response":{"code":200}}`,
+		Stats:  StreamStats{Events: 1, Closed: true},
+		Close:  true,
+	},
+}
+
+func TestAuditStreamStats(t *testing.T) {
+	for i, test := range auditStreamStatsTests {
+		stream := NewAuditStream(&closeRecorder{Reader: strings.NewReader(test.Events)})
+		for stream.Next() {
+		}
+		if err := stream.Err(); err != nil && !test.Stats.Errored {
+			t.Fatalf("Test %d: failed to iterate over stream: %v", i, err)
+		}
+		if test.Close {
+			stream.Close()
+		}
+		want := test.Stats
+		want.Bytes = uint64(len(test.Events)) // The stream reads all bytes
+		if stats := stream.Stats(); stats != want {
+			t.Fatalf("Test %d: got %+v - want %+v", i, stats, want)
+		}
+	}
+}
+
+func TestAuditStreamStatsConcurrent(t *testing.T) {
+	const Event = `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key"},"response":{"code":200}}` + "\n"
+	const N = 1000
+
+	stream := NewAuditStream(strings.NewReader(strings.Repeat(Event, N)))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for stream.Next() {
+		}
+	}()
+	for {
+		select {
+		case <-done:
+		default:
+			stream.Stats()
+			continue
+		}
+		break
+	}
+	if stats := stream.Stats(); stats.Events != N || stats.Bytes != uint64(len(Event)*N) {
+		t.Fatalf("Invalid stats: %+v", stats)
+	}
+	if allocs := testing.AllocsPerRun(10, func() { stream.Stats() }); allocs != 0 {
+		t.Fatalf("Stats allocates: got %v allocations - want 0", allocs)
+	}
+}
+
+func TestAuditStreamOffset(t *testing.T) {
+	const Events = `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/a"},"response":{"code":200}}` + "\n\n" +
+		`{"time":"2020-03-24T12:38:02Z","request":{"path":"/v1/key/create/b"},"response":{"code":200}}` + "\r\n" +
+		`{"time":"2020-03-24T12:38:32Z","request":{"path":"/v1/key/create/c"},"response":{"code":200}}` + "\n" +
+		`{"time":"2020-03-24T12:39:02Z","request":{"path":"/v1/key/create/d"},"response":{"code":200}}`
+
+	paths := func(stream *AuditStream) string {
+		var paths []string
+		for stream.Next() {
+			paths = append(paths, stream.Event().Request.Path)
+		}
+		if err := stream.Err(); err != nil {
+			t.Fatalf("Failed to iterate over stream: %v", err)
+		}
+		return strings.Join(paths, ",")
+	}
+
+	for n := 0; n <= 4; n++ {
+		stream := NewAuditStream(strings.NewReader(Events))
+		for i := 0; i < n; i++ {
+			if !stream.Next() {
+				t.Fatalf("Test %d: failed to read event %d: %v", n, i, stream.Err())
+			}
+		}
+		if n > 0 {
+			if _, ok := stream.Peek(); ok == (n == 4) {
+				t.Fatalf("Test %d: invalid peek result", n)
+			}
+		}
+
+		resumed, err := NewAuditStreamAt(strings.NewReader(Events), stream.Offset())
+		if err != nil {
+			t.Fatalf("Test %d: failed to resume stream: %v", n, err)
+		}
+		if resumed.Offset() != stream.Offset() {
+			t.Fatalf("Test %d: invalid offset: got %d - want %d", n, resumed.Offset(), stream.Offset())
+		}
+		if remaining, want := paths(resumed), paths(stream); remaining != want {
+			t.Fatalf("Test %d: got events %q - want %q", n, remaining, want)
+		}
+		if stream.Offset() != int64(len(Events)) || resumed.Offset() != int64(len(Events)) {
+			t.Fatalf("Test %d: invalid final offsets: got %d and %d - want %d", n, stream.Offset(), resumed.Offset(), len(Events))
+		}
+	}
+
+	stream := NewAuditStream(strings.NewReader(Events))
+	if _, err := stream.Skip(2); err != nil {
+		t.Fatalf("Failed to skip events: %v", err)
+	}
+	resumed, err := NewAuditStreamAt(strings.NewReader(Events), stream.Offset())
+	if err != nil {
+		t.Fatalf("Failed to resume stream: %v", err)
+	}
+	if remaining := paths(resumed); remaining != "/v1/key/create/c,/v1/key/create/d" {
+		t.Fatalf("Got events %q - want %q", remaining, "/v1/key/create/c,/v1/key/create/d")
+	}
+
+	if _, err = NewAuditStreamAt(strings.NewReader(Events), -1); err == nil {
+		t.Fatal("Seeking to a negative offset should have failed")
+	}
+}
+
+func TestWithRedactor(t *testing.T) {
+	const Events = `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/secret-key","identity":"dd46485b"},"response":{"code":200}}
+{"time":"2020-03-24T12:38:02Z","request":{"path":"/v1/policy/list/*","identity":"dd46485b"},"response":{"code":403}}`
+
+	redact := func(event *AuditEvent) {
+		if api, name, ok := event.Request.API(); ok && name != "" && api != PolicyList {
+			event.Request.Path = api.String() + "/<redacted>"
+		}
+		event.Request.Identity = ""
+	}
+
+	var paths []string
+	stream := NewAuditStream(strings.NewReader(Events), WithRedactor(redact))
+	for stream.Next() {
+		if stream.Event().Request.Identity != "" {
+			t.Fatalf("Identity has not been redacted: %s", stream.Event().Request.Identity)
+		}
+		if !strings.Contains(string(stream.Bytes()), "dd46485b") {
+			t.Fatal("The raw event content has been modified")
+		}
+		paths = append(paths, stream.Event().Request.Path)
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("Failed to iterate over stream: %v", err)
+	}
+	if s := strings.Join(paths, ","); s != "/v1/key/create/<redacted>,/v1/policy/list/*" {
+		t.Fatalf("Invalid paths: got %s - want %s", s, "/v1/key/create/<redacted>,/v1/policy/list/*")
+	}
+
+	// Filters of derived streams see the redacted events.
+	stream = NewAuditStream(strings.NewReader(Events), WithRedactor(redact)).FilterFunc(func(event AuditEvent) bool {
+		return strings.HasSuffix(event.Request.Path, "<redacted>")
+	})
+	var n int
+	for stream.Next() {
+		n++
+	}
+	if n != 1 {
+		t.Fatalf("Filter saw unredacted events: got %d events - want %d", n, 1)
+	}
+}
+
+func TestAuditStreamNextInto(t *testing.T) {
+	for i, test := range auditStreamStatsTests {
+		var events []AuditEvent
+		stream := NewAuditStream(strings.NewReader(test.Events))
+		for stream.Next() {
+			events = append(events, stream.Event())
+		}
+		nextErr := stream.Err()
+
+		var event AuditEvent
+		stream = NewAuditStream(strings.NewReader(test.Events))
+		for n := 0; stream.NextInto(&event); n++ {
+			if n >= len(events) {
+				t.Fatalf("Test %d: NextInto returned more events than Next", i)
+			}
+			if event.String() != events[n].String() {
+				t.Fatalf("Test %d: event %d: got %s - want %s", i, n, event.String(), events[n].String())
+			}
+			if e := stream.Event(); e.String() != event.String() {
+				t.Fatalf("Test %d: event %d: Event does not match: got %s - want %s", i, n, e.String(), event.String())
+			}
+		}
+		if err := stream.Err(); (err == nil) != (nextErr == nil) {
+			t.Fatalf("Test %d: invalid error: got %v - want %v", i, err, nextErr)
+		}
+		if stats := stream.Stats(); stats.Events != uint64(len(events)) || stats.EmptyLines != test.Stats.EmptyLines {
+			t.Fatalf("Test %d: invalid stats: got %+v - want %d events and %d empty lines", i, stats, len(events), test.Stats.EmptyLines)
+		}
+	}
+}
+
+// benchmarkAuditEvent is the audit event used by
+// the AuditStream benchmark and allocation tests.
+const benchmarkAuditEvent = `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key","identity":"dd46485b"},"response":{"code":200,"time":12106}}`
+
+// decodeBenchmarkEvent is a decoder that only accepts
+// the benchmarkAuditEvent. It reuses the memory of the
+// event it decodes into such that decoding does not
+// allocate once the event has been decoded once.
+func decodeBenchmarkEvent(data []byte, v interface{}) error {
+	event, ok := v.(*AuditEvent)
+	if !ok || string(data) != benchmarkAuditEvent {
+		return errors.New("unexpected event")
+	}
+	if event.Request.Path == "/v1/key/create/my-key" && event.Request.Identity == "dd46485b" {
+		return nil // The event has been decoded before. Reuse it.
+	}
+	*event = AuditEvent{
+		Time: time.Date(2020, 3, 24, 12, 37, 33, 0, time.UTC),
+		Request: AuditEventRequest{
+			Path:     "/v1/key/create/my-key",
+			Identity: "dd46485b",
+		},
+		Response: AuditEventResponse{
+			StatusCode: 200,
+			Time:       12106,
+		},
+	}
+	return nil
+}
+
+func TestAuditStreamNextIntoAllocs(t *testing.T) {
+	events := strings.Repeat(benchmarkAuditEvent+"\n", 1000)
+
+	// The stream must neither allocate nor reset the event
+	// itself such that a decoder can reuse the event's memory.
+	var event AuditEvent
+	stream := NewAuditStream(strings.NewReader(events), WithDecoder(decodeBenchmarkEvent))
+	allocs := testing.AllocsPerRun(100, func() {
+		if !stream.NextInto(&event) {
+			t.Fatalf("Failed to read event: %v", stream.Err())
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("NextInto allocates: got %v allocs per event - want 0", allocs)
+	}
+}
+
+func BenchmarkAuditStream(b *testing.B) {
+	events := strings.Repeat(benchmarkAuditEvent+"\n", 1000)
+
+	b.Run("Next", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(events)))
+		for i := 0; i < b.N; i++ {
+			stream := NewAuditStream(strings.NewReader(events))
+			for stream.Next() {
+				_ = stream.Event()
+			}
+			if err := stream.Err(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("NextInto", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(events)))
+
+		var event AuditEvent
+		for i := 0; i < b.N; i++ {
+			stream := NewAuditStream(strings.NewReader(events), WithDecoder(decodeBenchmarkEvent))
+			for stream.NextInto(&event) {
+			}
+			if err := stream.Err(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+var streamStateTests = []struct {
+	Events      string
+	CloseBefore bool // Close the stream before iterating
+	CloseAfter  bool // Close the stream after iterating
+	State       StreamState
+}{
+	{Events: "", State: StreamEOF}, // 0
+	{Events: `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key"},"response":{"code":200}}` + "\n\n", State: StreamEOF},                // 1
+	{Events: `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key"},"response":{"code":200}}` + "\n" + `{"time":`, State: StreamErrored}, // 2
+	{Events: `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key"},"response":{"code":200}}`, CloseBefore: true, State: StreamClosed},   // 3
+	{Events: `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key"},"response":{"code":200}}`, CloseAfter: true, State: StreamEOF},       // 4
+	{Events: `{"time":`, CloseAfter: true, State: StreamErrored},                                                                                             // 5
+}
+
+func TestStreamState(t *testing.T) {
+	for i, test := range streamStateTests {
+		audit := NewAuditStream(&closeRecorder{Reader: strings.NewReader(test.Events)})
+		if state := audit.State(); state != StreamActive {
+			t.Fatalf("Test %d: invalid initial state: got %v - want %v", i, state, StreamActive)
+		}
+		if test.CloseBefore {
+			audit.Close()
+		}
+		for audit.Next() {
+			if state := audit.State(); state != StreamActive {
+				t.Fatalf("Test %d: invalid state: got %v - want %v", i, state, StreamActive)
+			}
+		}
+		if test.CloseAfter {
+			audit.Close()
+		}
+		if state := audit.State(); state != test.State {
+			t.Fatalf("Test %d: invalid audit stream state: got %v - want %v", i, state, test.State)
+		}
+
+		errs := NewErrorStream(&closeRecorder{Reader: strings.NewReader(test.Events)})
+		if test.CloseBefore {
+			errs.Close()
+		}
+		for errs.Next() {
+		}
+		if test.CloseAfter {
+			errs.Close()
+		}
+		if state := errs.State(); state != test.State {
+			t.Fatalf("Test %d: invalid error stream state: got %v - want %v", i, state, test.State)
+		}
+	}
+
+	stream := NewAuditStream(strings.NewReader(`{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key"},"response":{"code":200}}`))
+	if _, ok := stream.Peek(); !ok {
+		t.Fatalf("Failed to peek event: %v", stream.Err())
+	}
+	if state := stream.State(); state != StreamActive {
+		t.Fatalf("Invalid state after Peek: got %v - want %v", state, StreamActive)
+	}
+}
+
+func TestWithSafeBytes(t *testing.T) {
+	const Events = `{"message":"a"}
+{"message":"b"}`
+
+	var lines [][]byte
+	stream := NewErrorStream(strings.NewReader(Events), WithSafeBytes())
+	for stream.Next() {
+		lines = append(lines, stream.Bytes())
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("Failed to iterate over stream: %v", err)
+	}
+	for i, line := range strings.Split(Events, "\n") {
+		if string(lines[i]) != line {
+			t.Fatalf("Event %d: got raw content %q - want %q", i, lines[i], line)
+		}
+	}
+
+	stream = NewErrorStream(strings.NewReader(Events), WithSafeBytes())
+	if !stream.Next() {
+		t.Fatalf("Failed to read event: %v", stream.Err())
+	}
+	if a, b := stream.Bytes(), stream.Bytes(); &a[0] == &b[0] {
+		t.Fatal("Bytes returned the same underlying array twice")
+	}
+}
+
+var validateAuditLogTests = []struct {
+	Log   string
+	Valid int
+	Line  int
+	Err   bool
+}{
+	{Log: "", Valid: 0}, // 0
+	{ // 1
+		Log:   `{"time":"2020-03-24T12:37:33Z","request":{"path":"/version"},"response":{"code":200}}` + "\n\n" + `{"request":{"path":"/version"},"response":{"code":200}}` + "\n",
+		Valid: 2,
+	},
+	{ // 2
+		Log:   `{"request":{"path":"/version"},"response":{"code":200}}` + "\n\n" + `{"request":{"path":}}` + "\n" + `not json` + "\n" + `{}`,
+		Valid: 2,
+		Line:  3,
+		Err:   true,
+	},
+	{ // 3
+		Log:   `{"request":{"path":"/version"},"response":{"code":200}}` + "\n" + strings.Repeat("a", DefaultMaxEventSize+1),
+		Valid: 1,
+		Line:  2,
+		Err:   true,
+	},
+}
+
+func TestValidateAuditLog(t *testing.T) {
+	for i, test := range validateAuditLogTests {
+		valid, err, line := ValidateAuditLog(strings.NewReader(test.Log))
+		if test.Err && err == nil {
+			t.Fatalf("Test %d: validation should have failed", i)
+		}
+		if !test.Err && err != nil {
+			t.Fatalf("Test %d: validation failed: %v", i, err)
+		}
+		if valid != test.Valid {
+			t.Fatalf("Test %d: got %d valid events - want %d", i, valid, test.Valid)
+		}
+		if line != test.Line {
+			t.Fatalf("Test %d: got line %d - want %d", i, line, test.Line)
+		}
+	}
+}
+
+var verifyAuditChainTests = []struct {
+	Log      string
+	Verified int
+	BrokenAt int
+	Err      error
+	Fail     bool // Whether VerifyAuditChain should fail with an error other than Err
+}{
+	{Log: "", Err: ErrNoAuditChain}, // 0
+	{ // 1
+		Log: `{"request":{"path":"/version"},"response":{"code":200}}` + "\n",
+		Err: ErrNoAuditChain,
+	},
+	{ // 2
+		Log: `{"request":{"path":"/version"},"response":{"code":200},"hash":"a1","prev_hash":"a0"}` + "\n\n" +
+			`{"request":{"path":"/version"},"response":{"code":200},"hash":"a2","prev_hash":"a1"}` + "\n" +
+			`{"request":{"path":"/version"},"response":{"code":200},"hash":"a3","prev_hash":"a2"}`,
+		Verified: 3,
+	},
+	{ // 3
+		Log: `{"request":{"path":"/version"},"response":{"code":200},"hash":"a1","prev_hash":"a0"}` + "\n" +
+			`{"request":{"path":"/version"},"response":{"code":200},"hash":"a3","prev_hash":"a2"}` + "\n" +
+			`{"request":{"path":"/version"},"response":{"code":200},"hash":"a4","prev_hash":"a3"}`,
+		Verified: 1,
+		BrokenAt: 2,
+	},
+	{ // 4
+		Log: `{"request":{"path":"/version"},"response":{"code":200},"hash":"a1"}` + "\n" +
+			`{"request":{"path":"/version"},"response":{"code":200}}`,
+		Verified: 1,
+		BrokenAt: 2,
+	},
+	{ // 5
+		Log: `{"request":{"path":"/version"},"response":{"code":200},"hash":"a1"}` + "\n" +
+			`{"request":{"path":"/version"},"response":{"code":200},"prev_hash":"a1"}`,
+		Verified: 1,
+		BrokenAt: 2,
+	},
+	{ // 6
+		Log: `{"request":{"path":"/version"},"response":{"code":200},"hash":"a1"}` + "\n" +
+			`{"request":{"path":}}`,
+		Verified: 1,
+		BrokenAt: 2,
+		Fail:     true,
+	},
+}
+
+func TestVerifyAuditChain(t *testing.T) {
+	for i, test := range verifyAuditChainTests {
+		verified, brokenAt, err := VerifyAuditChain(strings.NewReader(test.Log))
+		if test.Fail {
+			if err == nil {
+				t.Fatalf("Test %d: verification should have failed", i)
+			}
+		} else if err != test.Err {
+			t.Fatalf("Test %d: invalid error: got %v - want %v", i, err, test.Err)
+		}
+		if verified != test.Verified {
+			t.Fatalf("Test %d: got %d verified events - want %d", i, verified, test.Verified)
+		}
+		if brokenAt != test.BrokenAt {
+			t.Fatalf("Test %d: got broken chain at line %d - want %d", i, brokenAt, test.BrokenAt)
+		}
+	}
+}
+
+var withBufferTests = []struct {
+	Buffer       []byte
+	Max          int
+	Size         int // Size of the event message
+	MaxEventSize int
+	Err          error
+}{
+	{Buffer: make([]byte, 0, 64), Max: 1 << 10, Size: 512, MaxEventSize: 1 << 10},                            // 0
+	{Buffer: make([]byte, 0, 64), Max: 1 << 10, Size: 1 << 10, MaxEventSize: 1 << 10, Err: bufio.ErrTooLong}, // 1
+	{Buffer: make([]byte, 0, 1<<12), Max: 1 << 10, Size: 2 << 10, MaxEventSize: 1 << 12},                     // 2
+	{Buffer: make([]byte, 0, 64), Max: 0, Size: 1 << 10, MaxEventSize: DefaultMaxEventSize},                  // 3
+}
+
+func TestWithBuffer(t *testing.T) {
+	for i, test := range withBufferTests {
+		event := `{"message":"` + strings.Repeat("a", test.Size) + `"}`
+
+		stream := NewErrorStream(strings.NewReader(event+"\n"+event), WithBuffer(test.Buffer, test.Max))
+		for stream.Next() {
+			if n := len(stream.Event().Message); n != test.Size {
+				t.Fatalf("Test %d: got message of size %d - want %d", i, n, test.Size)
+			}
+		}
+		if err := stream.Err(); err != test.Err {
+			t.Fatalf("Test %d: got error %v - want error %v", i, err, test.Err)
+		}
+		if n := stream.MaxEventSize(); n != test.MaxEventSize {
+			t.Fatalf("Test %d: got max. event size %d - want %d", i, n, test.MaxEventSize)
+		}
+	}
+}
+
+func TestWithIdleTimeout(t *testing.T) {
+	const Event = `{"message":"a"}` + "\n"
+
+	// An io.Reader that implements io.Closer
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	go io.WriteString(writer, Event)
+
+	stream := NewErrorStream(reader, WithIdleTimeout(50*time.Millisecond))
+	if !stream.Next() {
+		t.Fatalf("Failed to read event: %v", stream.Err())
+	}
+	if stream.Next() {
+		t.Fatal("Next returned true after idle timeout")
+	}
+	if err := stream.Err(); err != ErrIdleTimeout {
+		t.Fatalf("Invalid error: got %v - want %v", err, ErrIdleTimeout)
+	}
+
+	// An io.Reader that implements SetReadDeadline
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go io.WriteString(server, Event)
+
+	stream = NewErrorStream(client, WithIdleTimeout(50*time.Millisecond))
+	if !stream.Next() {
+		t.Fatalf("Failed to read event: %v", stream.Err())
+	}
+	if stream.Next() {
+		t.Fatal("Next returned true after idle timeout")
+	}
+	if err := stream.Err(); err != ErrIdleTimeout {
+		t.Fatalf("Invalid error: got %v - want %v", err, ErrIdleTimeout)
+	}
+
+	// A canceled ctx takes precedence over the idle timeout
+	reader, writer = io.Pipe()
+	defer writer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	stream = NewErrorStream(reader, WithIdleTimeout(time.Minute))
+	if stream.NextContext(ctx) {
+		t.Fatal("NextContext returned true after ctx has been canceled")
+	}
+	if err := stream.Err(); err != context.DeadlineExceeded {
+		t.Fatalf("Invalid error: got %v - want %v", err, context.DeadlineExceeded)
+	}
+}
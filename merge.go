@@ -0,0 +1,365 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// MergeAuditStreams returns an AuditStream that contains
+// the AuditEvents of all given streams in the order in
+// which the given streams produce them.
+//
+// The returned AuditStream stops once all given streams
+// have reached their end or once one of them fails. Then,
+// its Err method returns the first error of any of the
+// given streams and all other streams get closed.
+//
+// Closing the returned AuditStream closes all given streams.
+// The given streams must not be used directly anymore.
+func MergeAuditStreams(streams ...*AuditStream) *AuditStream {
+	return NewAuditStream(newMergeReader(streams), WithMaxEventSize(mergedMaxEventSize(streams)))
+}
+
+// MergeAuditStreamsOrdered returns an AuditStream that
+// contains the AuditEvents of all given streams ordered
+// by their time. It assumes that each given stream is
+// itself ordered by time.
+//
+// Therefore, the returned AuditStream has to wait until
+// each of the given streams has produced its next event
+// or has reached its end. Hence, it is primarily useful
+// when merging archived logs. When merging live
+// subscriptions, one quiet stream delays all others.
+//
+// Otherwise, it behaves like MergeAuditStreams.
+func MergeAuditStreamsOrdered(streams ...*AuditStream) *AuditStream {
+	return NewAuditStream(&orderedMergeReader{streams: streams}, WithMaxEventSize(mergedMaxEventSize(streams)))
+}
+
+// mergedMaxEventSize returns the max. event size
+// of a stream that merges the given streams.
+func mergedMaxEventSize(streams []*AuditStream) int {
+	maxEventSize := DefaultMaxEventSize
+	for _, s := range streams {
+		if n := s.MaxEventSize(); n > maxEventSize {
+			maxEventSize = n
+		}
+	}
+	return maxEventSize + 1 // +1 for the newline
+}
+
+// mergeReader is an io.ReadCloser that concurrently reads
+// AuditEvents from multiple AuditStreams and returns them,
+// one per line, as soon as they arrive.
+type mergeReader struct {
+	streams []*AuditStream
+	lines   chan []byte
+	pending []byte
+
+	lock    sync.Mutex
+	err     error // first error of any stream
+	running int   // number of streams that haven't stopped yet
+	done    chan struct{}
+	closed  bool
+}
+
+func newMergeReader(streams []*AuditStream) *mergeReader {
+	r := &mergeReader{
+		streams: streams,
+		lines:   make(chan []byte),
+		running: len(streams),
+		done:    make(chan struct{}),
+	}
+	if len(streams) == 0 {
+		close(r.done)
+	}
+	for _, s := range streams {
+		go r.read(s)
+	}
+	return r
+}
+
+// read forwards all AuditEvents of s to r until
+// s stops or r gets closed.
+func (r *mergeReader) read(s *AuditStream) {
+	for s.Next() {
+		line := append(append(make([]byte, 0, len(s.Bytes())+1), s.Bytes()...), '\n')
+		select {
+		case r.lines <- line:
+		case <-r.done:
+			return
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.running--
+	if err := s.Err(); err != nil && r.err == nil && !r.closed {
+		r.err = err
+		r.closeStreams() // Stop all other streams
+		return
+	}
+	if r.running == 0 && !r.closed {
+		r.closed = true
+		close(r.done)
+	}
+}
+
+func (r *mergeReader) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		select {
+		case line := <-r.lines:
+			r.pending = line
+		case <-r.done:
+			r.lock.Lock()
+			defer r.lock.Unlock()
+			if r.err != nil {
+				return 0, r.err
+			}
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// Close closes all AuditStreams.
+func (r *mergeReader) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	return r.closeStreams()
+}
+
+// closeStreams closes all AuditStreams and returns
+// the first error encountered, if any. The caller
+// must hold the lock.
+func (r *mergeReader) closeStreams() error {
+	r.closed = true
+	close(r.done)
+
+	var err error
+	for _, s := range r.streams {
+		if closeErr := s.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// orderedMergeReader is an io.ReadCloser that merges
+// multiple AuditStreams into one stream of lines that
+// is ordered by the AuditEvent time.
+//
+// It keeps the next AuditEvent of each stream and
+// returns the earliest one. Therefore, it assumes
+// that each AuditStream itself is ordered by time.
+type orderedMergeReader struct {
+	streams []*AuditStream
+	heads   []*mergeHead // the next event of each stream, nil once a stream ended
+	pending []byte
+	err     error
+}
+
+type mergeHead struct {
+	Event AuditEvent
+	Line  []byte
+}
+
+func (r *orderedMergeReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if len(r.pending) == 0 {
+		if r.heads == nil {
+			r.heads = make([]*mergeHead, len(r.streams))
+			for i := range r.streams {
+				if r.err = r.advance(i); r.err != nil {
+					r.Close()
+					return 0, r.err
+				}
+			}
+		}
+
+		next := -1
+		for i, head := range r.heads {
+			if head != nil && (next < 0 || head.Event.Time.Before(r.heads[next].Event.Time)) {
+				next = i
+			}
+		}
+		if next < 0 {
+			return 0, io.EOF
+		}
+		r.pending = append(r.heads[next].Line, '\n')
+		if r.err = r.advance(next); r.err != nil {
+			r.Close()
+			return 0, r.err
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// advance replaces the head of the i-th stream
+// with its next AuditEvent.
+func (r *orderedMergeReader) advance(i int) error {
+	s := r.streams[i]
+	if !s.Next() {
+		r.heads[i] = nil
+		return s.Err()
+	}
+	r.heads[i] = &mergeHead{
+		Event: s.Event(),
+		Line:  append(make([]byte, 0, len(s.Bytes())+1), s.Bytes()...),
+	}
+	return nil
+}
+
+// Close closes all AuditStreams.
+func (r *orderedMergeReader) Close() error {
+	var err error
+	for _, s := range r.streams {
+		if closeErr := s.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// LogKind identifies the log a LogEvent belongs to.
+type LogKind string
+
+// All log kinds of a LogEvent.
+const (
+	LogKindAudit LogKind = "audit"
+	LogKindError LogKind = "error"
+)
+
+// String returns the string representation
+// of the LogKind.
+func (k LogKind) String() string { return string(k) }
+
+// LogEvent is either an AuditEvent or an ErrorEvent
+// depending on its Kind.
+type LogEvent struct {
+	Kind  LogKind
+	Audit AuditEvent // Only set if Kind is LogKindAudit
+	Error ErrorEvent // Only set if Kind is LogKindError
+}
+
+// Time returns the point in time of the AuditEvent
+// resp. ErrorEvent. It returns the zero time.Time if
+// the event does not contain a point in time.
+func (e LogEvent) Time() time.Time {
+	if e.Kind == LogKindError {
+		return e.Error.Time
+	}
+	return e.Audit.Time
+}
+
+// MergeLogs returns a LogStream that contains the events
+// of the audit and error stream ordered by their time.
+//
+// The LogStream has to wait until both streams have produced
+// their next event or have reached their end. Hence, like
+// MergeAuditStreamsOrdered, it is primarily useful when merging
+// archived logs or busy subscriptions. An ErrorEvent that
+// does not contain a point in time - e.g. because it has
+// been produced by an older server - cannot be ordered.
+// It is returned as soon as it has been received.
+//
+// The LogStream stops once both streams have reached their
+// end or once one of them fails. Closing the LogStream
+// closes both streams. They must not be used directly
+// anymore.
+func MergeLogs(audit *AuditStream, errs *ErrorStream) *LogStream {
+	return &LogStream{
+		audit: audit,
+		errs:  errs,
+	}
+}
+
+// LogStream is a time-ordered stream of audit and error
+// events. It is created by MergeLogs.
+type LogStream struct {
+	audit *AuditStream
+	errs  *ErrorStream
+
+	auditHead, errorHead   *LogEvent // the next event of each stream, nil if not read yet
+	auditEnded, errorEnded bool
+	event                  LogEvent
+	err                    error
+}
+
+// Next advances the stream to the next LogEvent, which
+// will then be available through the Event method. It
+// returns false when the iteration stops - i.e. by
+// reaching the end of both streams, closing the stream
+// or in case of an error.
+func (s *LogStream) Next() bool {
+	if s.err != nil {
+		return false
+	}
+	if s.auditHead == nil && !s.auditEnded {
+		if s.audit.Next() {
+			s.auditHead = &LogEvent{Kind: LogKindAudit, Audit: s.audit.Event()}
+		} else if s.err = s.audit.Err(); s.err != nil {
+			return false
+		} else {
+			s.auditEnded = true
+		}
+	}
+	if s.errorHead == nil && !s.errorEnded {
+		if s.errs.Next() {
+			s.errorHead = &LogEvent{Kind: LogKindError, Error: s.errs.Event()}
+		} else if s.err = s.errs.Err(); s.err != nil {
+			return false
+		} else {
+			s.errorEnded = true
+		}
+	}
+
+	switch {
+	case s.auditHead == nil && s.errorHead == nil:
+		return false
+	case s.auditHead == nil:
+		s.event, s.errorHead = *s.errorHead, nil
+	case s.errorHead == nil:
+		s.event, s.auditHead = *s.auditHead, nil
+	case !s.errorHead.Error.HasTime() || s.errorHead.Time().Before(s.auditHead.Time()):
+		s.event, s.errorHead = *s.errorHead, nil
+	default:
+		s.event, s.auditHead = *s.auditHead, nil
+	}
+	return true
+}
+
+// Event returns the most recent LogEvent generated
+// by a call to Next.
+func (s *LogStream) Event() LogEvent { return s.event }
+
+// Err returns the first non-EOF error of the audit
+// or error stream. It returns ErrStreamClosed if the
+// iteration stopped because the stream has been closed.
+func (s *LogStream) Err() error { return s.err }
+
+// Close closes the audit and error stream. It
+// returns the first error encountered, if any.
+func (s *LogStream) Close() error {
+	err := s.audit.Close()
+	if closeErr := s.errs.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,154 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import (
+	"strings"
+	"testing"
+)
+
+var mergeAuditStreamsTests = []struct {
+	Streams      []string
+	TimeOrdering bool
+	Times        []string // Only checked if TimeOrdering is set
+	N            int
+	Err          bool
+}{
+	{ // 0
+		Streams: nil,
+		N:       0,
+	},
+	{ // 1
+		Streams: []string{
+			`{"time":"2021-01-01T12:00:00Z"}` + "\n" + `{"time":"2021-01-01T12:00:02Z"}`,
+			`{"time":"2021-01-01T12:00:01Z"}` + "\n\n" + `{"time":"2021-01-01T12:00:03Z"}`,
+		},
+		N: 4,
+	},
+	{ // 2
+		Streams: []string{
+			`{"time":"2021-01-01T12:00:00Z"}` + "\n" + `{"time":"2021-01-01T12:00:02Z"}`,
+			`{"time":"2021-01-01T12:00:01Z"}` + "\n\n" + `{"time":"2021-01-01T12:00:03Z"}`,
+			`{"time":"2021-01-01T11:59:59Z"}`,
+		},
+		TimeOrdering: true,
+		Times:        []string{"11:59:59", "12:00:00", "12:00:01", "12:00:02", "12:00:03"},
+		N:            5,
+	},
+	{ // 3
+		Streams: []string{
+			`{"time":"2021-01-01T12:00:00Z"}`,
+			`{"time":"2021-01-01T12:00:01Z"}` + "\n" + `{"time":`,
+		},
+		TimeOrdering: true,
+		Err:          true,
+	},
+	{ // 4
+		Streams: []string{
+			`{"time":"2021-01-01T12:00:00Z"}`,
+			`{"time":`,
+		},
+		Err: true,
+	},
+}
+
+func TestMergeAuditStreams(t *testing.T) {
+	for i, test := range mergeAuditStreamsTests {
+		streams := make([]*AuditStream, 0, len(test.Streams))
+		for _, s := range test.Streams {
+			streams = append(streams, NewAuditStream(strings.NewReader(s)))
+		}
+
+		var stream *AuditStream
+		if test.TimeOrdering {
+			stream = MergeAuditStreamsOrdered(streams...)
+		} else {
+			stream = MergeAuditStreams(streams...)
+		}
+
+		var times []string
+		for stream.Next() {
+			times = append(times, stream.Event().Time.UTC().Format("15:04:05"))
+		}
+		if err := stream.Err(); (err != nil) != test.Err {
+			t.Fatalf("Test %d: got error %v - want error: %v", i, err, test.Err)
+		}
+		if test.Err {
+			continue
+		}
+		if len(times) != test.N {
+			t.Fatalf("Test %d: got %d events - want %d", i, len(times), test.N)
+		}
+		if test.TimeOrdering {
+			for j := range times {
+				if times[j] != test.Times[j] {
+					t.Fatalf("Test %d: event %d: got time %s - want %s", i, j, times[j], test.Times[j])
+				}
+			}
+		}
+	}
+}
+
+var mergeLogsTests = []struct {
+	Audit  string
+	Errors string
+	Events []string
+	Err    bool
+}{
+	{ // 0
+		Audit:  "",
+		Errors: "",
+		Events: nil,
+	},
+	{ // 1
+		Audit:  `{"time":"2021-01-01T12:00:00Z"}` + "\n" + `{"time":"2021-01-01T12:00:02Z"}`,
+		Errors: `{"message":"a","time":"2021-01-01T12:00:01Z"}` + "\n\n" + `{"message":"b","time":"2021-01-01T12:00:03Z"}`,
+		Events: []string{"audit 12:00:00", "error 12:00:01", "audit 12:00:02", "error 12:00:03"},
+	},
+	{ // 2
+		Audit:  `{"time":"2021-01-01T12:00:00Z"}` + "\n" + `{"time":"2021-01-01T12:00:02Z"}`,
+		Errors: `{"message":"a"}` + "\n" + `{"message":"b","time":"2021-01-01T12:00:01Z"}`,
+		Events: []string{"error 00:00:00", "audit 12:00:00", "error 12:00:01", "audit 12:00:02"},
+	},
+	{ // 3
+		Audit:  `{"time":"2021-01-01T12:00:00Z"}`,
+		Errors: "",
+		Events: []string{"audit 12:00:00"},
+	},
+	{ // 4
+		Audit:  `{"time":"2021-01-01T12:00:00Z"}`,
+		Errors: `{"message":`,
+		Err:    true,
+	},
+}
+
+func TestMergeLogs(t *testing.T) {
+	for i, test := range mergeLogsTests {
+		audit := &closeRecorder{Reader: strings.NewReader(test.Audit)}
+		errs := &closeRecorder{Reader: strings.NewReader(test.Errors)}
+		stream := MergeLogs(NewAuditStream(audit), NewErrorStream(errs))
+
+		var events []string
+		for stream.Next() {
+			event := stream.Event()
+			events = append(events, event.Kind.String()+" "+event.Time().UTC().Format("15:04:05"))
+		}
+		if err := stream.Err(); (err != nil) != test.Err {
+			t.Fatalf("Test %d: got error %v - want error: %v", i, err, test.Err)
+		}
+		if err := stream.Close(); err != nil {
+			t.Fatalf("Test %d: failed to close stream: %v", i, err)
+		}
+		if !audit.Closed || !errs.Closed {
+			t.Fatalf("Test %d: closing the stream did not close both streams", i)
+		}
+		if test.Err {
+			continue
+		}
+		if strings.Join(events, ",") != strings.Join(test.Events, ",") {
+			t.Fatalf("Test %d: got events %v - want %v", i, events, test.Events)
+		}
+	}
+}
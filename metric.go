@@ -12,6 +12,9 @@ type Metric struct {
 	RequestErr  uint64 // Requests that failed with a well-defined error
 	RequestFail uint64 // Requests that failed unexpectedly due to an internal error
 
+	RequestActive uint64 // Requests that are currently processed by the server
+	AuditEvents   uint64 // Audit events written by the server
+
 	// Histogram of the KES server response latency.
 	// It shows how fast the server can handle requests.
 	//
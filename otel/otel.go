@@ -0,0 +1,99 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+// Package otel converts KES audit events into
+// OpenTelemetry spans. It allows to show requests
+// handled by a KES server within a distributed trace.
+package otel
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/minio/kes"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attribute keys of KES-specific span attributes
+// that are not covered by the semantic conventions.
+const (
+	// IdentityKey is the identity of the client
+	// that has sent the request.
+	IdentityKey = attribute.Key("kes.identity")
+
+	// DurationKey is the time, in nanoseconds, it
+	// took the server to handle the request.
+	DurationKey = attribute.Key("kes.duration_ns")
+)
+
+// SpanAttributes returns the span attributes of the
+// given audit event. It uses the OpenTelemetry semantic
+// conventions for HTTP where applicable - e.g. the
+// request path is returned as "http.target" attribute.
+//
+// The request method, client IP and user agent are only
+// present if the event contains them. Older servers do
+// not send them.
+func SpanAttributes(event kes.AuditEvent) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{
+		semconv.HTTPTargetKey.String(event.Request.Path),
+		semconv.HTTPStatusCodeKey.Int(event.Response.StatusCode),
+		IdentityKey.String(event.Request.Identity),
+		DurationKey.Int64(int64(event.Response.Time)),
+	}
+	if event.Request.Method != "" {
+		attributes = append(attributes, semconv.HTTPMethodKey.String(event.Request.Method))
+	}
+	if event.Request.IP != "" {
+		attributes = append(attributes, semconv.HTTPClientIPKey.String(event.Request.IP))
+	}
+	if event.Request.UserAgent != "" {
+		attributes = append(attributes, semconv.HTTPUserAgentKey.String(event.Request.UserAgent))
+	}
+	return attributes
+}
+
+// StartSpan creates a new span for the given audit event
+// using the tracer and ends it right away. The span starts
+// at the event time and lasts as long as the server took to
+// handle the request. Its name is the API operation of the
+// request, e.g. "/v1/key/create", or the request path if it
+// does not refer to any API.
+//
+// Responses with a 5xx status code mark the span as failed.
+func StartSpan(ctx context.Context, tracer trace.Tracer, event kes.AuditEvent) {
+	name := event.Request.Path
+	if api, _, ok := event.Request.API(); ok {
+		name = api.String()
+	}
+
+	_, span := tracer.Start(ctx, name,
+		trace.WithTimestamp(event.Time),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(SpanAttributes(event)...),
+	)
+	if event.Response.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(event.Response.StatusCode))
+	}
+	span.End(trace.WithTimestamp(event.Time.Add(event.Response.Time)))
+}
+
+// Export reads audit events from the stream and emits one
+// span per event using the tracer - see StartSpan. It returns
+// once the stream ends or the ctx is canceled.
+//
+// Export does not close the stream. It returns the error
+// that stopped the stream, if any, or the ctx error.
+func Export(ctx context.Context, tracer trace.Tracer, stream *kes.AuditStream) error {
+	for stream.NextContext(ctx) {
+		StartSpan(ctx, tracer, stream.Event())
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return stream.Err()
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package otel
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/kes"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/oteltest"
+	"go.opentelemetry.io/otel/semconv"
+)
+
+var spanAttributesTests = []struct {
+	Event      kes.AuditEvent
+	Attributes map[attribute.Key]attribute.Value
+}{
+	{ // 0
+		Event: kes.AuditEvent{
+			Request: kes.AuditEventRequest{
+				Path:     "/v1/key/create/my-key",
+				Identity: "2ecb8804e7702a6b768e87cfa843b8f9c6c7c6a5dd0f23d7d6f4f9a3ab5e57a7",
+			},
+			Response: kes.AuditEventResponse{
+				StatusCode: http.StatusOK,
+				Time:       3 * time.Millisecond,
+			},
+		},
+		Attributes: map[attribute.Key]attribute.Value{
+			semconv.HTTPTargetKey:     attribute.StringValue("/v1/key/create/my-key"),
+			semconv.HTTPStatusCodeKey: attribute.IntValue(http.StatusOK),
+			IdentityKey:               attribute.StringValue("2ecb8804e7702a6b768e87cfa843b8f9c6c7c6a5dd0f23d7d6f4f9a3ab5e57a7"),
+			DurationKey:               attribute.Int64Value(int64(3 * time.Millisecond)),
+		},
+	},
+	{ // 1
+		Event: kes.AuditEvent{
+			Request: kes.AuditEventRequest{
+				Path:      "/v1/key/delete/my-key",
+				Method:    http.MethodDelete,
+				Identity:  "2ecb8804e7702a6b768e87cfa843b8f9c6c7c6a5dd0f23d7d6f4f9a3ab5e57a7",
+				IP:        "10.1.2.3",
+				UserAgent: "kes-go",
+			},
+			Response: kes.AuditEventResponse{
+				StatusCode: http.StatusForbidden,
+				Time:       time.Millisecond,
+			},
+		},
+		Attributes: map[attribute.Key]attribute.Value{
+			semconv.HTTPTargetKey:     attribute.StringValue("/v1/key/delete/my-key"),
+			semconv.HTTPStatusCodeKey: attribute.IntValue(http.StatusForbidden),
+			semconv.HTTPMethodKey:     attribute.StringValue(http.MethodDelete),
+			semconv.HTTPClientIPKey:   attribute.StringValue("10.1.2.3"),
+			semconv.HTTPUserAgentKey:  attribute.StringValue("kes-go"),
+			IdentityKey:               attribute.StringValue("2ecb8804e7702a6b768e87cfa843b8f9c6c7c6a5dd0f23d7d6f4f9a3ab5e57a7"),
+			DurationKey:               attribute.Int64Value(int64(time.Millisecond)),
+		},
+	},
+}
+
+func TestSpanAttributes(t *testing.T) {
+	for i, test := range spanAttributesTests {
+		attributes := SpanAttributes(test.Event)
+		if len(attributes) != len(test.Attributes) {
+			t.Fatalf("Test %d: got %d attributes - want %d", i, len(attributes), len(test.Attributes))
+		}
+		for _, attr := range attributes {
+			if value, ok := test.Attributes[attr.Key]; !ok || value != attr.Value {
+				t.Fatalf("Test %d: invalid attribute %q: got %v - want %v", i, attr.Key, attr.Value.Emit(), value.Emit())
+			}
+		}
+	}
+}
+
+const exportStream = `{"time":"2021-01-01T10:00:00Z","request":{"path":"/v1/key/create/my-key","identity":"a"},"response":{"code":200,"time":2000000}}
+{"time":"2021-01-01T10:00:01Z","request":{"path":"/v1/key/decrypt/my-key","identity":"a"},"response":{"code":502,"time":1000000}}
+{"time":"2021-01-01T10:00:02Z","request":{"path":"/unknown","identity":"a"},"response":{"code":404,"time":1000000}}
+`
+
+func TestExport(t *testing.T) {
+	recorder := new(oteltest.SpanRecorder)
+	tracer := oteltest.NewTracerProvider(oteltest.WithSpanRecorder(recorder)).Tracer("kes")
+
+	stream := kes.NewAuditStream(strings.NewReader(exportStream))
+	if err := Export(context.Background(), tracer, stream); err != nil {
+		t.Fatalf("Failed to export audit stream: %v", err)
+	}
+
+	spans := recorder.Completed()
+	if len(spans) != 3 {
+		t.Fatalf("Got %d spans - want %d", len(spans), 3)
+	}
+	if name := spans[0].Name(); name != kes.KeyCreate.String() {
+		t.Fatalf("Invalid span name: got %q - want %q", name, kes.KeyCreate.String())
+	}
+	if name := spans[2].Name(); name != "/unknown" {
+		t.Fatalf("Invalid span name: got %q - want %q", name, "/unknown")
+	}
+
+	start := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	if !spans[0].StartTime().Equal(start) {
+		t.Fatalf("Invalid span start time: got %v - want %v", spans[0].StartTime(), start)
+	}
+	if end, _ := spans[0].EndTime(); !end.Equal(start.Add(2 * time.Millisecond)) {
+		t.Fatalf("Invalid span end time: got %v - want %v", end, start.Add(2*time.Millisecond))
+	}
+	if code := spans[0].StatusCode(); code != codes.Unset {
+		t.Fatalf("Invalid span status: got %v - want %v", code, codes.Unset)
+	}
+	if code := spans[1].StatusCode(); code != codes.Error {
+		t.Fatalf("Invalid span status: got %v - want %v", code, codes.Error)
+	}
+}
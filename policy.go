@@ -6,15 +6,18 @@ package kes
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"path"
+	"sort"
 	"strings"
 )
 
 type Policy struct {
 	patterns []string
+	deny     []string
 }
 
 func NewPolicy(patterns ...string) (*Policy, error) {
@@ -28,12 +31,34 @@ func NewPolicy(patterns ...string) (*Policy, error) {
 	}, nil
 }
 
+// Deny adds the given glob patterns to the policy. A request
+// is rejected if its path matches any of these patterns - even
+// if it also matches one of the patterns passed to NewPolicy.
+func (p *Policy) Deny(patterns ...string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, pattern); err != nil {
+			return err
+		}
+	}
+	p.deny = append(p.deny, patterns...)
+	return nil
+}
+
+// Allowed returns the glob patterns of all paths
+// allowed by the policy.
+func (p *Policy) Allowed() []string { return append([]string(nil), p.patterns...) }
+
+// Denied returns the glob patterns of all paths
+// explicitly denied by the policy.
+func (p *Policy) Denied() []string { return append([]string(nil), p.deny...) }
+
 func (p Policy) MarshalJSON() ([]byte, error) {
 	type PolicyJSON struct {
 		Patterns []string `json:"paths"`
+		Deny     []string `json:"deny,omitempty"`
 	}
 
-	policy := PolicyJSON{Patterns: p.patterns}
+	policy := PolicyJSON{Patterns: p.patterns, Deny: p.deny}
 	if len(policy.Patterns) == 0 {
 		policy.Patterns = []string{} // marshal nil as empty array ([]) -  not null
 	}
@@ -46,6 +71,7 @@ func (p *Policy) UnmarshalJSON(b []byte) error {
 
 	var policyJSON struct {
 		Patterns []string `json:"paths"`
+		Deny     []string `json:"deny"`
 	}
 	if err := d.Decode(&policyJSON); err != nil {
 		return err
@@ -55,7 +81,13 @@ func (p *Policy) UnmarshalJSON(b []byte) error {
 			return err
 		}
 	}
+	for _, pattern := range policyJSON.Deny {
+		if _, err := path.Match(pattern, pattern); err != nil {
+			return err
+		}
+	}
 	p.patterns = policyJSON.Patterns
+	p.deny = policyJSON.Deny
 	return nil
 }
 
@@ -68,10 +100,24 @@ func (p *Policy) String() string {
 		}
 	}
 	fmt.Fprintln(&builder, "]")
+	if len(p.deny) > 0 {
+		fmt.Fprintln(&builder, "deny: [")
+		for _, pattern := range p.deny {
+			if pattern != "" {
+				fmt.Fprintf(&builder, "  %s\n", pattern)
+			}
+		}
+		fmt.Fprintln(&builder, "]")
+	}
 	return builder.String()
 }
 
 func (p *Policy) Verify(r *http.Request) error {
+	for _, pattern := range p.deny {
+		if ok, err := path.Match(pattern, r.URL.Path); ok && err == nil {
+			return ErrNotAllowed
+		}
+	}
 	for _, pattern := range p.patterns {
 		if ok, err := path.Match(pattern, r.URL.Path); ok && err == nil {
 			return nil
@@ -79,3 +125,109 @@ func (p *Policy) Verify(r *http.Request) error {
 	}
 	return ErrNotAllowed
 }
+
+// PolicyChange is a named policy that should be
+// created or updated. See: PolicyDiff.
+type PolicyChange struct {
+	Name   string
+	Policy *Policy
+}
+
+// PolicyDiff describes the changes required to turn
+// one set of policies into another. See: DiffPolicies.
+type PolicyDiff struct {
+	Create []PolicyChange // Policies that don't exist yet
+	Update []PolicyChange // Policies that exist but differ
+	Delete []string       // Names of policies that should not exist
+}
+
+// IsEmpty returns true if the PolicyDiff contains no changes.
+func (d PolicyDiff) IsEmpty() bool {
+	return len(d.Create) == 0 && len(d.Update) == 0 && len(d.Delete) == 0
+}
+
+// DiffPolicies returns the changes required to turn the
+// actual policies into the desired policies. Each map
+// maps a policy name to its policy.
+//
+// A policy is updated if its allowed or denied patterns
+// differ. The order of the patterns does not matter.
+// All changes are sorted by policy name.
+func DiffPolicies(desired, actual map[string]*Policy) PolicyDiff {
+	var diff PolicyDiff
+	for name, policy := range desired {
+		current, ok := actual[name]
+		switch {
+		case !ok:
+			diff.Create = append(diff.Create, PolicyChange{Name: name, Policy: policy})
+		case !equalPolicies(policy, current):
+			diff.Update = append(diff.Update, PolicyChange{Name: name, Policy: policy})
+		}
+	}
+	for name := range actual {
+		if _, ok := desired[name]; !ok {
+			diff.Delete = append(diff.Delete, name)
+		}
+	}
+	sort.Slice(diff.Create, func(i, j int) bool { return diff.Create[i].Name < diff.Create[j].Name })
+	sort.Slice(diff.Update, func(i, j int) bool { return diff.Update[i].Name < diff.Update[j].Name })
+	sort.Strings(diff.Delete)
+	return diff
+}
+
+// ApplyPolicyDiff applies the changes of the PolicyDiff
+// using the Client. It creates, updates and then deletes
+// policies in the order of the PolicyDiff.
+//
+// It stops at the first change that fails and returns a
+// PolicyDiffError that describes which policy could not
+// be changed. Changes applied before are not reverted.
+func ApplyPolicyDiff(ctx context.Context, c *Client, d PolicyDiff) error {
+	for _, change := range d.Create {
+		if err := c.SetPolicy(ctx, change.Name, change.Policy); err != nil {
+			return PolicyDiffError{Op: "create", Name: change.Name, Err: err}
+		}
+	}
+	for _, change := range d.Update {
+		if err := c.SetPolicy(ctx, change.Name, change.Policy); err != nil {
+			return PolicyDiffError{Op: "update", Name: change.Name, Err: err}
+		}
+	}
+	for _, name := range d.Delete {
+		if err := c.DeletePolicy(ctx, name); err != nil {
+			return PolicyDiffError{Op: "delete", Name: name, Err: err}
+		}
+	}
+	return nil
+}
+
+// equalPolicies returns true if both policies allow
+// and deny the same patterns - regardless of their
+// order. A nil policy has no patterns.
+func equalPolicies(a, b *Policy) bool {
+	if a == nil {
+		a = &Policy{}
+	}
+	if b == nil {
+		b = &Policy{}
+	}
+	return equalPatterns(a.patterns, b.patterns) && equalPatterns(a.deny, b.deny)
+}
+
+// equalPatterns returns true if a and b contain the
+// same patterns - regardless of their order.
+func equalPatterns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
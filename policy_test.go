@@ -5,8 +5,13 @@
 package kes
 
 import (
+	"context"
+	"errors"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"path"
+	"reflect"
 	"sort"
 	"testing"
 )
@@ -66,6 +71,10 @@ var policyMarshalJSONTests = []struct {
 		Policy: mustNewPolicy("/v1/key/create/*", "/v1/key/delete/*", "/v1/key/generate/my-key"),
 		Output: `{"paths":["/v1/key/create/*","/v1/key/delete/*","/v1/key/generate/my-key"]}`,
 	},
+	{
+		Policy: mustNewPolicyWithDeny([]string{"/v1/key/create/*"}, []string{"/v1/key/create/root-*"}),
+		Output: `{"paths":["/v1/key/create/*"],"deny":["/v1/key/create/root-*"]}`,
+	},
 }
 
 func TestPolicyMarshalJSON(t *testing.T) {
@@ -117,6 +126,16 @@ var policyUnmarshalJSONTests = []struct {
 		Policy: mustNewPolicy("/v1/key/create/*", "/v1/key/delete/*", "/v1/key/generate/my-key"),
 		Err:    path.ErrBadPattern,
 	},
+	{ // 6
+		Source: `{"paths":["/v1/key/create/*"],"deny":["/v1/key/create/root-*"]}`,
+		Policy: mustNewPolicyWithDeny([]string{"/v1/key/create/*"}, []string{"/v1/key/create/root-*"}),
+		Err:    nil,
+	},
+	{ // 7
+		Source: `{"paths":["/v1/key/create/*"],"deny":["/v1/key/create/root-\\"]}`,
+		Policy: mustNewPolicy("/v1/key/create/*"),
+		Err:    path.ErrBadPattern,
+	},
 }
 
 func TestPolicyUnmarshalJSON(t *testing.T) {
@@ -138,6 +157,9 @@ func TestPolicyUnmarshalJSON(t *testing.T) {
 					t.Fatalf("Test %d: policy path %d does not match: got %s - want %s", i, j, policy.patterns[j], test.Policy.patterns[j])
 				}
 			}
+			if len(policy.deny) != len(test.Policy.deny) {
+				t.Fatalf("Test %d: policy differs in denied paths: got %d - want %d", i, len(policy.deny), len(test.Policy.deny))
+			}
 		}
 	}
 }
@@ -226,6 +248,134 @@ func TestPolicyVerify(t *testing.T) {
 	}
 }
 
+func TestPolicyDeny(t *testing.T) {
+	const baseURL = "https://localhost:7373"
+
+	policy := mustNewPolicyWithDeny([]string{"/v1/key/create/*"}, []string{"/v1/key/create/root-*"})
+	req, _ := http.NewRequest(http.MethodPost, baseURL+"/v1/key/create/my-key", nil)
+	if err := policy.Verify(req); err != nil {
+		t.Fatalf("Path should have matched pattern - but got: %v", err)
+	}
+	req, _ = http.NewRequest(http.MethodPost, baseURL+"/v1/key/create/root-key", nil)
+	if err := policy.Verify(req); err != ErrNotAllowed {
+		t.Fatalf("Denied path should not have matched pattern: got %v - want %v", err, ErrNotAllowed)
+	}
+	if err := policy.Deny("/v1/key/create/[a-"); err != path.ErrBadPattern {
+		t.Fatalf("Invalid error: got %v - want %v", err, path.ErrBadPattern)
+	}
+}
+
+var diffPoliciesTests = []struct {
+	Desired map[string]*Policy
+	Actual  map[string]*Policy
+	Create  []string
+	Update  []string
+	Delete  []string
+}{
+	{ // 0
+		Desired: nil,
+		Actual:  nil,
+	},
+	{ // 1
+		Desired: map[string]*Policy{
+			"b": mustNewPolicy("/v1/key/create/*"),
+			"a": mustNewPolicy("/v1/key/create/*"),
+		},
+		Create: []string{"a", "b"},
+	},
+	{ // 2
+		Actual: map[string]*Policy{
+			"b": mustNewPolicy("/v1/key/create/*"),
+			"a": mustNewPolicy("/v1/key/create/*"),
+		},
+		Delete: []string{"a", "b"},
+	},
+	{ // 3
+		Desired: map[string]*Policy{
+			"same":    mustNewPolicy("/v1/key/create/*", "/v1/key/delete/*"),
+			"changed": mustNewPolicyWithDeny([]string{"/v1/key/create/*"}, []string{"/v1/key/create/root-*"}),
+			"new":     mustNewPolicy("/v1/status"),
+		},
+		Actual: map[string]*Policy{
+			"same":    mustNewPolicy("/v1/key/delete/*", "/v1/key/create/*"),
+			"changed": mustNewPolicy("/v1/key/create/*"),
+			"old":     mustNewPolicy("/v1/status"),
+		},
+		Create: []string{"new"},
+		Update: []string{"changed"},
+		Delete: []string{"old"},
+	},
+}
+
+func TestDiffPolicies(t *testing.T) {
+	names := func(changes []PolicyChange) []string {
+		var names []string
+		for _, change := range changes {
+			names = append(names, change.Name)
+		}
+		return names
+	}
+	for i, test := range diffPoliciesTests {
+		diff := DiffPolicies(test.Desired, test.Actual)
+		if create := names(diff.Create); !reflect.DeepEqual(create, test.Create) {
+			t.Fatalf("Test %d: invalid policies to create: got %v - want %v", i, create, test.Create)
+		}
+		if update := names(diff.Update); !reflect.DeepEqual(update, test.Update) {
+			t.Fatalf("Test %d: invalid policies to update: got %v - want %v", i, update, test.Update)
+		}
+		if !reflect.DeepEqual(diff.Delete, test.Delete) {
+			t.Fatalf("Test %d: invalid policies to delete: got %v - want %v", i, diff.Delete, test.Delete)
+		}
+		if isEmpty := len(test.Create)+len(test.Update)+len(test.Delete) == 0; diff.IsEmpty() != isEmpty {
+			t.Fatalf("Test %d: got IsEmpty %v - want %v", i, diff.IsEmpty(), isEmpty)
+		}
+		for _, change := range append(diff.Create, diff.Update...) {
+			if change.Policy != test.Desired[change.Name] {
+				t.Fatalf("Test %d: policy %q does not refer to the desired policy", i, change.Name)
+			}
+		}
+	}
+}
+
+func TestApplyPolicyDiff(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.URL.Path == "/v1/policy/delete/forbidden" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `{"message":"prohibited by policy"}`)
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	diff := PolicyDiff{
+		Create: []PolicyChange{{Name: "a", Policy: mustNewPolicy("/v1/status")}},
+		Update: []PolicyChange{{Name: "b", Policy: mustNewPolicy("/v1/status")}},
+		Delete: []string{"c", "forbidden", "d"},
+	}
+	err := ApplyPolicyDiff(context.Background(), client, diff)
+
+	want := []string{
+		"POST /v1/policy/write/a",
+		"POST /v1/policy/write/b",
+		"DELETE /v1/policy/delete/c",
+		"DELETE /v1/policy/delete/forbidden",
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Fatalf("Invalid requests: got %v - want %v", requests, want)
+	}
+
+	var diffErr PolicyDiffError
+	if !errors.As(err, &diffErr) {
+		t.Fatalf("Invalid error: got %v - want %T", err, diffErr)
+	}
+	if diffErr.Op != "delete" || diffErr.Name != "forbidden" || !errors.Is(err, ErrNotAllowed) {
+		t.Fatalf("Invalid error: got %v", err)
+	}
+}
+
 func mustNewPolicy(patterns ...string) *Policy {
 	p, err := NewPolicy(patterns...)
 	if err != nil {
@@ -233,3 +383,11 @@ func mustNewPolicy(patterns ...string) *Policy {
 	}
 	return p
 }
+
+func mustNewPolicyWithDeny(allow, deny []string) *Policy {
+	p := mustNewPolicy(allow...)
+	if err := p.Deny(deny...); err != nil {
+		panic(err)
+	}
+	return p
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+// Package prometheus exposes metrics about KES
+// log streams as Prometheus metrics.
+package prometheus
+
+import (
+	"github.com/minio/kes"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// NewErrorMetrics returns a prometheus.Collector that
+// exposes metrics about the ErrorEvents of s.
+//
+// It drains s in the background and counts the ErrorEvents,
+// labeled by their severity level, as "kes_log_error_events_total".
+// Further, the "kes_log_error_stream_connected" gauge is 1 as long
+// as s produces events and drops to 0 once s stops - e.g. when
+// it gets closed or the connection to the server breaks.
+//
+// The ErrorStream s must not be used directly anymore.
+func NewErrorMetrics(s *kes.ErrorStream) prometheus.Collector {
+	metrics := &errorMetrics{
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "kes",
+			Subsystem: "log",
+			Name:      "error_events_total",
+			Help:      "Number of error events received from the KES server error log.",
+		}, []string{"level"}),
+		connected: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "kes",
+			Subsystem: "log",
+			Name:      "error_stream_connected",
+			Help:      "Indicates whether the KES server error log stream is connected. (1 = connected, 0 = disconnected)",
+		}),
+	}
+	metrics.connected.Set(1)
+	go metrics.drain(s)
+	return metrics
+}
+
+// errorMetrics is a prometheus.Collector
+// that counts the ErrorEvents of a stream.
+type errorMetrics struct {
+	events    *prometheus.CounterVec
+	connected prometheus.Gauge
+}
+
+var _ prometheus.Collector = (*errorMetrics)(nil)
+
+func (m *errorMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.events.Describe(ch)
+	m.connected.Describe(ch)
+}
+
+func (m *errorMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.events.Collect(ch)
+	m.connected.Collect(ch)
+}
+
+// drain counts all ErrorEvents of s until
+// s stops.
+func (m *errorMetrics) drain(s *kes.ErrorStream) {
+	defer m.connected.Set(0)
+
+	for s.Next() {
+		m.events.WithLabelValues(s.Event().Severity().String()).Inc()
+	}
+}
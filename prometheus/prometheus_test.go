@@ -0,0 +1,43 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package prometheus
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/kes"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNewErrorMetrics(t *testing.T) {
+	const Events = `{"message":"a","level":"error"}
+{"message":"b","level":"ERROR"}
+{"message":"c","level":"warning"}
+{"message":"d"}`
+
+	collector := NewErrorMetrics(kes.NewErrorStream(strings.NewReader(Events)))
+	metrics := collector.(*errorMetrics)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(metrics.connected) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Stream is still connected after reaching its end")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	const Expected = `
+# HELP kes_log_error_events_total Number of error events received from the KES server error log.
+# TYPE kes_log_error_events_total counter
+kes_log_error_events_total{level=""} 1
+kes_log_error_events_total{level="error"} 2
+kes_log_error_events_total{level="warn"} 1
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(Expected), "kes_log_error_events_total"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RetryOption is a functional option that customizes
+// how a log subscription re-connects to the KES server.
+type RetryOption func(*reconnectConfig)
+
+// WithMaxRetries limits the number of consecutive
+// re-connect attempts. Once n attempts have failed
+// the stream stops with the last error.
+//
+// If n <= 0, there is no limit.
+func WithMaxRetries(n int) RetryOption {
+	return func(config *reconnectConfig) { config.MaxRetries = n }
+}
+
+// WithBackoff sets the delay before the first re-connect
+// attempt. The delay doubles on every failed attempt
+// until it reaches max.
+func WithBackoff(min, max time.Duration) RetryOption {
+	return func(config *reconnectConfig) {
+		config.MinDelay = min
+		config.MaxDelay = max
+	}
+}
+
+// WithReconnectHook sets a function that gets called
+// before each re-connect attempt with the attempt number,
+// starting at 1, and the error that caused it.
+func WithReconnectHook(f func(attempt int, err error)) RetryOption {
+	return func(config *reconnectConfig) { config.Hook = f }
+}
+
+// WithReconnectClock sets the Clock used to wait before
+// re-connect attempts and to record when a connection broke.
+// By default, the wall clock is used. See: Clock.
+func WithReconnectClock(c Clock) RetryOption {
+	return func(config *reconnectConfig) { config.Clock = c }
+}
+
+// reconnectConfig holds the re-connect configuration
+// set by RetryOptions.
+type reconnectConfig struct {
+	MaxRetries int
+	MinDelay   time.Duration
+	MaxDelay   time.Duration
+	Hook       func(int, error)
+	Clock      Clock
+}
+
+// newReconnectConfig returns a reconnectConfig with
+// all options applied.
+func newReconnectConfig(options []RetryOption) reconnectConfig {
+	const (
+		DefaultMinDelay = 500 * time.Millisecond
+		DefaultMaxDelay = 30 * time.Second
+	)
+	config := reconnectConfig{
+		MinDelay: DefaultMinDelay,
+		MaxDelay: DefaultMaxDelay,
+	}
+	for _, option := range options {
+		option(&config)
+	}
+	if config.MinDelay <= 0 {
+		config.MinDelay = DefaultMinDelay
+	}
+	if config.MaxDelay < config.MinDelay {
+		config.MaxDelay = config.MinDelay
+	}
+	config.Clock = clockOrDefault(config.Clock)
+	return config
+}
+
+// delay returns the randomized exponential backoff
+// delay for the n-th re-connect attempt.
+func (c *reconnectConfig) delay(n int) time.Duration {
+	return ExponentialBackoff(c.MinDelay, c.MaxDelay)(n)
+}
+
+// reconnectReader is an io.ReadCloser that re-connects
+// to a log stream whenever reading from the current
+// connection fails.
+//
+// It only returns complete lines from a connection.
+// If a connection breaks while reading a line, the
+// partial line gets discarded. Therefore, a line of a
+// broken connection never gets mixed with the data of
+// the next connection.
+type reconnectReader struct {
+	ctx     context.Context
+	connect func(context.Context) (io.ReadCloser, error)
+	config  reconnectConfig
+
+	lock   sync.Mutex
+	body   io.ReadCloser
+	closed bool
+	done   chan struct{}
+
+	gapStart time.Time // when the most recent connection broke
+	gapEnd   time.Time // when the connection has been re-established
+
+	reader  *bufio.Reader
+	pending []byte // the remaining bytes of the current line
+}
+
+var _ io.ReadCloser = (*reconnectReader)(nil)
+
+// newReconnectReader returns a new reconnectReader that
+// uses the connect function to establish a connection.
+// The first connection is established on the first Read.
+func newReconnectReader(ctx context.Context, connect func(context.Context) (io.ReadCloser, error), options []RetryOption) *reconnectReader {
+	return &reconnectReader{
+		ctx:     ctx,
+		connect: connect,
+		config:  newReconnectConfig(options),
+		done:    make(chan struct{}),
+	}
+}
+
+func (r *reconnectReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for len(r.pending) == 0 {
+		if r.reader == nil {
+			if err := r.reconnect(nil); err != nil {
+				return 0, err
+			}
+		}
+
+		line, err := r.reader.ReadBytes('\n')
+		if err == nil {
+			r.pending = line
+			break
+		}
+		if err = r.reconnect(err); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// Close closes the current connection, if any, and
+// stops any further re-connect attempt.
+func (r *reconnectReader) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	close(r.done)
+	if r.body != nil {
+		return r.body.Close()
+	}
+	return nil
+}
+
+// reconnect closes the current connection, if any, and
+// tries to establish a new one. The cause is the error that
+// broke the current connection. It is nil when establishing
+// the first connection.
+//
+// reconnect retries with an exponential backoff until it
+// succeeds, the reader gets closed, the context is canceled
+// or the maximum number of retries has been reached.
+func (r *reconnectReader) reconnect(cause error) error {
+	r.lock.Lock()
+	if r.body != nil {
+		r.body.Close()
+		r.body, r.reader = nil, nil
+	}
+	if cause != nil {
+		r.gapStart, r.gapEnd = r.config.Clock.Now(), time.Time{}
+	}
+	r.lock.Unlock()
+
+	for retries := 0; ; {
+		if err := r.ctx.Err(); err != nil {
+			return err // Don't re-connect once the ctx is canceled
+		}
+		if r.isClosed() {
+			return ErrStreamClosed
+		}
+		if cause != nil {
+			if r.config.MaxRetries > 0 && retries >= r.config.MaxRetries {
+				return cause
+			}
+			retries++
+			if r.config.Hook != nil {
+				r.config.Hook(retries, cause)
+			}
+
+			timer := r.config.Clock.NewTimer(r.config.delay(retries))
+			select {
+			case <-r.ctx.Done():
+				timer.Stop()
+				return r.ctx.Err()
+			case <-r.done:
+				timer.Stop()
+				return ErrStreamClosed
+			case <-timer.C():
+			}
+		}
+
+		body, err := r.connect(r.ctx)
+		if err != nil {
+			if !isRetryable(err) {
+				return err
+			}
+			cause = err
+			continue
+		}
+
+		r.lock.Lock()
+		if r.closed {
+			r.lock.Unlock()
+			body.Close()
+			return ErrStreamClosed
+		}
+		r.body, r.reader = body, bufio.NewReader(body)
+		if !r.gapStart.IsZero() {
+			r.gapEnd = r.config.Clock.Now()
+		}
+		r.lock.Unlock()
+		return nil
+	}
+}
+
+// lastGap returns the time when the most recent
+// connection broke and when a new connection has
+// been established. It returns false if no connection
+// has broken so far.
+func (r *reconnectReader) lastGap() (start, end time.Time, ok bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.gapStart, r.gapEnd, !r.gapStart.IsZero()
+}
+
+func (r *reconnectReader) isClosed() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// isRetryable returns true if a log subscription
+// that failed with err should be retried.
+//
+// A subscription that has been rejected by the
+// server - e.g. because the client is not allowed
+// to subscribe - should not be retried unless the
+// server is temporarily unavailable.
+func isRetryable(err error) bool {
+	var kesErr Error
+	if errors.As(err, &kesErr) {
+		return kesErr.Status() == http.StatusServiceUnavailable
+	}
+	return true
+}
@@ -0,0 +1,169 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// brokenReader returns its content and then fails
+// with the given error - i.e. simulates a broken
+// connection.
+type brokenReader struct {
+	io.Reader
+	Err error
+}
+
+func (r *brokenReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		err = r.Err
+	}
+	return n, err
+}
+
+var errConnectionReset = errors.New("connection reset")
+
+var reconnectReaderTests = []struct {
+	Connections []string // Each connection breaks once its content has been read
+	ConnectErrs []error
+	MaxRetries  int
+	Messages    []string
+	Retries     int
+	Err         error
+}{
+	{ // 0
+		Connections: []string{
+			`{"message":"a"}` + "\n" + `{"message":`,
+			`{"message":"b"}` + "\n",
+		},
+		ConnectErrs: []error{nil, nil, ErrNotAllowed},
+		Messages:    []string{"a", "b"},
+		Retries:     2,
+		Err:         ErrNotAllowed,
+	},
+	{ // 1
+		Connections: []string{
+			`{"message":"a"}` + "\n",
+		},
+		ConnectErrs: []error{nil, errConnectionReset, errConnectionReset, errConnectionReset},
+		MaxRetries:  2,
+		Messages:    []string{"a"},
+		Retries:     2,
+		Err:         errConnectionReset,
+	},
+	{ // 2
+		Connections: []string{
+			`{"message":"a"}` + "\n",
+			`{"message":"b"}` + "\n",
+		},
+		ConnectErrs: []error{nil, NewError(http.StatusServiceUnavailable, ""), nil, ErrNotAllowed},
+		Messages:    []string{"a", "b"},
+		Retries:     3,
+		Err:         ErrNotAllowed,
+	},
+}
+
+func TestReconnectReader(t *testing.T) {
+	for i, test := range reconnectReaderTests {
+		var (
+			connections = test.Connections
+			connectErrs = test.ConnectErrs
+		)
+		connect := func(context.Context) (io.ReadCloser, error) {
+			if len(connectErrs) == 0 {
+				t.Fatalf("Test %d: too many connection attempts", i)
+			}
+			err := connectErrs[0]
+			connectErrs = connectErrs[1:]
+			if err != nil {
+				return nil, err
+			}
+			conn := connections[0]
+			connections = connections[1:]
+			return ioutil.NopCloser(&brokenReader{Reader: strings.NewReader(conn), Err: errConnectionReset}), nil
+		}
+
+		var retries int
+		stream := NewErrorStream(newReconnectReader(context.Background(), connect, []RetryOption{
+			WithMaxRetries(test.MaxRetries),
+			WithBackoff(time.Millisecond, 2*time.Millisecond),
+			WithReconnectHook(func(int, error) { retries++ }),
+		}))
+
+		var messages []string
+		for stream.Next() {
+			messages = append(messages, stream.Event().Message)
+		}
+		if err := stream.Err(); err != test.Err {
+			t.Fatalf("Test %d: got error %v - want error %v", i, err, test.Err)
+		}
+		if retries != test.Retries {
+			t.Fatalf("Test %d: got %d retries - want %d", i, retries, test.Retries)
+		}
+		if len(messages) != len(test.Messages) {
+			t.Fatalf("Test %d: got %d events - want %d", i, len(messages), len(test.Messages))
+		}
+		for j := range messages {
+			if messages[j] != test.Messages[j] {
+				t.Fatalf("Test %d: got message '%s' - want '%s'", i, messages[j], test.Messages[j])
+			}
+		}
+	}
+}
+
+func TestErrorStreamLastGap(t *testing.T) {
+	if _, _, missed := NewErrorStream(strings.NewReader(`{"message":"a"}`)).LastGap(); missed {
+		t.Fatal("A stream that does not re-connect reported a gap")
+	}
+
+	connections := []string{`{"message":"a"}` + "\n", `{"message":"b"}` + "\n"}
+	connect := func(context.Context) (io.ReadCloser, error) {
+		if len(connections) == 0 {
+			return nil, ErrNotAllowed
+		}
+		conn := connections[0]
+		connections = connections[1:]
+		return ioutil.NopCloser(&brokenReader{Reader: strings.NewReader(conn), Err: errConnectionReset}), nil
+	}
+	stream := NewErrorStream(newReconnectReader(context.Background(), connect, []RetryOption{
+		WithBackoff(10*time.Millisecond, 10*time.Millisecond),
+	}))
+
+	if !stream.Next() {
+		t.Fatalf("Failed to read event: %v", stream.Err())
+	}
+	if _, _, missed := stream.LastGap(); missed {
+		t.Fatal("Stream reported a gap before the connection broke")
+	}
+
+	before := time.Now()
+	if !stream.Next() {
+		t.Fatalf("Failed to read event: %v", stream.Err())
+	}
+	start, end, missed := stream.LastGap()
+	if !missed {
+		t.Fatal("Stream did not report a gap after re-connecting")
+	}
+	if start.Before(before) || !end.After(start) {
+		t.Fatalf("Invalid gap: start %v - end %v", start, end)
+	}
+
+	// The stream fails to re-connect. Hence,
+	// the gap must not have an end.
+	if stream.Next() {
+		t.Fatal("Stream did not stop")
+	}
+	if _, end, missed = stream.LastGap(); !missed || !end.IsZero() {
+		t.Fatalf("Invalid gap: got end %v - missed %v", end, missed)
+	}
+}
@@ -5,6 +5,7 @@
 package kes
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -13,6 +14,8 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -46,6 +49,48 @@ func retryBody(body io.ReadSeeker) io.ReadCloser {
 	}
 }
 
+// BackoffFunc returns how long a Client should wait
+// before retrying a request the n-th time, starting
+// at 1.
+type BackoffFunc func(n int) time.Duration
+
+// ExponentialBackoff returns a BackoffFunc that doubles
+// the delay, starting at min, on every retry until it
+// reaches max. The returned delays are randomized to
+// avoid that many clients retry at the same time.
+func ExponentialBackoff(min, max time.Duration) BackoffFunc {
+	if min <= 0 {
+		min = time.Millisecond
+	}
+	if max < min {
+		max = min
+	}
+	return func(n int) time.Duration {
+		delay := max
+		if n < 32 {
+			if d := min << uint(n-1); d > 0 && d < max {
+				delay = d
+			}
+		}
+		return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+}
+
+// RetryError is the error returned by a Client when
+// a request keeps failing even though it has been
+// retried.
+type RetryError struct {
+	Attempts int   // The number of attempts made
+	Err      error // The error of the last attempt
+}
+
+func (e RetryError) Error() string {
+	return fmt.Sprintf("kes: request failed after %d attempts: %v", e.Attempts, e.Err)
+}
+
+// Unwrap returns the error of the last attempt.
+func (e RetryError) Unwrap() error { return e.Err }
+
 // retry is an http.Client that implements
 // a retry mechanism for requests that fail
 // due to a temporary network error.
@@ -54,7 +99,17 @@ func retryBody(body io.ReadSeeker) io.ReadCloser {
 // but requires that the request body implements io.Seeker.
 // Otherwise, it cannot guarantee that the entire request
 // body gets sent when retrying a request.
-type retry http.Client
+type retry struct {
+	http.Client
+
+	MaxAttempts int           // If <= 0, a request is sent at most 3 times
+	Backoff     BackoffFunc   // If nil, a random delay between 200ms and 1s
+	Balancer    *loadBalancer // If not nil, each attempt is sent to the next endpoint
+	Enclave     string        // If not empty, each request is sent to the enclave
+	Timeout     time.Duration // If > 0, each attempt has to complete within the timeout
+	Hook        RequestHook   // If not nil, called once a request has completed
+	UserAgent   string        // If empty, the default User-Agent is sent
+}
 
 // Get issues a GET to the specified URL.
 // It is a wrapper around retry.Do.
@@ -82,7 +137,57 @@ func (r *retry) Post(url, contentType string, body io.ReadSeeker) (*http.Respons
 // temporary error Do retries the request a few times. If the
 // request keeps failing, Do will give up and return a descriptive
 // error.
+//
+// Do only retries idempotent requests. It never retries requests
+// that create a key since the server may have created the key
+// even though the request failed.
+//
+// If the request has been sent more than once but still fails,
+// Do returns a RetryError. Do stops retrying once the request
+// context is canceled.
+//
+// If the retry has a request hook, Do calls it once the
+// request has completed - i.e. after the last attempt.
 func (r *retry) Do(req *http.Request) (*http.Response, error) {
+	if r.Hook == nil {
+		return r.do(req)
+	}
+
+	start := time.Now()
+	resp, err := r.do(req)
+	info := RequestInfo{
+		Method:   req.Method,
+		Path:     req.URL.Path,
+		Duration: time.Since(start),
+		Err:      err,
+	}
+	if resp != nil {
+		info.StatusCode = resp.StatusCode
+	}
+	callHook(req.Context(), r.Hook, info)
+	return resp, err
+}
+
+// validHeaderValue reports whether v is a valid HTTP
+// header value - i.e. does not contain any control
+// characters except for horizontal tabs.
+func validHeaderValue(v string) bool {
+	for i := 0; i < len(v); i++ {
+		if c := v[i]; (c < ' ' && c != '\t') || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// callHook calls the hook and recovers from any panic
+// such that a faulty hook cannot crash the request path.
+func callHook(ctx context.Context, hook RequestHook, info RequestInfo) {
+	defer func() { recover() }()
+	hook(ctx, info)
+}
+
+func (r *retry) do(req *http.Request) (*http.Response, error) {
 	type RetryReader interface {
 		io.Reader
 		io.Seeker
@@ -110,19 +215,86 @@ func (r *retry) Do(req *http.Request) (*http.Response, error) {
 		}
 	}
 
-	const (
-		MinRetryDelay     = 200 * time.Millisecond
-		MaxRandRetryDelay = 800
-	)
+	userAgent := r.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	if !validHeaderValue(userAgent) {
+		return nil, fmt.Errorf("kes: invalid User-Agent %q", userAgent)
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	if r.Enclave != "" {
+		query := req.URL.Query()
+		query.Set("enclave", r.Enclave)
+		req.URL.RawQuery = query.Encode()
+	}
+
+	maxAttempts := r.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 3 // For now, we retry 2 times before we give up
+	}
+	backoff := r.Backoff
+	if backoff == nil {
+		const (
+			MinRetryDelay     = 200 * time.Millisecond
+			MaxRandRetryDelay = 800
+		)
+		backoff = func(int) time.Duration {
+			return MinRetryDelay + time.Duration(rand.Intn(MaxRandRetryDelay))*time.Millisecond
+		}
+	}
+
 	var (
-		retry  = 2 // For now, we retry 2 times before we give up
-		client = (*http.Client)(r)
+		resp     *http.Response
+		err      error
+		attempts int
 	)
-	resp, err := client.Do(req)
-	for retry > 0 && (isTemporary(err) || (resp != nil && resp.StatusCode == http.StatusServiceUnavailable)) {
-		randomRetryDelay := time.Duration(rand.Intn(MaxRandRetryDelay)) * time.Millisecond
-		time.Sleep(MinRetryDelay + randomRetryDelay)
-		retry--
+	for {
+		if r.Balancer != nil {
+			endpoint := r.Balancer.Next()
+			if err = setEndpoint(req, endpoint); err != nil {
+				return nil, err
+			}
+			resp, err = r.send(req)
+			if req.Context().Err() == nil {
+				r.Balancer.Report(endpoint, err)
+			}
+		} else {
+			resp, err = r.send(req)
+		}
+		attempts++
+
+		if attempts >= maxAttempts || !r.shouldRetry(req, resp, err) {
+			break
+		}
+
+		// If the server told us when to retry, we wait as long
+		// as requested - unless the request context expires
+		// before. Then, we give up immediately.
+		delay := backoff(attempts)
+		if retryAfter := parseRetryAfter(resp); retryAfter > 0 {
+			if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline) < retryAfter {
+				break
+			}
+			delay = retryAfter
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		// If the request failed because the client could not
+		// connect to an endpoint, we retry immediately. The next
+		// attempt will be sent to another endpoint.
+		if r.Balancer == nil || err == nil {
+			timer := time.NewTimer(delay)
+			select {
+			case <-req.Context().Done():
+				timer.Stop()
+				return nil, RetryError{Attempts: attempts, Err: req.Context().Err()}
+			case <-timer.C:
+			}
+		}
 
 		// If there is a body we have to reset it. Otherwise, we may send
 		// only partial data to the server when we retry the request.
@@ -132,22 +304,146 @@ func (r *retry) Do(req *http.Request) (*http.Response, error) {
 			}
 			req.Body = body
 		}
-
-		resp, err = client.Do(req) // Now, retry.
 	}
 	if isTemporary(err) {
 		// If the request still fails with a temporary error
 		// we wrap the error to provide more information to the
 		// caller.
-		return nil, &url.Error{
+		err = &url.Error{
 			Op:  req.Method,
 			URL: req.URL.String(),
 			Err: fmt.Errorf("Temporary network error: %v", err),
 		}
 	}
+	if attempts > 1 {
+		if err != nil {
+			return nil, RetryError{Attempts: attempts, Err: err}
+		}
+		if resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusTooManyRequests {
+			return nil, RetryError{Attempts: attempts, Err: parseErrorResponse(resp)}
+		}
+	}
 	return resp, err
 }
 
+// send sends the request once. If the retry has a timeout,
+// the request - including reading the response body - has
+// to complete before the timeout expires. The timeout does
+// not apply to requests for a log stream since these are
+// long-running by design.
+func (r *retry) send(req *http.Request) (*http.Response, error) {
+	if r.Timeout <= 0 {
+		return r.Client.Do(req)
+	}
+	if api, _, _ := parseAPI(req.URL.Path); api == AuditLogTrace || api == ErrorLogTrace {
+		return r.Client.Do(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), r.Timeout)
+	resp, err := r.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody is a response body that cancels
+// its request context once it gets closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// shouldRetry returns true if the request should be sent
+// again after it failed with the given response or error.
+func (r *retry) shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	if !isIdempotent(req) {
+		// A non-idempotent request must not be sent twice.
+		// However, if it could not be sent to the current
+		// endpoint, we can send it to another one.
+		return r.Balancer != nil && isDialError(err)
+	}
+	if r.Balancer != nil && err != nil {
+		return true
+	}
+	if resp != nil {
+		switch resp.StatusCode {
+		case http.StatusServiceUnavailable, http.StatusTooManyRequests:
+			return true
+		}
+	}
+	return isTemporary(err)
+}
+
+// parseRetryAfter returns the delay requested by
+// the server via the Retry-After header of a 429
+// or 503 response. The header value may either be
+// a number of seconds or an HTTP date.
+//
+// If there is no such response or the header value
+// is not valid, parseRetryAfter returns 0.
+func parseRetryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable && resp.StatusCode != http.StatusTooManyRequests {
+		return 0
+	}
+
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// setEndpoint replaces the scheme and host of
+// the request URL with the ones of the endpoint.
+func setEndpoint(req *http.Request, endpoint string) error {
+	u, err := url.Parse(strings.TrimSpace(endpoint))
+	if err != nil {
+		return err
+	}
+	req.URL.Scheme, req.URL.Host = u.Scheme, u.Host
+	req.Host = ""
+	return nil
+}
+
+// isIdempotent returns true if sending the request
+// more than once has the same effect as sending it
+// once.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	// Only POST requests that do not create a key are
+	// idempotent. For example, decrypting a ciphertext
+	// twice does not change the server state.
+	api, _, ok := parseAPI(req.URL.Path)
+	return ok && api != KeyCreate && api != KeyImport
+}
+
 // isTemporary returns true if the given error is
 // temporary - e.g. a temporary *url.Error or an
 // net.Error that indicates that a request got
@@ -6,10 +6,15 @@ package kes
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 )
 
 var retryBodyTests = []struct {
@@ -69,3 +74,244 @@ func TestIsTemporary(t *testing.T) {
 		}
 	}
 }
+
+var retryTests = []struct {
+	Method      string
+	Path        string
+	MaxAttempts int
+	Failures    int // Number of requests that fail with 503 before one succeeds
+	Attempts    int // Number of requests the server should receive
+	Err         bool
+}{
+	{Method: http.MethodGet, Path: "/v1/key/list/*", MaxAttempts: 0, Failures: 0, Attempts: 1},                      // 0
+	{Method: http.MethodGet, Path: "/v1/key/list/*", MaxAttempts: 0, Failures: 2, Attempts: 3},                      // 1
+	{Method: http.MethodGet, Path: "/v1/key/list/*", MaxAttempts: 0, Failures: 3, Attempts: 3, Err: true},           // 2
+	{Method: http.MethodGet, Path: "/v1/key/list/*", MaxAttempts: 5, Failures: 4, Attempts: 5},                      // 3
+	{Method: http.MethodPost, Path: "/v1/key/decrypt/my-key", MaxAttempts: 5, Failures: 1, Attempts: 2},             // 4
+	{Method: http.MethodPost, Path: "/v1/key/create/my-key", MaxAttempts: 5, Failures: 1, Attempts: 1, Err: true},   // 5
+	{Method: http.MethodPost, Path: "/v1/key/import/my-key", MaxAttempts: 5, Failures: 1, Attempts: 1, Err: true},   // 6
+	{Method: http.MethodDelete, Path: "/v1/key/delete/my-key", MaxAttempts: 1, Failures: 1, Attempts: 1, Err: true}, // 7
+}
+
+func TestRetry(t *testing.T) {
+	for i, test := range retryTests {
+		var requests int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests <= test.Failures {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+
+		client := &retry{
+			Client:      *server.Client(),
+			MaxAttempts: test.MaxAttempts,
+			Backoff:     func(int) time.Duration { return time.Millisecond },
+		}
+		req, err := http.NewRequest(test.Method, server.URL+test.Path, retryBody(nil))
+		if err != nil {
+			t.Fatalf("Test %d: failed to create request: %v", i, err)
+		}
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				err = parseErrorResponse(resp)
+			}
+		}
+		server.Close()
+
+		if test.Err && err == nil {
+			t.Fatalf("Test %d: request should have failed", i)
+		}
+		if !test.Err && err != nil {
+			t.Fatalf("Test %d: request failed: %v", i, err)
+		}
+		if requests != test.Attempts {
+			t.Fatalf("Test %d: got %d requests - want %d", i, requests, test.Attempts)
+		}
+		if retryErr, ok := err.(RetryError); ok && retryErr.Attempts != test.Attempts {
+			t.Fatalf("Test %d: got %d attempts - want %d", i, retryErr.Attempts, test.Attempts)
+		}
+		if test.Err && test.Attempts > 1 {
+			if _, ok := err.(RetryError); !ok {
+				t.Fatalf("Test %d: got error %T - want %T", i, err, RetryError{})
+			}
+		}
+	}
+}
+
+func TestRetryContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := &retry{
+		Client:      *server.Client(),
+		MaxAttempts: 100,
+		Backoff:     func(int) time.Duration { return time.Hour },
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/v1/key/list/*", retryBody(nil))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	if _, err = client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Invalid error: got %v - want %v", err, context.DeadlineExceeded)
+	}
+}
+
+var retryTimeoutTests = []struct {
+	Timeout time.Duration
+	Path    string
+	Err     bool
+}{
+	{Timeout: 0, Path: "/v1/key/list/*", Err: false},                          // 0
+	{Timeout: 10 * time.Millisecond, Path: "/v1/key/list/*", Err: true},       // 1
+	{Timeout: 10 * time.Second, Path: "/v1/key/list/*", Err: false},           // 2
+	{Timeout: 10 * time.Millisecond, Path: "/v1/log/audit/trace", Err: false}, // 3
+}
+
+func TestRetryTimeout(t *testing.T) {
+	const serverDelay = 100 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(serverDelay)
+	}))
+	defer server.Close()
+
+	for i, test := range retryTimeoutTests {
+		client := &retry{
+			Client:      *server.Client(),
+			MaxAttempts: 2,
+			Backoff:     func(int) time.Duration { return time.Millisecond },
+			Timeout:     test.Timeout,
+		}
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL+test.Path, retryBody(nil))
+		if err != nil {
+			t.Fatalf("Test %d: failed to create request: %v", i, err)
+		}
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if test.Err && err == nil {
+			t.Fatalf("Test %d: request should have failed", i)
+		}
+		if !test.Err && err != nil {
+			t.Fatalf("Test %d: request failed: %v", i, err)
+		}
+		if test.Err && time.Since(start) >= 2*serverDelay {
+			t.Fatalf("Test %d: request did not time out: took %v", i, time.Since(start))
+		}
+	}
+}
+
+var retryAfterTests = []struct {
+	Status     int
+	RetryAfter string
+	Timeout    time.Duration
+	Attempts   int
+	Delay      time.Duration
+}{
+	{Status: http.StatusTooManyRequests, RetryAfter: "", Attempts: 2},                               // 0
+	{Status: http.StatusTooManyRequests, RetryAfter: "1", Attempts: 2, Delay: time.Second},          // 1
+	{Status: http.StatusServiceUnavailable, RetryAfter: "1", Attempts: 2, Delay: time.Second},       // 2
+	{Status: http.StatusTooManyRequests, RetryAfter: "3600", Timeout: 5 * time.Second, Attempts: 1}, // 3
+	{Status: http.StatusTooManyRequests, RetryAfter: "invalid", Attempts: 2},                        // 4
+	{Status: http.StatusTooManyRequests, RetryAfter: "Mon, 02 Jan 2006 15:04:05 GMT", Attempts: 2},  // 5
+}
+
+func TestRetryAfter(t *testing.T) {
+	for i, test := range retryAfterTests {
+		var requests int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests == 1 {
+				if test.RetryAfter != "" {
+					w.Header().Set("Retry-After", test.RetryAfter)
+				}
+				w.WriteHeader(test.Status)
+			}
+		}))
+
+		client := &retry{
+			Client:      *server.Client(),
+			MaxAttempts: 2,
+			Backoff:     func(int) time.Duration { return time.Millisecond },
+		}
+		ctx := context.Background()
+		if test.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, test.Timeout)
+			defer cancel()
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/v1/key/list/*", retryBody(nil))
+		if err != nil {
+			t.Fatalf("Test %d: failed to create request: %v", i, err)
+		}
+
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Test %d: request failed: %v", i, err)
+		}
+		resp.Body.Close()
+		server.Close()
+
+		if requests != test.Attempts {
+			t.Fatalf("Test %d: got %d requests - want %d", i, requests, test.Attempts)
+		}
+		if d := time.Since(start); d < test.Delay {
+			t.Fatalf("Test %d: client retried after %v - want at least %v", i, d, test.Delay)
+		}
+	}
+}
+
+func TestTooManyRequestsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"message":"too many requests"}`))
+	}))
+	defer server.Close()
+
+	client := &retry{
+		Client:      *server.Client(),
+		MaxAttempts: 1,
+	}
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/v1/key/list/*", retryBody(nil))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+
+	var tooManyRequests TooManyRequestsError
+	if err = parseErrorResponse(resp); !errors.As(err, &tooManyRequests) {
+		t.Fatalf("Invalid error: got %T - want %T", err, tooManyRequests)
+	}
+	if tooManyRequests.Status() != http.StatusTooManyRequests {
+		t.Fatalf("Invalid status code: got %d - want %d", tooManyRequests.Status(), http.StatusTooManyRequests)
+	}
+	if tooManyRequests.Message != "too many requests" {
+		t.Fatalf("Invalid error message: got %q - want %q", tooManyRequests.Message, "too many requests")
+	}
+	if tooManyRequests.RetryAfter != 30*time.Second {
+		t.Fatalf("Invalid Retry-After: got %v - want %v", tooManyRequests.RetryAfter, 30*time.Second)
+	}
+
+	var kesErr Error
+	if !errors.As(err, &kesErr) {
+		t.Fatalf("Invalid error: got %T - want %T", err, kesErr)
+	}
+	if kesErr != NewError(http.StatusTooManyRequests, "too many requests") {
+		t.Fatalf("Invalid error: got %v - want %v", kesErr, NewError(http.StatusTooManyRequests, "too many requests"))
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package kes
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Pipe reads all ErrorEvents of s and logs each one
+// as slog.Record to the given logger. It returns once
+// s stops or the ctx.Done() channel completes.
+//
+// The record has the event message. Its level is the
+// event severity, or slog.LevelError if the event has
+// no severity level. Its time is the event time, or the
+// time when the event has been received if the event
+// has no time.
+//
+// Pipe returns the error that stopped s, if any, or
+// the first error returned by the logger's slog.Handler.
+func (s *ErrorStream) Pipe(ctx context.Context, logger *slog.Logger) error {
+	handler := logger.Handler()
+	for s.NextContext(ctx) {
+		event := s.Event()
+
+		var level slog.Level
+		switch event.Severity() {
+		case LevelInfo:
+			level = slog.LevelInfo
+		case LevelWarn:
+			level = slog.LevelWarn
+		default:
+			level = slog.LevelError
+		}
+		if !handler.Enabled(ctx, level) {
+			continue
+		}
+
+		t := event.Time
+		if !event.HasTime() {
+			t = time.Now()
+		}
+		if err := handler.Handle(ctx, slog.NewRecord(t, level, event.Message, 0)); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
@@ -0,0 +1,43 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package kes
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestErrorStreamPipe(t *testing.T) {
+	const Events = `{"message":"a","level":"info","time":"2021-03-24T12:37:33Z"}
+{"message":"b","level":"warning","time":"2021-03-24T12:37:34Z"}
+{"message":"c","time":"2021-03-24T12:37:35Z"}`
+
+	const Output = `{"time":"2021-03-24T12:37:34Z","level":"WARN","msg":"b"}
+{"time":"2021-03-24T12:37:35Z","level":"ERROR","msg":"c"}
+`
+
+	var sb strings.Builder
+	logger := slog.New(slog.NewJSONHandler(&sb, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	stream := NewErrorStream(strings.NewReader(Events))
+	if err := stream.Pipe(context.Background(), logger); err != nil {
+		t.Fatalf("Failed to pipe error events: %v", err)
+	}
+	if output := sb.String(); output != Output {
+		t.Fatalf("Invalid output: got %s - want %s", output, Output)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stream = NewErrorStream(strings.NewReader(Events))
+	if err := stream.Pipe(ctx, logger); err != context.Canceled {
+		t.Fatalf("Invalid error: got %v - want %v", err, context.Canceled)
+	}
+}
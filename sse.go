@@ -0,0 +1,99 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+)
+
+// SSEEnvelope is the JSON envelope that contains an
+// encrypted data encryption key (DEK) of a MinIO SSE-KMS
+// encrypted object. It has the following layout:
+//   {
+//     "key_id":     "my-key",
+//     "ciphertext": "<base64-encoded DEK ciphertext>",
+//     "context":    { "my-bucket": "my-bucket/my-object" }
+//   }
+//
+// The context is optional. If present, it is a JSON object
+// of strings that has been used as associated data when the
+// DEK has been generated.
+type SSEEnvelope struct {
+	KeyID      string            // The name of the KES key that encrypted the DEK
+	Ciphertext []byte            // The DEK ciphertext
+	Context    map[string]string // The encryption context, if any
+}
+
+// ParseSSEEnvelope parses the given blob as SSEEnvelope.
+//
+// Fields other than the key_id, ciphertext and context
+// are ignored such that envelopes produced by newer MinIO
+// versions can be parsed as well.
+//
+// It returns an SSEEnvelopeError if the blob is not a
+// well-formed envelope.
+func ParseSSEEnvelope(blob []byte) (*SSEEnvelope, error) {
+	type Envelope struct {
+		KeyID      string            `json:"key_id"`
+		Ciphertext []byte            `json:"ciphertext"`
+		Context    map[string]string `json:"context"`
+	}
+	var envelope Envelope
+	if err := json.Unmarshal(blob, &envelope); err != nil {
+		return nil, SSEEnvelopeError{Reason: "invalid JSON", Err: err}
+	}
+	if envelope.KeyID == "" {
+		return nil, SSEEnvelopeError{Reason: "missing key_id"}
+	}
+	if len(envelope.Ciphertext) == 0 {
+		return nil, SSEEnvelopeError{Reason: "missing ciphertext"}
+	}
+	return &SSEEnvelope{
+		KeyID:      envelope.KeyID,
+		Ciphertext: envelope.Ciphertext,
+		Context:    envelope.Context,
+	}, nil
+}
+
+// AssociatedData returns the envelope's context as it
+// has been passed to the KES server when the DEK has been
+// generated. It returns nil if the envelope has no context.
+//
+// The context is encoded as JSON object with sorted keys.
+// Characters like '<', '>' and '&' are not escaped since
+// MinIO does not escape them either.
+func (e *SSEEnvelope) AssociatedData() ([]byte, error) {
+	if len(e.Context) == 0 {
+		return nil, nil
+	}
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(e.Context); err != nil { // Maps are encoded with sorted keys
+		return nil, err
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte{'\n'}), nil
+}
+
+// DecryptSSE parses the blob as SSEEnvelope and decrypts
+// the DEK ciphertext with the envelope's key and context.
+// It returns the plaintext DEK on success.
+//
+// It returns an SSEEnvelopeError if the blob is not a
+// well-formed envelope and ErrDecrypt if the ciphertext
+// is not authentic.
+func (c *Client) DecryptSSE(ctx context.Context, blob []byte) ([]byte, error) {
+	envelope, err := ParseSSEEnvelope(blob)
+	if err != nil {
+		return nil, err
+	}
+	associatedData, err := envelope.AssociatedData()
+	if err != nil {
+		return nil, err
+	}
+	return c.decrypt(ctx, envelope.KeyID, envelope.Ciphertext, associatedData)
+}
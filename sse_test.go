@@ -0,0 +1,105 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var parseSSEEnvelopeTests = []struct {
+	Blob           string
+	KeyID          string
+	AssociatedData string
+	ShouldFail     bool
+}{
+	{Blob: `{"key_id":"my-key","ciphertext":"AAECAw=="}`, KeyID: "my-key"},                                                                                    // 0
+	{Blob: `{"key_id":"my-key","ciphertext":"AAECAw==","context":{"bucket":"bucket/object"}}`, KeyID: "my-key", AssociatedData: `{"bucket":"bucket/object"}`}, // 1
+	{Blob: `{"key_id":"my-key","ciphertext":"AAECAw==","context":{"b":"2","a":"1"}}`, KeyID: "my-key", AssociatedData: `{"a":"1","b":"2"}`},                   // 2
+	{Blob: `{"key_id":"my-key","ciphertext":"AAECAw==","context":{}}`, KeyID: "my-key"},                                                                       // 3
+	{Blob: `{"key_id":"my-key","ciphertext":"AAECAw==","context":{"bucket":"bucket/a&b<c>"}}`, KeyID: "my-key", AssociatedData: `{"bucket":"bucket/a&b<c>"}`}, // 4
+	{Blob: `{"key_id":"my-key","ciphertext":"AAECAw==","kms":"kes","version":2}`, KeyID: "my-key"},                                                            // 5
+
+	{Blob: ``, ShouldFail: true},                                                          // 6
+	{Blob: `{"key_id":"my-key"}`, ShouldFail: true},                                       // 7
+	{Blob: `{"ciphertext":"AAECAw=="}`, ShouldFail: true},                                 // 8
+	{Blob: `{"key_id":"my-key","ciphertext":"not base64"}`, ShouldFail: true},             // 9
+	{Blob: `{"key_id":"my-key","ciphertext":"AAECAw=="} {}`, ShouldFail: true},            // 10
+	{Blob: `{"key_id":"my-key","ciphertext":"AAECAw==","context":[1]}`, ShouldFail: true}, // 11
+}
+
+func TestParseSSEEnvelope(t *testing.T) {
+	for i, test := range parseSSEEnvelopeTests {
+		envelope, err := ParseSSEEnvelope([]byte(test.Blob))
+		if err != nil && !test.ShouldFail {
+			t.Fatalf("Test %d: failed to parse envelope: %v", i, err)
+		}
+		if test.ShouldFail {
+			if _, ok := err.(SSEEnvelopeError); !ok {
+				t.Fatalf("Test %d: invalid error: got %v - want %T", i, err, SSEEnvelopeError{})
+			}
+			continue
+		}
+		if envelope.KeyID != test.KeyID {
+			t.Fatalf("Test %d: invalid key ID: got %q - want %q", i, envelope.KeyID, test.KeyID)
+		}
+		if !bytes.Equal(envelope.Ciphertext, []byte{0, 1, 2, 3}) {
+			t.Fatalf("Test %d: invalid ciphertext: got %x - want %x", i, envelope.Ciphertext, []byte{0, 1, 2, 3})
+		}
+		associatedData, err := envelope.AssociatedData()
+		if err != nil {
+			t.Fatalf("Test %d: failed to encode associated data: %v", i, err)
+		}
+		if string(associatedData) != test.AssociatedData {
+			t.Fatalf("Test %d: invalid associated data: got %q - want %q", i, associatedData, test.AssociatedData)
+		}
+	}
+}
+
+func TestDecryptSSE(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Ciphertext []byte `json:"ciphertext"`
+			Context    []byte `json:"context"`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/v1/key/decrypt/my-key" {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"message":"key does not exist"}`)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || string(request.Context) != `{"bucket":"bucket/object"}` {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"message":"ciphertext is not authentic"}`)
+			return
+		}
+		io.WriteString(w, `{"plaintext":"BAUGBw=="}`)
+	}))
+	defer server.Close()
+
+	client := &Client{Endpoint: server.URL, HTTPClient: *server.Client()}
+	plaintext, err := client.DecryptSSE(context.Background(), []byte(`{"key_id":"my-key","ciphertext":"AAECAw==","context":{"bucket":"bucket/object"}}`))
+	if err != nil {
+		t.Fatalf("Failed to decrypt envelope: %v", err)
+	}
+	if !bytes.Equal(plaintext, []byte{4, 5, 6, 7}) {
+		t.Fatalf("Invalid plaintext: got %x - want %x", plaintext, []byte{4, 5, 6, 7})
+	}
+
+	if _, err = client.DecryptSSE(context.Background(), []byte(`{"key_id":"my-key","ciphertext":"AAECAw==","context":{"bucket":"other/object"}}`)); err != ErrDecrypt {
+		t.Fatalf("Invalid error: got %v - want %v", err, ErrDecrypt)
+	}
+	if _, err = client.DecryptSSE(context.Background(), []byte(`{"key_id":"other-key","ciphertext":"AAECAw=="}`)); err != ErrKeyNotFound {
+		t.Fatalf("Invalid error: got %v - want %v", err, ErrKeyNotFound)
+	}
+	if _, err = client.DecryptSSE(context.Background(), []byte(`not json`)); err == nil {
+		t.Fatal("Decrypting a malformed envelope should have failed")
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// AuditStats is a summary of a stream of AuditEvents.
+type AuditStats struct {
+	// Total is the number of AuditEvents.
+	Total uint64
+
+	// Paths contains the number of AuditEvents
+	// per request path.
+	Paths map[string]uint64
+
+	// Identities contains the number of AuditEvents
+	// per client identity.
+	Identities map[string]uint64
+
+	// StatusCodes contains the number of AuditEvents
+	// per response status code.
+	StatusCodes map[int]uint64
+
+	// P50, P95 and P99 are the 50th, 95th and 99th
+	// percentile of the time it took the server to
+	// handle a request. They are zero if there have
+	// been no AuditEvents.
+	P50, P95, P99 time.Duration
+}
+
+// CollectAuditStats drains s and returns a summary of all
+// its AuditEvents. It returns once s reaches its end, the
+// iteration stops due to an error or ctx is canceled.
+//
+// If the iteration stops due to an error, CollectAuditStats
+// returns the summary of all AuditEvents received so far and
+// the error. Then, the error is ctx.Err() if ctx is canceled.
+//
+// CollectAuditStats keeps the response time of each AuditEvent
+// in memory to compute the percentiles.
+func CollectAuditStats(ctx context.Context, s *AuditStream) (*AuditStats, error) {
+	var (
+		stats = &AuditStats{
+			Paths:       map[string]uint64{},
+			Identities:  map[string]uint64{},
+			StatusCodes: map[int]uint64{},
+		}
+		latencies []time.Duration
+	)
+	for s.NextContext(ctx) {
+		event := s.Event()
+
+		stats.Total++
+		stats.Paths[event.Request.Path]++
+		stats.Identities[event.Request.Identity]++
+		stats.StatusCodes[event.Response.StatusCode]++
+		latencies = append(latencies, event.Response.Time)
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	stats.P50 = percentile(latencies, 50)
+	stats.P95 = percentile(latencies, 95)
+	stats.P99 = percentile(latencies, 99)
+	return stats, s.Err()
+}
+
+// percentile returns the p-th percentile of the
+// sorted durations using the nearest-rank method.
+// It returns 0 if there are no durations.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100 // ceil(p/100 * N)
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
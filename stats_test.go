@@ -0,0 +1,81 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectAuditStats(t *testing.T) {
+	const Events = `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key","identity":"a"},"response":{"code":200,"time":1000000}}
+{"time":"2020-03-24T12:38:02Z","request":{"path":"/v1/key/decrypt/my-key","identity":"b"},"response":{"code":403,"time":2000000}}
+{"time":"2020-03-24T12:38:32Z","request":{"path":"/v1/key/decrypt/my-key","identity":"a"},"response":{"code":200,"time":3000000}}
+{"time":"2020-03-24T12:39:02Z","request":{"path":"/v1/key/decrypt/my-key","identity":"a"},"response":{"code":200,"time":4000000}}`
+
+	stats, err := CollectAuditStats(context.Background(), NewAuditStream(strings.NewReader(Events)))
+	if err != nil {
+		t.Fatalf("Failed to collect audit stats: %v", err)
+	}
+	if stats.Total != 4 {
+		t.Fatalf("Invalid total: got %d - want %d", stats.Total, 4)
+	}
+	if n := stats.Paths["/v1/key/decrypt/my-key"]; n != 3 {
+		t.Fatalf("Invalid path count: got %d - want %d", n, 3)
+	}
+	if n := stats.Identities["a"]; n != 3 {
+		t.Fatalf("Invalid identity count: got %d - want %d", n, 3)
+	}
+	if n := stats.StatusCodes[403]; n != 1 {
+		t.Fatalf("Invalid status code count: got %d - want %d", n, 1)
+	}
+	if stats.P50 != 2*time.Millisecond || stats.P95 != 4*time.Millisecond || stats.P99 != 4*time.Millisecond {
+		t.Fatalf("Invalid percentiles: got %v %v %v", stats.P50, stats.P95, stats.P99)
+	}
+}
+
+func TestCollectAuditStatsContext(t *testing.T) {
+	reader, writer := io.Pipe()
+	defer writer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		fmt.Fprintln(writer, `{"time":"2020-03-24T12:37:33Z","request":{"path":"/v1/key/create/my-key","identity":"a"},"response":{"code":200,"time":1000000}}`)
+		cancel()
+	}()
+
+	stats, err := CollectAuditStats(ctx, NewAuditStream(reader))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Invalid error: got %v - want %v", err, context.Canceled)
+	}
+	if stats == nil || stats.Total > 1 {
+		t.Fatalf("Invalid stats: got %+v", stats)
+	}
+}
+
+var percentileTests = []struct {
+	Durations  []time.Duration
+	Percentile int
+	Result     time.Duration
+}{
+	{Durations: nil, Percentile: 50, Result: 0},                                             // 0
+	{Durations: []time.Duration{1}, Percentile: 99, Result: 1},                              // 1
+	{Durations: []time.Duration{1, 2}, Percentile: 50, Result: 1},                           // 2
+	{Durations: []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, Percentile: 95, Result: 10}, // 3
+	{Durations: []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, Percentile: 50, Result: 5},  // 4
+}
+
+func TestPercentile(t *testing.T) {
+	for i, test := range percentileTests {
+		if p := percentile(test.Durations, test.Percentile); p != test.Result {
+			t.Fatalf("Test %d: got %v - want %v", i, p, test.Result)
+		}
+	}
+}
@@ -0,0 +1,741 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrStreamClosed is the error returned by the Err method
+// of an ErrorStream or AuditStream that stopped because
+// it has been closed.
+var ErrStreamClosed = errors.New("kes: stream closed")
+
+// ErrIdleTimeout is the error returned by the Err method
+// of an ErrorStream or AuditStream that stopped because it
+// has not received any event within the idle timeout. See
+// WithIdleTimeout.
+var ErrIdleTimeout = errors.New("kes: stream idle timeout exceeded")
+
+// DefaultMaxEventSize is the default maximum size of
+// a single (JSON-encoded) ErrorEvent or AuditEvent.
+const DefaultMaxEventSize = bufio.MaxScanTokenSize
+
+// StreamOption is a functional option that customizes
+// the behavior of an ErrorStream or AuditStream.
+type StreamOption func(*streamConfig)
+
+// WithMaxEventSize sets the maximum size of a single
+// event. An event that is larger than n bytes stops
+// the stream iteration with bufio.ErrTooLong.
+//
+// If n <= 0, the DefaultMaxEventSize is used.
+func WithMaxEventSize(n int) StreamOption {
+	return func(config *streamConfig) { config.MaxEventSize = n }
+}
+
+// WithBuffer sets the initial buffer that the stream
+// uses to read events and the maximum size of a single
+// event. It behaves like bufio.Scanner.Buffer. Hence,
+// an event larger than max, or than cap(buf) if it is
+// larger, stops the iteration with bufio.ErrTooLong.
+//
+// It allows reusing a large buffer across streams to
+// avoid growing the buffer repeatedly. However, the
+// buffer must not be used by anything else, e.g. another
+// stream, while the stream is in use.
+//
+// If max <= 0, the DefaultMaxEventSize is used.
+func WithBuffer(buf []byte, max int) StreamOption {
+	return func(config *streamConfig) {
+		config.Buffer = buf
+		config.MaxEventSize = max
+	}
+}
+
+// WithSkipInvalid makes the stream skip over events
+// that cannot be un-marshaled instead of stopping the
+// iteration. The number of skipped events and the most
+// recent un-marshaling error are recorded and can be
+// retrieved from the stream.
+//
+// By default, an invalid event stops the iteration.
+func WithSkipInvalid() StreamOption {
+	return func(config *streamConfig) { config.SkipInvalid = true }
+}
+
+// WithStrictDecoding makes the stream reject events
+// that contain unknown JSON fields. Such an event stops
+// the iteration with an un-marshaling error. This helps
+// to detect that the server sends events that differ
+// from what the client expects.
+//
+// By default, unknown fields are ignored such that the
+// client remains compatible with newer servers.
+//
+// If WithSkipInvalid is specified as well then an event
+// with unknown fields is considered invalid. Therefore,
+// it gets skipped instead of stopping the iteration.
+func WithStrictDecoding() StreamOption {
+	return func(config *streamConfig) { config.Strict = true }
+}
+
+// WithRetainRaw makes the stream copy the raw content
+// of every event into a new buffer. This buffer is not
+// modified by subsequent calls of Next. Hence, the raw
+// content of an event remains valid.
+//
+// By default, the stream does not copy the raw content
+// of events to avoid allocations.
+func WithRetainRaw() StreamOption {
+	return func(config *streamConfig) { config.RetainRaw = true }
+}
+
+// WithSafeBytes makes the Bytes method of the stream
+// return a new copy of the raw event content on every
+// call. Such a copy is not modified by subsequent calls
+// of Next and can be retained safely.
+//
+// By default, Bytes returns a slice of the stream's
+// internal buffer to avoid allocations. Hence, it must
+// be copied before calling Next again. WithSafeBytes
+// trades one allocation per call of Bytes for not having
+// to think about copying.
+func WithSafeBytes() StreamOption {
+	return func(config *streamConfig) { config.SafeBytes = true }
+}
+
+// WithIdleTimeout makes the stream stop once it has not
+// received an event within d. Then, Next returns false and
+// Err returns ErrIdleTimeout. It allows to detect a stream,
+// e.g. a log subscription, that hangs without breaking.
+//
+// If the underlying io.Reader has a SetReadDeadline method,
+// like a net.Conn, the stream sets a read deadline before
+// waiting for the next event. Otherwise, it closes the
+// underlying io.Reader, if it implements io.Closer, once
+// the idle timeout expires. A stream with an io.Reader that
+// implements neither cannot detect an idle timeout.
+//
+// If d <= 0, there is no idle timeout.
+func WithIdleTimeout(d time.Duration) StreamOption {
+	return func(config *streamConfig) { config.IdleTimeout = d }
+}
+
+// WithClock sets the Clock that the stream uses for
+// time-based features - i.e. the idle timeout set by
+// WithIdleTimeout and the deduplication window of
+// ErrorStream.Dedup. By default, the wall clock is used.
+//
+// Read deadlines refer to the wall clock. Therefore, a
+// stream with a custom Clock does not set read deadlines
+// on the underlying io.Reader to detect an idle timeout.
+// Instead, it closes the io.Reader, if it implements
+// io.Closer, once the Clock's idle timer fires.
+func WithClock(c Clock) StreamOption {
+	return func(config *streamConfig) { config.Clock = c }
+}
+
+// WithDecoder sets the function that un-marshals each
+// event. It is called with the raw content of an event
+// and a pointer to the ErrorEvent resp. AuditEvent to
+// un-marshal into. The raw content must not be retained
+// once decode returns.
+//
+// It allows to plug in a faster JSON decoder than
+// encoding/json. If the WithStrictDecoding option is
+// specified as well, the decoder is responsible for
+// rejecting unknown fields.
+//
+// The stream resets the event before calling decode
+// such that fields of a previous event don't leak into
+// the next one. Only AuditStream.NextInto passes the
+// caller's event as it is. Then, the decoder has to reset
+// all fields that are not present in data but can reuse
+// the memory of the previous event.
+//
+// If decode is nil, json.Unmarshal is used.
+func WithDecoder(decode func(data []byte, v interface{}) error) StreamOption {
+	return func(config *streamConfig) { config.Decoder = decode }
+}
+
+// WithRedactor makes an AuditStream call redact for every
+// AuditEvent after un-marshaling it and before returning it
+// from Next. It allows to scrub or hash sensitive fields,
+// like the request path or identity. Filters of derived
+// streams, e.g. FilterFunc, see the redacted events.
+//
+// The redactor only modifies the un-marshaled AuditEvent.
+// The raw event content, returned by Bytes or RawCopy and
+// written by WithTee, remains unredacted.
+//
+// An ErrorStream ignores the redactor.
+func WithRedactor(redact func(*AuditEvent)) StreamOption {
+	return func(config *streamConfig) { config.Redactor = redact }
+}
+
+// WithSplitFunc sets the split function that breaks
+// the underlying stream into events. Each token returned
+// by split is un-marshaled as one event. Empty tokens
+// are ignored.
+//
+// By default, the stream is split into lines via
+// bufio.ScanLines.
+func WithSplitFunc(split bufio.SplitFunc) StreamOption {
+	return func(config *streamConfig) { config.Split = split }
+}
+
+// WithTee makes the stream write the raw content of every
+// event returned by Next, followed by a newline, to w before
+// Next returns. Events that are skipped, e.g. because they
+// are invalid, are not written to w.
+//
+// By default, an error returned by w does not stop the
+// iteration. Instead, the stream stops writing to w and
+// records the error. It can be retrieved via the TeeErr
+// method of the ErrorStream resp. AuditStream. If the
+// WithStrictTee option is specified as well, an error
+// returned by w stops the iteration.
+func WithTee(w io.Writer) StreamOption {
+	return func(config *streamConfig) { config.Tee = w }
+}
+
+// WithStrictTee makes the stream stop iterating once
+// writing an event to the io.Writer set via WithTee
+// fails. Then, Err returns the write error.
+func WithStrictTee() StreamOption {
+	return func(config *streamConfig) { config.StrictTee = true }
+}
+
+// StreamStats is a snapshot of the statistics of
+// a stream. See: AuditStream.Stats.
+type StreamStats struct {
+	Events     uint64 // Number of events returned by Next
+	EmptyLines uint64 // Number of empty lines that have been skipped
+	Bytes      uint64 // Number of bytes read from the underlying io.Reader
+	Closed     bool   // Whether the stream has been closed
+	Errored    bool   // Whether the stream stopped due to an error other than ErrStreamClosed
+}
+
+// StreamState describes whether a stream may produce
+// more events and, if not, why it stopped.
+type StreamState int
+
+// All states of a stream.
+const (
+	StreamActive  StreamState = iota // The stream may produce more events
+	StreamEOF                        // The stream reached the end of the underlying io.Reader
+	StreamErrored                    // The stream stopped due to an error other than ErrStreamClosed
+	StreamClosed                     // The stream has been closed before it stopped otherwise
+)
+
+// String returns the string representation
+// of the StreamState.
+func (s StreamState) String() string {
+	switch s {
+	case StreamActive:
+		return "active"
+	case StreamEOF:
+		return "EOF"
+	case StreamErrored:
+		return "errored"
+	case StreamClosed:
+		return "closed"
+	default:
+		return "StreamState(" + strconv.Itoa(int(s)) + ")"
+	}
+}
+
+// streamConfig holds the ErrorStream and AuditStream
+// configuration set by StreamOptions.
+type streamConfig struct {
+	MaxEventSize int
+	Buffer       []byte
+	SkipInvalid  bool
+	Strict       bool
+	RetainRaw    bool
+	SafeBytes    bool
+	IdleTimeout  time.Duration
+	Split        bufio.SplitFunc
+	Decoder      func([]byte, interface{}) error
+	Redactor     func(*AuditEvent)
+	Tee          io.Writer
+	StrictTee    bool
+	Clock        Clock
+}
+
+// newStreamConfig returns a streamConfig with all
+// options applied.
+func newStreamConfig(options []StreamOption) streamConfig {
+	var config streamConfig
+	for _, option := range options {
+		option(&config)
+	}
+	if config.MaxEventSize <= 0 {
+		config.MaxEventSize = DefaultMaxEventSize
+	}
+	if cap(config.Buffer) > config.MaxEventSize { // See: bufio.Scanner.Buffer
+		config.MaxEventSize = cap(config.Buffer)
+	}
+	return config
+}
+
+// stream is the line-oriented stream of JSON-encoded
+// events shared by the ErrorStream and AuditStream.
+type stream struct {
+	// Accessed atomically. Must be the first fields
+	// to ensure 64-bit alignment.
+	bytesRead  uint64 // number of bytes read from the underlying io.Reader
+	emptyLines uint64 // number of empty lines skipped
+	errored    uint32 // 1 once the stream stopped due to an error
+
+	scanner *bufio.Scanner
+	config  streamConfig
+
+	err      error
+	eof      bool   // true once the end of the stream has been reached
+	consumed int64  // number of bytes consumed by the scanner, including the initial offset
+	raw      []byte // copy of the most recent event, if RetainRaw is set
+
+	invalid   int   // number of skipped invalid events
+	decodeErr error // most recent un-marshaling error
+	ioErr     error // most recent error of the scanner
+
+	reuse bool // true while AuditStream.NextInto decodes into the caller's event
+
+	teeBuf []byte // buffer for writing an event and a newline to config.Tee
+	teeErr error  // first error returned by config.Tee
+
+	reader    io.Reader // the underlying io.Reader, see closeWithContext
+	closer    io.Closer
+	done      chan struct{} // closed by Close
+	closeOnce sync.Once
+}
+
+// newStream returns a new stream that splits r into
+// lines. If r implements io.Closer, closing the stream
+// closes r.
+func newStream(r io.Reader, options []StreamOption) *stream {
+	const InitialBufferSize = 4096
+
+	config := newStreamConfig(options)
+	s := &stream{
+		config: config,
+		reader: r,
+		done:   make(chan struct{}),
+	}
+	scanner := bufio.NewScanner(countReader{Reader: r, n: &s.bytesRead})
+	if config.Buffer != nil {
+		scanner.Buffer(config.Buffer, config.MaxEventSize)
+	} else if config.MaxEventSize < InitialBufferSize {
+		scanner.Buffer(make([]byte, 0, config.MaxEventSize), config.MaxEventSize)
+	} else {
+		scanner.Buffer(make([]byte, 0, InitialBufferSize), config.MaxEventSize)
+	}
+	split := bufio.ScanLines
+	if config.Split != nil {
+		split = config.Split
+	}
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := split(data, atEOF)
+		if advance > 0 && advance <= len(data) {
+			s.consumed += int64(advance)
+		}
+		return advance, token, err
+	})
+
+	s.scanner = scanner
+	if closer, ok := r.(io.Closer); ok {
+		s.closer = closer
+	}
+	return s
+}
+
+// countReader is an io.Reader that counts
+// the number of bytes read.
+type countReader struct {
+	io.Reader
+	n *uint64
+}
+
+func (r countReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	atomic.AddUint64(r.n, uint64(n))
+	return n, err
+}
+
+// stats returns the stream's statistics. It can
+// be called concurrently to iterating the stream.
+func (s *stream) stats() StreamStats {
+	return StreamStats{
+		EmptyLines: atomic.LoadUint64(&s.emptyLines),
+		Bytes:      atomic.LoadUint64(&s.bytesRead),
+		Closed:     s.isClosed(),
+		Errored:    atomic.LoadUint32(&s.errored) == 1,
+	}
+}
+
+// state returns the stream's StreamState. A stream
+// that stopped due to an error or at the end of the
+// stream keeps its state once it gets closed.
+func (s *stream) state() StreamState {
+	switch {
+	case s.err == ErrStreamClosed:
+		return StreamClosed
+	case s.err != nil:
+		return StreamErrored
+	case s.eof:
+		return StreamEOF
+	case s.isClosed():
+		return StreamClosed
+	default:
+		return StreamActive
+	}
+}
+
+// markErrored records whether the stream stopped
+// due to an error - excluding ErrStreamClosed.
+func (s *stream) markErrored() {
+	if s.err != nil && s.err != ErrStreamClosed {
+		atomic.StoreUint32(&s.errored, 1)
+	}
+}
+
+// isClosed returns true if and only if the
+// stream has been closed.
+func (s *stream) isClosed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Bytes returns the most recent line generated by
+// a call to next. It returns a copy of the line if
+// SafeBytes is set.
+func (s *stream) Bytes() []byte {
+	if s.config.SafeBytes {
+		return append([]byte(nil), s.scanner.Bytes()...)
+	}
+	return s.scanner.Bytes()
+}
+
+// next advances the stream to the next non-empty line
+// and un-marshals it into v.
+//
+// If the stream skips invalid events, next advances
+// to the next line that can be un-marshaled into v.
+func (s *stream) next(v interface{}) bool {
+	if s.err != nil || s.eof {
+		return false
+	}
+	if s.isClosed() {
+		s.err = ErrStreamClosed
+		return false
+	}
+
+	for {
+		if !s.scan() {
+			return false
+		}
+
+		err := s.decode(s.scanner.Bytes(), v)
+		if err == nil {
+			if s.config.RetainRaw {
+				s.raw = append(make([]byte, 0, len(s.scanner.Bytes())), s.scanner.Bytes()...)
+			}
+			if err = s.tee(s.scanner.Bytes()); err != nil && s.config.StrictTee {
+				s.err = err
+				return false
+			}
+			return true
+		}
+		s.decodeErr = err
+		if s.config.SkipInvalid {
+			s.invalid++
+			continue
+		}
+		if s.isClosed() { // Once the stream is closed we ignore the error
+			s.err = ErrStreamClosed
+		} else {
+			s.err = err
+		}
+		return false
+	}
+}
+
+// tee writes the line and a newline to the tee writer,
+// if any. Once a write has failed, tee does not write
+// anymore and returns the write error.
+func (s *stream) tee(line []byte) error {
+	if s.config.Tee == nil || s.teeErr != nil {
+		return s.teeErr
+	}
+
+	s.teeBuf = append(append(s.teeBuf[:0], line...), '\n')
+	if _, err := s.config.Tee.Write(s.teeBuf); err != nil {
+		s.teeErr = err
+	}
+	return s.teeErr
+}
+
+// skip advances the stream past up to n non-empty lines
+// without un-marshaling them. It returns the number of
+// lines skipped, which is less than n if the stream
+// reached its end or encountered an error.
+func (s *stream) skip(n int) int {
+	if s.err != nil || s.eof {
+		return 0
+	}
+	if s.isClosed() {
+		s.err = ErrStreamClosed
+		return 0
+	}
+
+	var skipped int
+	for skipped < n && s.scan() {
+		skipped++
+	}
+	s.markErrored()
+	return skipped
+}
+
+// scan advances the stream to the next non-empty line.
+// It returns false once the stream reached its end or
+// encountered an error.
+func (s *stream) scan() bool {
+	for {
+		if !s.scanner.Scan() {
+			switch {
+			case s.isClosed(): // Once the stream is closed we ignore the error
+				s.err = ErrStreamClosed
+			case s.scanner.Err() != nil:
+				s.err = s.scanner.Err()
+				s.ioErr = s.err
+			default:
+				s.eof = true
+			}
+			return false
+		}
+		if len(s.scanner.Bytes()) != 0 {
+			return true
+		}
+		atomic.AddUint64(&s.emptyLines, 1)
+	}
+}
+
+// decode un-marshals the JSON-encoded line into v.
+//
+// If v has a reset method, decode resets v before
+// un-marshaling such that fields of a previous event,
+// which are not present in line, don't leak into the
+// decoded event. Within AuditStream.NextInto, a custom
+// decoder is responsible for resetting v itself such
+// that it can reuse v's memory.
+func (s *stream) decode(line []byte, v interface{}) error {
+	if r, ok := v.(interface{ reset() }); ok && !(s.reuse && s.config.Decoder != nil) {
+		r.reset()
+	}
+	if s.config.Decoder != nil {
+		return s.config.Decoder(line, v)
+	}
+	if !s.config.Strict {
+		return json.Unmarshal(line, v)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(line[decoder.InputOffset():])) != 0 {
+		return errors.New("kes: invalid event: unexpected data after top-level JSON value")
+	}
+	return nil
+}
+
+// nextContext behaves like next but stops once the
+// ctx.Done() channel completes or the idle timeout,
+// if any, expires.
+//
+// If the underlying io.Reader implements io.Closer,
+// nextContext closes it when ctx.Done() completes
+// while waiting for the next line. This unblocks any
+// pending read.
+func (s *stream) nextContext(ctx context.Context, v interface{}) bool {
+	defer s.markErrored()
+
+	if s.config.IdleTimeout <= 0 || s.err != nil || s.eof || s.isClosed() {
+		return s.nextOrDone(ctx, v)
+	}
+
+	type DeadlineReader interface {
+		SetReadDeadline(time.Time) error
+	}
+	if r, ok := s.reader.(DeadlineReader); ok && s.config.Clock == nil {
+		if err := r.SetReadDeadline(time.Now().Add(s.config.IdleTimeout)); err == nil {
+			ok = s.nextOrDone(ctx, v)
+			if netErr, isNetErr := s.err.(net.Error); isNetErr && netErr.Timeout() {
+				s.err = ErrIdleTimeout
+			}
+			return ok
+		}
+	}
+
+	idleCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var expired uint32 // 1 once the idle timer has fired
+	timer := clockOrDefault(s.config.Clock).NewTimer(s.config.IdleTimeout)
+	defer timer.Stop()
+	go func() {
+		select {
+		case <-timer.C():
+			atomic.StoreUint32(&expired, 1)
+			cancel()
+		case <-idleCtx.Done():
+		}
+	}()
+
+	ok := s.nextOrDone(idleCtx, v)
+	if !ok && s.err == context.Canceled && atomic.LoadUint32(&expired) == 1 && ctx.Err() == nil {
+		s.err = ErrIdleTimeout
+	}
+	return ok
+}
+
+// nextOrDone behaves like next but stops once
+// the ctx.Done() channel completes.
+func (s *stream) nextOrDone(ctx context.Context, v interface{}) bool {
+	if s.err != nil || s.eof || s.isClosed() {
+		return s.next(v)
+	}
+	if err := ctx.Err(); err != nil {
+		s.err = err
+		return false
+	}
+	if ctx.Done() == nil { // The ctx can never be canceled
+		return s.next(v)
+	}
+
+	var (
+		stop        = make(chan struct{})
+		done        = make(chan struct{})
+		interrupted bool
+	)
+	go func() {
+		defer close(done)
+
+		select {
+		case <-ctx.Done():
+			if s.closer != nil {
+				interrupted = true
+				s.closer.Close() // Unblock any pending read
+			}
+		case <-stop:
+		}
+	}()
+	ok := s.next(v)
+	close(stop)
+	<-done
+
+	// Once we have closed the underlying reader we cannot
+	// continue iterating - even if we have received a line.
+	if interrupted {
+		s.err = ctx.Err()
+		return false
+	}
+	return ok
+}
+
+// Close closes the underlying io.Reader if
+// it implements io.Closer.
+//
+// Close also closes the done channel such that
+// any goroutine waiting on it gets notified.
+// If the io.Reader does not implement io.Closer
+// Close does nothing.
+func (s *stream) Close() (err error) {
+	if s.closer != nil {
+		s.closeOnce.Do(func() { close(s.done) })
+		err = s.closer.Close()
+	}
+	return err
+}
+
+// closeWithContext reads the remaining content of the
+// underlying io.Reader until it reaches the end or the
+// ctx.Done() channel completes. Then it closes the
+// underlying io.Reader.
+//
+// Reading the remaining content allows an http.Transport
+// to reuse the connection of an HTTP response body.
+//
+// If the io.Reader does not implement io.Closer
+// closeWithContext does nothing.
+func (s *stream) closeWithContext(ctx context.Context) error {
+	if s.closer == nil {
+		return nil
+	}
+	s.closeOnce.Do(func() { close(s.done) })
+
+	if ctx.Err() == nil {
+		drained := make(chan struct{})
+		go func() {
+			defer close(drained)
+			io.Copy(ioutil.Discard, s.reader)
+		}()
+
+		// If ctx expires first, closing the io.Reader
+		// unblocks the pending read such that the
+		// goroutine returns.
+		select {
+		case <-drained:
+		case <-ctx.Done():
+		}
+	}
+	return s.closer.Close()
+}
+
+// gzipReader is an io.ReadCloser that decompresses
+// an underlying io.Reader and closes both, the gzip
+// decompressor and the underlying io.Reader, if it
+// implements io.Closer.
+type gzipReader struct {
+	*gzip.Reader
+	r io.Reader
+}
+
+func newGzipReader(r io.Reader) (*gzipReader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &gzipReader{Reader: gz, r: r}, nil
+}
+
+func (r *gzipReader) Close() error {
+	err := r.Reader.Close()
+	if closer, ok := r.r.(io.Closer); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,60 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// NewClientTLS returns a new TLS config for mTLS
+// authentication to a KES server.
+//
+// It loads the PEM-encoded client certificate and private
+// key from certFile and keyFile. If caFile is not empty,
+// the returned config only trusts the PEM-encoded CA
+// certificates in caFile to verify the KES server
+// certificate. Otherwise, it trusts the system root CAs.
+func NewClientTLS(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("kes: failed to load client certificate '%s' or private key '%s': %v", certFile, keyFile, err)
+	}
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{cert},
+	}
+	if caFile == "" {
+		return config, nil
+	}
+
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("kes: failed to read CA certificates: %v", err)
+	}
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("kes: '%s' does not contain a valid PEM-encoded X.509 certificate", caFile)
+	}
+	config.RootCAs = rootCAs
+	return config, nil
+}
+
+// NewClientWithCertFiles returns a new KES client with the
+// given KES server endpoint that uses the client certificate
+// and private key in certFile and keyFile for mTLS and the
+// CA certificates in caFile to verify the server certificate.
+// If caFile is empty, the system root CAs are used.
+//
+// See NewClientTLS and NewClientWithConfig for more details.
+func NewClientWithCertFiles(endpoint, certFile, keyFile, caFile string, options ...ClientOption) (*Client, error) {
+	config, err := NewClientTLS(certFile, keyFile, caFile)
+	if err != nil {
+		return nil, err
+	}
+	return NewClientWithConfig(endpoint, config, options...), nil
+}
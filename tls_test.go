@@ -0,0 +1,53 @@
+// Copyright 2021 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package kes
+
+import "testing"
+
+var newClientTLSTests = []struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+	Err      bool
+}{
+	{CertFile: "root.cert", KeyFile: "root.key", CAFile: ""},                    // 0
+	{CertFile: "root.cert", KeyFile: "root.key", CAFile: "root.cert"},           // 1
+	{CertFile: "root.cert", KeyFile: "root.key", CAFile: "root.key", Err: true}, // 2
+	{CertFile: "root.cert", KeyFile: "root.key", CAFile: "unknown", Err: true},  // 3
+	{CertFile: "root.key", KeyFile: "root.cert", CAFile: "", Err: true},         // 4
+	{CertFile: "unknown", KeyFile: "root.key", CAFile: "", Err: true},           // 5
+}
+
+func TestNewClientTLS(t *testing.T) {
+	for i, test := range newClientTLSTests {
+		config, err := NewClientTLS(test.CertFile, test.KeyFile, test.CAFile)
+		if test.Err && err == nil {
+			t.Fatalf("Test %d: loading TLS config should have failed", i)
+		}
+		if !test.Err && err != nil {
+			t.Fatalf("Test %d: failed to load TLS config: %v", i, err)
+		}
+		if err != nil {
+			continue
+		}
+		if len(config.Certificates) != 1 {
+			t.Fatalf("Test %d: got %d client certificates - want %d", i, len(config.Certificates), 1)
+		}
+		if test.CAFile == "" && config.RootCAs != nil {
+			t.Fatalf("Test %d: config should use the system root CAs", i)
+		}
+		if test.CAFile != "" && config.RootCAs == nil {
+			t.Fatalf("Test %d: config does not contain any root CAs", i)
+		}
+	}
+
+	client, err := NewClientWithCertFiles("https://127.0.0.1:7373", "root.cert", "root.key", "root.cert")
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if client.Endpoint != "https://127.0.0.1:7373" {
+		t.Fatalf("Invalid endpoint: got %q - want %q", client.Endpoint, "https://127.0.0.1:7373")
+	}
+}